@@ -0,0 +1,375 @@
+package netfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//只读归档的目录树，ZipFs 与 TarFs 共用
+type archiveFs struct {
+	entries map[string]*archiveEntry
+}
+
+type archiveEntry struct {
+	info     *FileInfo
+	link     string                        //符号链接的目标
+	children []string                      //目录下的名称
+	ra       io.ReaderAt                   //内容可随机读取时非空
+	open     func() (io.ReadCloser, error) //从头顺序读取内容
+}
+
+func (a *archiveFs) init() {
+	a.entries = map[string]*archiveEntry{
+		"/": {info: &FileInfo{name: "/", mode: os.ModeDir | 0755}},
+	}
+}
+
+//加入一项，并补全缺少的上级目录，同名的后加入者覆盖先加入者
+func (a *archiveFs) add(name string, e *archiveEntry) {
+	name = path.Clean("/" + name)
+	if name == "/" {
+		return
+	}
+	e.info.name = path.Base(name)
+
+	if old, ok := a.entries[name]; ok {
+		if e.info.IsDir() {
+			e.children = old.children
+		}
+		a.entries[name] = e
+		return
+	}
+	a.entries[name] = e
+
+	dir := path.Dir(name)
+	parent, ok := a.entries[dir]
+	if !ok {
+		parent = &archiveEntry{info: &FileInfo{mode: os.ModeDir | 0755, modtime: e.info.modtime}}
+		a.add(dir, parent)
+	}
+	parent.children = append(parent.children, e.info.name)
+}
+
+//查找 name，follow 时跟随最后一级的符号链接，返回最终的路径
+func (a *archiveFs) lookup(op, name string, follow bool) (*archiveEntry, string, error) {
+	clean := path.Clean("/" + name)
+	for i := 0; ; i++ {
+		e, ok := a.entries[clean]
+		if !ok {
+			return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		if !follow || e.link == "" {
+			return e, clean, nil
+		}
+		if i >= 40 {
+			return nil, "", &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+		}
+		if path.IsAbs(e.link) {
+			clean = path.Clean(e.link)
+		} else {
+			clean = path.Join(path.Dir(clean), e.link)
+		}
+	}
+}
+
+func (a *archiveFs) stat(op, name string, follow bool) (os.FileInfo, error) {
+	e, _, err := a.lookup(op, name, follow)
+	if err != nil {
+		return nil, err
+	}
+
+	//跟随链接时名称仍为 name 的最后一级
+	fi := *e.info
+	if base := path.Base(path.Clean("/" + name)); base != "/" {
+		fi.name = base
+	}
+	return &fi, nil
+}
+
+func (a *archiveFs) Chmod(name string, mode os.FileMode) error {
+	return erofs("chmod", name)
+}
+
+func (a *archiveFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return erofs("chtimes", name)
+}
+
+func (a *archiveFs) Mkdir(name string, perm os.FileMode) error {
+	return erofs("mkdir", name)
+}
+
+func (a *archiveFs) MkdirAll(pathName string, perm os.FileMode) error {
+	return erofs("mkdir", pathName)
+}
+
+func (a *archiveFs) Remove(name string) error {
+	return erofs("remove", name)
+}
+
+func (a *archiveFs) RemoveAll(pathName string) error {
+	return erofs("removeall", pathName)
+}
+
+func (a *archiveFs) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EROFS}
+}
+
+func (a *archiveFs) Truncate(name string, size int64) error {
+	return erofs("truncate", name)
+}
+
+func (a *archiveFs) Create(name string) (file File, err error) {
+	return nil, erofs("open", name)
+}
+
+func (a *archiveFs) Open(name string) (file File, err error) {
+	return a.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (a *archiveFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if isWriteFlag(flag) {
+		return nil, erofs("open", name)
+	}
+
+	e, clean, err := a.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	return &archiveFile{fs: a, e: e, path: clean, name: name}, nil
+}
+
+func (a *archiveFs) Stat(name string) (fi os.FileInfo, err error) {
+	return a.stat("stat", name, true)
+}
+
+func (a *archiveFs) Lstat(name string) (fi os.FileInfo, err error) {
+	return a.stat("lstat", name, false)
+}
+
+type archiveFile struct {
+	mu     sync.Mutex
+	fs     *archiveFs
+	e      *archiveEntry
+	path   string
+	name   string
+	off    int64
+	rd     io.ReadCloser //顺序读取时的当前读取器，已读到 pos
+	pos    int64
+	dirs   []string
+	listed bool
+	closed bool
+}
+
+func (f *archiveFile) Chmod(mode os.FileMode) error {
+	return erofs("chmod", f.name)
+}
+
+func (f *archiveFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	if f.rd != nil {
+		f.rd.Close()
+		f.rd = nil
+	}
+	return nil
+}
+
+func (f *archiveFile) Name() string {
+	return f.name
+}
+
+func (f *archiveFile) Read(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err = f.readAt(b, f.off)
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func (f *archiveFile) ReadAt(b []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.readAt(b, off)
+}
+
+//读满 b，到文件末尾时返回 io.EOF
+func (f *archiveFile) readAt(b []byte, off int64) (n int, err error) {
+	if f.closed {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: os.ErrClosed}
+	}
+	if f.e.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	want := len(b)
+	if rest := f.e.info.size - off; rest < int64(want) {
+		if rest < 0 {
+			rest = 0
+		}
+		b = b[:rest]
+	}
+
+	if len(b) > 0 {
+		if f.e.ra != nil {
+			n, err = f.e.ra.ReadAt(b, off)
+		} else {
+			n, err = f.stream(b, off)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return n, &os.PathError{Op: "read", Path: f.name, Err: err}
+		}
+	}
+
+	if n < want {
+		err = io.EOF
+	}
+	return n, err
+}
+
+//顺序读取，向回读取时从头重新打开
+func (f *archiveFile) stream(b []byte, off int64) (int, error) {
+	if f.rd == nil || off < f.pos {
+		if f.rd != nil {
+			f.rd.Close()
+			f.rd = nil
+		}
+		rd, err := f.e.open()
+		if err != nil {
+			return 0, err
+		}
+		f.rd, f.pos = rd, 0
+	}
+
+	if off > f.pos {
+		n, err := io.CopyN(ioutil.Discard, f.rd, off-f.pos)
+		f.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := io.ReadFull(f.rd, b)
+	f.pos += int64(n)
+	return n, err
+}
+
+func (f *archiveFile) Readdir(n int) (fi []os.FileInfo, err error) {
+	names, err := f.Readdirnames(n)
+	for _, name := range names {
+		if e, ok := f.fs.entries[path.Join(f.path, name)]; ok {
+			fi = append(fi, e.info)
+		}
+	}
+	return
+}
+
+func (f *archiveFile) Readdirnames(n int) (names []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, &os.PathError{Op: "readdirent", Path: f.name, Err: os.ErrClosed}
+	}
+	if !f.e.info.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	if !f.listed {
+		f.dirs = append([]string(nil), f.e.children...)
+		sort.Strings(f.dirs)
+		f.listed = true
+	}
+
+	if n > 0 && len(f.dirs) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(f.dirs) {
+		n = len(f.dirs)
+	}
+
+	names = f.dirs[:n]
+	f.dirs = f.dirs[n:]
+	return
+}
+
+func (f *archiveFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = f.off + offset
+	case io.SeekEnd:
+		ret = f.e.info.size + offset
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if ret < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	f.off = ret
+	if ret == 0 {
+		f.listed = false
+	}
+	return ret, nil
+}
+
+func (f *archiveFile) Stat() (fi os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	return f.fs.stat("stat", f.name, true)
+}
+
+func (f *archiveFile) Sync() (err error) {
+	return nil
+}
+
+func (f *archiveFile) Truncate(size int64) error {
+	return erofs("truncate", f.name)
+}
+
+func (f *archiveFile) Write(b []byte) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *archiveFile) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *archiveFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
@@ -0,0 +1,172 @@
+package netfs
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func test_zip(t *testing.T) *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	add := func(name string, method uint16, mode os.FileMode, body string) {
+		h := &zip.FileHeader{Name: name, Method: method, Modified: time.Unix(1500000000, 0)}
+		h.SetMode(mode)
+		w, err := zw.CreateHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(body))
+	}
+	add("a/", zip.Store, os.ModeDir|0755, "")
+	add("a/b.txt", zip.Deflate, 0644, "a/b.txt")
+	add("c.txt", zip.Store, 0644, "c.txt")
+	add("x/y.txt", zip.Deflate, 0644, "x/y.txt")
+	add("l", zip.Store, os.ModeSymlink|0777, "a/b.txt")
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func test_tar(t *testing.T, gz bool) *bytes.Reader {
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if gz {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+
+	add := func(h *tar.Header, body string) {
+		h.ModTime = time.Unix(1500000000, 0)
+		h.Size = int64(len(body))
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(body))
+	}
+	add(&tar.Header{Name: "a/", Typeflag: tar.TypeDir, Mode: 0755}, "")
+	add(&tar.Header{Name: "a/b.txt", Typeflag: tar.TypeReg, Mode: 0644}, "a/b.txt")
+	add(&tar.Header{Name: "./c.txt", Typeflag: tar.TypeReg, Mode: 0644}, "c.txt")
+	add(&tar.Header{Name: "x/y.txt", Typeflag: tar.TypeReg, Mode: 0644}, "x/y.txt")
+	add(&tar.Header{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "a/b.txt", Mode: 0777}, "")
+	add(&tar.Header{Name: "h", Typeflag: tar.TypeLink, Linkname: "c.txt"}, "")
+
+	tw.Close()
+	if zw != nil {
+		zw.Close()
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func test_archive_fs(t *testing.T, fs FileSystem) {
+	if s := test_read_file(fs, "a/b.txt"); s != "a/b.txt" {
+		t.Errorf("Read expect:a/b.txt, get:%s", s)
+	}
+	if s := test_read_file(fs, "c.txt"); s != "c.txt" {
+		t.Errorf("Read expect:c.txt, get:%s", s)
+	}
+	if s := test_read_file(fs, "l"); s != "a/b.txt" {
+		t.Errorf("Read link expect:a/b.txt, get:%s", s)
+	}
+	if s := test_list_dir(fs, "x"); s != "y.txt" {
+		t.Errorf("List expect:y.txt, get:%s", s)
+	}
+
+	//x 为隐式目录
+	if fi, err := fs.Stat("x"); err != nil || !fi.IsDir() {
+		t.Errorf("Stat expect:dir, get:%v %v", fi, err)
+	}
+	if fi, err := fs.Stat("a/b.txt"); err != nil || fi.Size() != 7 || fi.Mode() != 0644 || fi.ModTime().Unix() != 1500000000 {
+		t.Errorf("Stat expect:7 0644, get:%v %v", fi, err)
+	}
+	if fi, err := fs.Lstat("l"); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat expect:symlink, get:%v %v", fi, err)
+	}
+	if fi, err := fs.Stat("l"); err != nil || fi.Name() != "l" || fi.Size() != 7 {
+		t.Errorf("Stat expect:l 7, get:%v %v", fi, err)
+	}
+	if _, err := fs.Stat("none"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+
+	//随机读取与向回 Seek
+	for _, name := range []string{"a/b.txt", "x/y.txt"} {
+		f, err := fs.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 3)
+		if n, err := f.ReadAt(b, 4); n != 3 || err != nil || string(b) != "txt" {
+			t.Errorf("ReadAt expect:txt, get:%d %v %s", n, err, b)
+		}
+		if n, err := f.ReadAt(b, 5); n != 2 || err != io.EOF {
+			t.Errorf("ReadAt expect:2 EOF, get:%d %v", n, err)
+		}
+		f.Seek(2, io.SeekStart)
+		if n, err := f.Read(b); n != 3 || err != nil || string(b[:n]) != name[2:5] {
+			t.Errorf("Read expect:%s, get:%d %v %s", name[2:5], n, err, b)
+		}
+		f.Close()
+	}
+
+	//只读
+	if _, err := fs.Create("new.txt"); !test_is_erofs(err) {
+		t.Errorf("Create expect:EROFS, get:%v", err)
+	}
+	if err := fs.Remove("c.txt"); !test_is_erofs(err) {
+		t.Errorf("Remove expect:EROFS, get:%v", err)
+	}
+}
+
+func test_is_erofs(err error) bool {
+	e, ok := err.(*os.PathError)
+	return ok && e.Err == syscall.EROFS
+}
+
+func Test_ZipFs(t *testing.T) {
+	r := test_zip(t)
+	fs, err := new(ZipFs).Init(r, r.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	test_archive_fs(t, fs)
+	if s := test_list_dir(fs, "/"); s != "a,c.txt,l,x" {
+		t.Errorf("List expect:a,c.txt,l,x, get:%s", s)
+	}
+	if e := fs.entries["/c.txt"]; e.ra == nil {
+		t.Error("Stored entry expect:random access, get:nil")
+	}
+}
+
+func Test_TarFs(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		r := test_tar(t, gz)
+		fs, err := new(TarFs).Init(r, r.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		test_archive_fs(t, fs)
+		if s := test_list_dir(fs, "/"); s != "a,c.txt,h,l,x" {
+			t.Errorf("List expect:a,c.txt,h,l,x, get:%s", s)
+		}
+		if s := test_read_file(fs, "h"); s != "c.txt" {
+			t.Errorf("Read hard link expect:c.txt, get:%s", s)
+		}
+		if e := fs.entries["/a/b.txt"]; (e.ra != nil) == gz {
+			t.Errorf("Random access expect:%v, get:%v", !gz, e.ra != nil)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package netfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//审计记录，每条记录一个修改操作
+//Size 为 truncate 的目标大小，Bytes/Writes 为关闭文件时汇总的写入字节数与次数
+type AuditRecord struct {
+	Time      time.Time   `json:"time"`
+	Session   uint64      `json:"session"`
+	Remote    string      `json:"remote"`
+	Principal string      `json:"principal,omitempty"`
+	Share     string      `json:"share,omitempty"`
+	Op        string      `json:"op"`
+	Path      string      `json:"path"`
+	NewPath   string      `json:"new_path,omitempty"`
+	Flag      int         `json:"flag,omitempty"`
+	Mode      os.FileMode `json:"mode,omitempty"`
+	Size      int64       `json:"size,omitempty"`
+	Bytes     int64       `json:"bytes,omitempty"`
+	Writes    int64       `json:"writes,omitempty"`
+	Result    string      `json:"result"`
+	Error     string      `json:"error,omitempty"`
+}
+
+//审计记录的去处，实现需并发安全
+type Auditor interface {
+	Audit(r *AuditRecord)
+}
+
+// ----- JSON lines 文件 -----
+
+//以 JSON lines 追加写入文件，超过 MaxSize 时轮转为 Path.1 ... Path.N
+type AuditLog struct {
+	Path       string
+	MaxSize    int64 //为 0 时不轮转
+	MaxBackups int   //至少保留 1 个
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func (a *AuditLog) Init(path string, maxSize int64, maxBackups int) (*AuditLog, error) {
+	a.Path = path
+	a.MaxSize = maxSize
+	a.MaxBackups = maxBackups
+
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	f, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	a.f = f
+	a.size = fi.Size()
+	return nil
+}
+
+func (a *AuditLog) Audit(r *AuditRecord) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		getLog().Error("audit encode failed", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		getLog().Error("audit write failed", "path", a.Path, "error", os.ErrClosed)
+		return
+	}
+
+	if a.MaxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.MaxSize {
+		if err := a.rotate(); err != nil {
+			getLog().Error("audit rotate failed", "path", a.Path, "error", err)
+		}
+	}
+
+	n, err := a.f.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		getLog().Error("audit write failed", "path", a.Path, "error", err)
+	}
+}
+
+//立即轮转，可在收到 SIGHUP 等信号时调用
+func (a *AuditLog) Rotate() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rotate()
+}
+
+func (a *AuditLog) rotate() error {
+	if a.f != nil {
+		a.f.Close()
+		a.f = nil
+	}
+
+	//审计记录不能丢弃，至少保留一个备份
+	backups := a.MaxBackups
+	if backups < 1 {
+		backups = 1
+	}
+	os.Remove(a.backup(backups))
+	for i := backups - 1; i > 0; i-- {
+		os.Rename(a.backup(i), a.backup(i+1))
+	}
+	if err := os.Rename(a.Path, a.backup(1)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return a.open()
+}
+
+func (a *AuditLog) backup(i int) string {
+	return a.Path + "." + strconv.Itoa(i)
+}
+
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return os.ErrClosed
+	}
+	err := a.f.Close()
+	a.f = nil
+	return err
+}
+
+// ----- 会话审计 -----
+
+//记录会话中所有修改操作的文件系统
+type auditFs struct {
+	FileSystem
+	a      Auditor
+	record AuditRecord
+}
+
+//按当前会话信息包装
+func (c *Server) audited(a Auditor, fs FileSystem) FileSystem {
+	f := &auditFs{FileSystem: fs, a: a}
+	f.record.Session = c.session
+	f.record.Remote = c.remote
+	f.record.Principal = c.principal
+	if c.share != nil {
+		f.record.Share = c.share.Name
+	}
+	return f
+}
+
+func (f *auditFs) audit(r AuditRecord, err error) {
+	r.Time = time.Now()
+	r.Session = f.record.Session
+	r.Remote = f.record.Remote
+	r.Principal = f.record.Principal
+	r.Share = f.record.Share
+
+	r.Result = "ok"
+	if err != nil {
+		r.Result = "error"
+		r.Error = err.Error()
+	}
+	f.a.Audit(&r)
+}
+
+func (f *auditFs) Watch(name string, recursive bool) (*Watcher, error) {
+	if fs, ok := f.FileSystem.(WatchFs); ok {
+		return fs.Watch(name, recursive)
+	}
+	return nil, errors.New("Watch Not Supported")
+}
+
+func (f *auditFs) Chmod(name string, mode os.FileMode) error {
+	err := f.FileSystem.Chmod(name, mode)
+	f.audit(AuditRecord{Op: "chmod", Path: name, Mode: mode}, err)
+	return err
+}
+
+func (f *auditFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	err := f.FileSystem.Chtimes(name, atime, mtime)
+	f.audit(AuditRecord{Op: "chtimes", Path: name}, err)
+	return err
+}
+
+func (f *auditFs) Mkdir(name string, perm os.FileMode) error {
+	err := f.FileSystem.Mkdir(name, perm)
+	f.audit(AuditRecord{Op: "mkdir", Path: name, Mode: perm}, err)
+	return err
+}
+
+func (f *auditFs) MkdirAll(path string, perm os.FileMode) error {
+	err := f.FileSystem.MkdirAll(path, perm)
+	f.audit(AuditRecord{Op: "mkdirall", Path: path, Mode: perm}, err)
+	return err
+}
+
+func (f *auditFs) Remove(name string) error {
+	err := f.FileSystem.Remove(name)
+	f.audit(AuditRecord{Op: "remove", Path: name}, err)
+	return err
+}
+
+func (f *auditFs) RemoveAll(path string) error {
+	err := f.FileSystem.RemoveAll(path)
+	f.audit(AuditRecord{Op: "removeall", Path: path}, err)
+	return err
+}
+
+func (f *auditFs) Rename(oldpath, newpath string) error {
+	err := f.FileSystem.Rename(oldpath, newpath)
+	f.audit(AuditRecord{Op: "rename", Path: oldpath, NewPath: newpath}, err)
+	return err
+}
+
+func (f *auditFs) Truncate(name string, size int64) error {
+	err := f.FileSystem.Truncate(name, size)
+	f.audit(AuditRecord{Op: "truncate", Path: name, Size: size}, err)
+	return err
+}
+
+func (f *auditFs) Create(name string) (File, error) {
+	file, err := f.FileSystem.Create(name)
+	f.audit(AuditRecord{Op: "create", Path: name}, err)
+	if err != nil {
+		return nil, err
+	}
+	return &auditFile{File: file, fs: f, name: name}, nil
+}
+
+func (f *auditFs) Open(name string) (File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+//只读打开不记录，但文件上的 Chmod 等修改仍需记录
+func (f *auditFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	file, err := f.FileSystem.OpenFile(name, flag, perm)
+	if isWriteFlag(flag) {
+		f.audit(AuditRecord{Op: "openfile", Path: name, Flag: flag, Mode: perm}, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &auditFile{File: file, fs: f, name: name}, nil
+}
+
+//打开的文件，写入在关闭时汇总为一条记录
+type auditFile struct {
+	File
+	fs   *auditFs
+	name string
+
+	mu     sync.Mutex
+	bytes  int64
+	writes int64
+	err    error
+}
+
+func (f *auditFile) wrote(n int, err error) {
+	f.mu.Lock()
+	f.bytes += int64(n)
+	f.writes++
+	if err != nil && err != io.EOF {
+		f.err = err
+	}
+	f.mu.Unlock()
+}
+
+func (f *auditFile) Chmod(mode os.FileMode) error {
+	err := f.File.Chmod(mode)
+	f.fs.audit(AuditRecord{Op: "chmod", Path: f.name, Mode: mode}, err)
+	return err
+}
+
+func (f *auditFile) Truncate(size int64) error {
+	err := f.File.Truncate(size)
+	f.fs.audit(AuditRecord{Op: "truncate", Path: f.name, Size: size}, err)
+	return err
+}
+
+func (f *auditFile) Write(b []byte) (n int, err error) {
+	n, err = f.File.Write(b)
+	f.wrote(n, err)
+	return
+}
+
+func (f *auditFile) WriteAt(b []byte, off int64) (n int, err error) {
+	n, err = f.File.WriteAt(b, off)
+	f.wrote(n, err)
+	return
+}
+
+func (f *auditFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *auditFile) Close() error {
+	err := f.File.Close()
+
+	f.mu.Lock()
+	bytes, writes, werr := f.bytes, f.writes, f.err
+	f.writes = 0
+	f.mu.Unlock()
+
+	if writes > 0 {
+		f.fs.audit(AuditRecord{Op: "write", Path: f.name, Bytes: bytes, Writes: writes}, werr)
+	}
+	return err
+}
+
+func (f *auditFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *auditFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *auditFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
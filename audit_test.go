@@ -0,0 +1,157 @@
+package netfs
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func test_read_audit(t *testing.T, name string) []AuditRecord {
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var rs []AuditRecord
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r AuditRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatalf("Unmarshal expect:nil, get:%v", err)
+		}
+		rs = append(rs, r)
+	}
+	return rs
+}
+
+func Test_Audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netfs_audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "audit.log")
+	audit, err := new(AuditLog).Init(name, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	exports := new(Exports).Init()
+	exports.Audit = audit
+	exports.Auth = func(principal, secret string) bool {
+		return true
+	}
+	exports.Add(&Share{Fs: test_mem_fs(t, "old.txt")})
+
+	go exports.Listen("127.0.0.1:11127")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11127")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Auth("bob", "")
+
+	f, err := c.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello"))
+	f.Write([]byte(" world"))
+	f.Close()
+
+	//只读操作不记录
+	c.Stat("a.txt")
+	test_read_file(c, "a.txt")
+
+	//只读打开的文件上的修改仍记录
+	r, err := c.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Chmod(0600)
+	r.Close()
+
+	c.Rename("a.txt", "b.txt")
+	c.Remove("none.txt")
+
+	rs := test_read_audit(t, name)
+
+	ops := ""
+	for _, r := range rs {
+		ops += r.Op + ","
+	}
+	if ops != "create,write,chmod,rename,remove," {
+		t.Fatalf("Audit expect:create,write,chmod,rename,remove, get:%s", ops)
+	}
+
+	if r := rs[1]; r.Path != "a.txt" || r.Bytes != 11 || r.Writes != 2 || r.Result != "ok" {
+		t.Errorf("Write expect:{a.txt 11 2 ok}, get:%+v", r)
+	}
+	if r := rs[2]; r.Path != "a.txt" || r.Mode != 0600 || r.Result != "ok" {
+		t.Errorf("Chmod expect:{a.txt 0600 ok}, get:%+v", r)
+	}
+	if r := rs[3]; r.NewPath != "b.txt" || r.Principal != "bob" || r.Remote == "" || r.Time.IsZero() {
+		t.Errorf("Rename expect:{b.txt bob}, get:%+v", r)
+	}
+	if r := rs[4]; r.Result != "error" || r.Error == "" {
+		t.Errorf("Remove expect:error, get:%+v", r)
+	}
+}
+
+func Test_AuditLog_Rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netfs_audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "audit.log")
+	audit, err := new(AuditLog).Init(name, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	for i := 0; i < 20; i++ {
+		audit.Audit(&AuditRecord{Op: "remove", Path: "a.txt", Result: "ok"})
+	}
+
+	for _, n := range []string{name, name + ".1", name + ".2"} {
+		fi, err := os.Stat(n)
+		if err != nil {
+			t.Errorf("Stat expect:nil, get:%v", err)
+		} else if fi.Size() > 300 {
+			t.Errorf("Size expect:<=300, get:%d", fi.Size())
+		}
+	}
+	if _, err := os.Stat(name + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+
+	//MaxBackups 为 0 时仍保留一个备份
+	name = filepath.Join(dir, "audit0.log")
+	audit0, err := new(AuditLog).Init(name, 300, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit0.Close()
+
+	for i := 0; i < 20; i++ {
+		audit0.Audit(&AuditRecord{Op: "remove", Path: "a.txt", Result: "ok"})
+	}
+	if _, err := os.Stat(name + ".1"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+	if _, err := os.Stat(name + ".2"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+}
@@ -3,16 +3,15 @@ package netfs
 import (
 	"time"
 	"os"
-	"log"
-	"github.com/bybzmt/golang-filelog"
 )
 
-const VERSION uint32 = 1
+const VERSION uint32 = 2
 
 const (
 	TYTE_INIT uint8 = iota + 1
 	TYPE_REQUEST
 	TYPE_RESPONSE
+	TYPE_EVENT
 )
 
 const (
@@ -21,6 +20,10 @@ const (
 
 	//ping
 	LINK_PING
+
+	//认证与选择共享目录
+	LINK_AUTH
+	LINK_SHARE
 )
 
 const (
@@ -38,6 +41,7 @@ const (
 	FS_OPENFILE
 	FS_LSTAT
 	FS_STAT
+	FS_WATCH
 )
 
 const (
@@ -54,6 +58,8 @@ const (
 	FILE_TRUNCATE
 	FILE_WRITE
 	FILE_WRITEAT
+	FILE_LOCK
+	FILE_UNLOCK
 )
 
 const (
@@ -61,6 +67,9 @@ const (
 	ERROR_MAX uint16 = 0xFF00
 	ERROR_NIL uint16 = 0xFF01
 	ERROR_EOF uint16 = 0xFF02
+	ERROR_PATH uint16 = 0xFF03
+	ERROR_LINK uint16 = 0xFF04
+	ERROR_ERRNO uint16 = 0xFF05
 )
 
 type IO_Error string
@@ -141,19 +150,6 @@ func (fi *FileInfo) Sys() interface{} {
 }
 
 
-var Logger flog.Writer
-
-func getLog() flog.Writer {
-	if Logger == nil {
-		var err error
-		Logger, err = flog.New("", "LOCAL0:NOTICE", "netfs")
-		if err != nil {
-			log.Panicln(err)
-		}
-	}
-	return Logger
-}
-
 func onPanic(err *error) {
 	if x := recover(); x != nil {
 		switch v := x.(type) {
@@ -0,0 +1,538 @@
+package netfs
+
+import (
+	"container/list"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//缓存统计
+type CacheStats struct {
+	AttrHits      uint64
+	AttrMisses    uint64
+	NegativeHits  uint64
+	PageHits      uint64
+	PageMisses    uint64
+	Invalidations uint64
+	Evictions     uint64
+}
+
+//带属性缓存与数据页缓存的文件系统包装，一般用于 Client
+//属性缓存在 AttrTTL 内有效，不存在的路径在 NegativeTTL 内有效，
+//数据页以文件的修改时间和大小为版本，在 PageTTL 内有效，通过本对象进行的修改会立即使相关缓存失效
+//远端修改时间只精确到秒，其它客户端在同一秒内写入相同大小的内容时，最迟 PageTTL 后才能读到
+//未调用 Init 时各项为 0，不缓存任何内容
+type CacheFs struct {
+	Fs          FileSystem
+	AttrTTL     time.Duration
+	NegativeTTL time.Duration
+	MaxAttrs    int //属性缓存条数上限，超出时先清理过期的，仍超出则随机淘汰
+	PageSize    int //为 0 时不缓存数据页
+	PageTTL     time.Duration
+	MaxPages    int
+
+	mu    sync.Mutex
+	attrs map[cacheAttrKey]*cacheAttr
+	pages map[cachePageKey]*list.Element
+	paths map[string]*cachePath
+	lru   *list.List
+	stats CacheStats
+}
+
+//按路径索引缓存，失效时只需访问相关的路径
+type cachePath struct {
+	pages    map[cachePageKey]bool
+	children map[string]bool //有缓存的直接下级
+}
+
+type cacheAttrKey struct {
+	name  string
+	lstat bool
+}
+
+type cacheAttr struct {
+	fi     os.FileInfo
+	err    error
+	expire time.Time
+}
+
+type cachePageKey struct {
+	name    string
+	modtime int64
+	size    int64
+	index   int64
+}
+
+type cachePage struct {
+	key    cachePageKey
+	data   []byte
+	expire time.Time
+}
+
+func (c *CacheFs) Init(fs FileSystem) *CacheFs {
+	c.Fs = fs
+	c.AttrTTL = 3 * time.Second
+	c.NegativeTTL = 3 * time.Second
+	c.MaxAttrs = 4096
+	c.PageSize = 32 * 1024
+	c.PageTTL = 30 * time.Second
+	c.MaxPages = 2048
+	c.reset()
+	return c
+}
+
+func (c *CacheFs) reset() {
+	c.attrs = make(map[cacheAttrKey]*cacheAttr)
+	c.pages = make(map[cachePageKey]*list.Element)
+	c.paths = make(map[string]*cachePath)
+	c.lru = list.New()
+}
+
+//未调用 Init 时在首次使用时创建
+func (c *CacheFs) lock() {
+	c.mu.Lock()
+	if c.attrs == nil {
+		c.reset()
+	}
+}
+
+func (c *CacheFs) Stats() CacheStats {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+//清空所有缓存
+func (c *CacheFs) Purge() {
+	c.lock()
+	defer c.mu.Unlock()
+
+	c.reset()
+}
+
+func cacheClean(name string) string {
+	return path.Clean("/" + name)
+}
+
+//使路径本身、其下所有路径以及所有上级目录的缓存失效
+func (c *CacheFs) invalidate(names ...string) {
+	c.lock()
+	defer c.mu.Unlock()
+
+	for _, name := range names {
+		p := cacheClean(name)
+
+		c.removeTree(p)
+		for d := p; d != "/"; {
+			d = path.Dir(d)
+			delete(c.attrs, cacheAttrKey{d, false})
+			delete(c.attrs, cacheAttrKey{d, true})
+			c.release(d)
+		}
+
+		c.stats.Invalidations++
+	}
+}
+
+//取得路径的索引，不存在时创建并登记到上级目录，调用时需持有 c.mu
+func (c *CacheFs) index(name string) *cachePath {
+	e, ok := c.paths[name]
+	if ok {
+		return e
+	}
+	e = &cachePath{pages: make(map[cachePageKey]bool), children: make(map[string]bool)}
+	c.paths[name] = e
+
+	if name != "/" {
+		c.index(path.Dir(name)).children[name] = true
+	}
+	return e
+}
+
+//删除路径及其下所有路径的缓存，调用时需持有 c.mu
+func (c *CacheFs) removeTree(name string) {
+	e, ok := c.paths[name]
+	if !ok {
+		return
+	}
+	for child := range e.children {
+		c.removeTree(child)
+	}
+	for key := range e.pages {
+		c.lru.Remove(c.pages[key])
+		delete(c.pages, key)
+	}
+	delete(c.attrs, cacheAttrKey{name, false})
+	delete(c.attrs, cacheAttrKey{name, true})
+	delete(c.paths, name)
+
+	if name != "/" {
+		if parent, ok := c.paths[path.Dir(name)]; ok {
+			delete(parent.children, name)
+		}
+	}
+}
+
+//路径已没有任何缓存时删除其索引，并依次检查上级目录，调用时需持有 c.mu
+func (c *CacheFs) release(name string) {
+	for {
+		e, ok := c.paths[name]
+		if !ok || len(e.pages) > 0 || len(e.children) > 0 {
+			return
+		}
+		if _, ok := c.attrs[cacheAttrKey{name, false}]; ok {
+			return
+		}
+		if _, ok := c.attrs[cacheAttrKey{name, true}]; ok {
+			return
+		}
+		delete(c.paths, name)
+
+		if name == "/" {
+			return
+		}
+		child := name
+		name = path.Dir(name)
+		if parent, ok := c.paths[name]; ok {
+			delete(parent.children, child)
+		}
+	}
+}
+
+//调用时需持有 c.mu
+func (c *CacheFs) deleteAttr(key cacheAttrKey) {
+	delete(c.attrs, key)
+	c.release(key.name)
+}
+
+//调用时需持有 c.mu
+func (c *CacheFs) deletePage(e *list.Element) {
+	key := e.Value.(*cachePage).key
+	c.lru.Remove(e)
+	delete(c.pages, key)
+	if p, ok := c.paths[key.name]; ok {
+		delete(p.pages, key)
+	}
+	c.release(key.name)
+}
+
+func (c *CacheFs) stat(name string, lstat bool) (os.FileInfo, error) {
+	key := cacheAttrKey{cacheClean(name), lstat}
+	now := time.Now()
+
+	c.lock()
+	if a, ok := c.attrs[key]; ok && now.Before(a.expire) {
+		if a.err != nil {
+			c.stats.NegativeHits++
+		} else {
+			c.stats.AttrHits++
+		}
+		c.mu.Unlock()
+		return a.fi, a.err
+	}
+	c.stats.AttrMisses++
+	c.mu.Unlock()
+
+	var fi os.FileInfo
+	var err error
+	if lstat {
+		fi, err = c.Fs.Lstat(name)
+	} else {
+		fi, err = c.Fs.Stat(name)
+	}
+
+	ttl := c.AttrTTL
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return fi, err
+		}
+		ttl = c.NegativeTTL
+	}
+
+	if ttl > 0 && c.MaxAttrs > 0 {
+		c.lock()
+		if len(c.attrs) >= c.MaxAttrs {
+			c.sweep(now)
+		}
+		c.index(key.name)
+		c.attrs[key] = &cacheAttr{fi: fi, err: err, expire: now.Add(ttl)}
+		c.mu.Unlock()
+	}
+	return fi, err
+}
+
+//清理过期的属性缓存，仍超出上限时随机淘汰，调用时需持有 c.mu
+func (c *CacheFs) sweep(now time.Time) {
+	for key, a := range c.attrs {
+		if !now.Before(a.expire) {
+			c.deleteAttr(key)
+		}
+	}
+	for key := range c.attrs {
+		if len(c.attrs) < c.MaxAttrs {
+			break
+		}
+		c.deleteAttr(key)
+		c.stats.Evictions++
+	}
+}
+
+//读取数据页，fi 为文件当前的属性
+func (c *CacheFs) page(f File, name string, fi os.FileInfo, index int64) ([]byte, error) {
+	key := cachePageKey{name, fi.ModTime().UnixNano(), fi.Size(), index}
+	now := time.Now()
+
+	c.lock()
+	if e, ok := c.pages[key]; ok {
+		if p := e.Value.(*cachePage); now.Before(p.expire) {
+			c.lru.MoveToFront(e)
+			c.stats.PageHits++
+			c.mu.Unlock()
+			return p.data, nil
+		}
+		c.deletePage(e)
+	}
+	c.stats.PageMisses++
+	c.mu.Unlock()
+
+	b := make([]byte, c.PageSize)
+	n, err := f.ReadAt(b, index*int64(c.PageSize))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	b = b[:n]
+
+	c.lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.pages[key]; !ok && c.MaxPages > 0 && c.PageTTL > 0 {
+		c.pages[key] = c.lru.PushFront(&cachePage{key, b, now.Add(c.PageTTL)})
+		c.index(name).pages[key] = true
+
+		for c.lru.Len() > c.MaxPages {
+			c.deletePage(c.lru.Back())
+			c.stats.Evictions++
+		}
+	}
+	return b, nil
+}
+
+func (c *CacheFs) Chmod(name string, mode os.FileMode) error {
+	defer c.invalidate(name)
+	return c.Fs.Chmod(name, mode)
+}
+
+func (c *CacheFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	defer c.invalidate(name)
+	return c.Fs.Chtimes(name, atime, mtime)
+}
+
+func (c *CacheFs) Mkdir(name string, perm os.FileMode) error {
+	defer c.invalidate(name)
+	return c.Fs.Mkdir(name, perm)
+}
+
+func (c *CacheFs) MkdirAll(path string, perm os.FileMode) error {
+	defer c.invalidate(path)
+	return c.Fs.MkdirAll(path, perm)
+}
+
+func (c *CacheFs) Remove(name string) error {
+	defer c.invalidate(name)
+	return c.Fs.Remove(name)
+}
+
+func (c *CacheFs) RemoveAll(path string) error {
+	defer c.invalidate(path)
+	return c.Fs.RemoveAll(path)
+}
+
+func (c *CacheFs) Rename(oldpath, newpath string) error {
+	defer c.invalidate(oldpath, newpath)
+	return c.Fs.Rename(oldpath, newpath)
+}
+
+func (c *CacheFs) Truncate(name string, size int64) error {
+	defer c.invalidate(name)
+	return c.Fs.Truncate(name, size)
+}
+
+func (c *CacheFs) Create(name string) (file File, err error) {
+	defer c.invalidate(name)
+
+	file, err = c.Fs.Create(name)
+	if err != nil {
+		return nil, err
+	}
+	return &cacheFile{File: file, fs: c, name: cacheClean(name), write: true}, nil
+}
+
+func (c *CacheFs) Open(name string) (file File, err error) {
+	return c.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (c *CacheFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	write := isWriteFlag(flag)
+	if write {
+		defer c.invalidate(name)
+	}
+
+	if flag == os.O_RDONLY {
+		file, err = c.Fs.Open(name)
+	} else {
+		file, err = c.Fs.OpenFile(name, flag, perm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f := &cacheFile{File: file, fs: c, name: cacheClean(name), write: write}
+
+	if !write {
+		fi, err := c.stat(name, false)
+		f.cached = err == nil && fi.Mode().IsRegular() && c.PageSize > 0
+	}
+	return f, nil
+}
+
+func (c *CacheFs) Stat(name string) (fi os.FileInfo, err error) {
+	return c.stat(name, false)
+}
+
+func (c *CacheFs) Lstat(name string) (fi os.FileInfo, err error) {
+	return c.stat(name, true)
+}
+
+//只读打开的普通文件通过数据页缓存读取，偏移量在本地维护
+type cacheFile struct {
+	File
+	fs     *CacheFs
+	name   string
+	write  bool
+	cached bool
+	off    int64
+}
+
+func (f *cacheFile) Chmod(mode os.FileMode) error {
+	defer f.fs.invalidate(f.name)
+	return f.File.Chmod(mode)
+}
+
+func (f *cacheFile) Close() error {
+	if f.write {
+		defer f.fs.invalidate(f.name)
+	}
+	return f.File.Close()
+}
+
+func (f *cacheFile) Read(b []byte) (n int, err error) {
+	if !f.cached {
+		return f.File.Read(b)
+	}
+
+	n, err = f.ReadAt(b, f.off)
+	f.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return
+}
+
+func (f *cacheFile) ReadAt(b []byte, off int64) (n int, err error) {
+	if !f.cached {
+		return f.File.ReadAt(b, off)
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	fi, err := f.fs.stat(f.name, false)
+	if err != nil {
+		return 0, err
+	}
+
+	size := int64(f.fs.PageSize)
+
+	for n < len(b) && off+int64(n) < fi.Size() {
+		pos := off + int64(n)
+
+		data, err := f.fs.page(f.File, f.name, fi, pos/size)
+		if err != nil {
+			return n, err
+		}
+
+		start := int(pos % size)
+		if start >= len(data) {
+			break
+		}
+		n += copy(b[n:], data[start:])
+	}
+
+	if n < len(b) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (f *cacheFile) Seek(offset int64, whence int) (ret int64, err error) {
+	if !f.cached {
+		return f.File.Seek(offset, whence)
+	}
+
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = f.off + offset
+	case io.SeekEnd:
+		fi, err := f.fs.stat(f.name, false)
+		if err != nil {
+			return 0, err
+		}
+		ret = fi.Size() + offset
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if ret < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	f.off = ret
+	return ret, nil
+}
+
+func (f *cacheFile) Truncate(size int64) error {
+	defer f.fs.invalidate(f.name)
+	return f.File.Truncate(size)
+}
+
+func (f *cacheFile) Write(b []byte) (n int, err error) {
+	defer f.fs.invalidate(f.name)
+	return f.File.Write(b)
+}
+
+func (f *cacheFile) WriteAt(b []byte, off int64) (n int, err error) {
+	defer f.fs.invalidate(f.name)
+	return f.File.WriteAt(b, off)
+}
+
+func (f *cacheFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *cacheFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *cacheFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *cacheFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
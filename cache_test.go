@@ -0,0 +1,200 @@
+package netfs
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+type countFs struct {
+	FileSystem
+	stats int
+}
+
+func (c *countFs) Stat(name string) (os.FileInfo, error) {
+	c.stats++
+	return c.FileSystem.Stat(name)
+}
+
+func Test_CacheFs(t *testing.T) {
+	mem := test_mem_fs(t, "a.txt")
+	count := &countFs{FileSystem: mem}
+
+	fs := new(CacheFs).Init(count)
+	fs.PageSize = 4
+
+	for i := 0; i < 3; i++ {
+		if _, err := fs.Stat("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.Stat("b.txt"); !os.IsNotExist(err) {
+			t.Errorf("Stat expect:not exist, get:%v", err)
+		}
+	}
+
+	if count.stats != 2 {
+		t.Errorf("Stat calls expect:2, get:%d", count.stats)
+	}
+
+	st := fs.Stats()
+	if st.AttrHits != 2 || st.NegativeHits != 2 || st.AttrMisses != 2 {
+		t.Errorf("Stats expect:2/2/2, get:%+v", st)
+	}
+
+	//写入后负缓存失效
+	f, err := fs.Create("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("hello world")
+	f.Close()
+
+	if _, err := fs.Stat("b.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if s := test_read_file(fs, "b.txt"); s != "hello world" {
+			t.Errorf("Read expect:hello world, get:%s", s)
+		}
+	}
+
+	st = fs.Stats()
+	if st.PageMisses != 3 || st.PageHits != 3 {
+		t.Errorf("Page stats expect:3/3, get:%+v", st)
+	}
+
+	f, err = fs.OpenFile("b.txt", os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteAt([]byte("W"), 6)
+	f.Close()
+
+	f, err = fs.Open("b.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Seek(6, io.SeekStart)
+	b, err := ioutil.ReadAll(f)
+	if err != nil || string(b) != "World" {
+		t.Errorf("Read expect:World, get:%s %v", b, err)
+	}
+}
+
+func Test_CacheFs_Expire(t *testing.T) {
+	mem := test_mem_fs(t, "a.txt", "b.txt", "c.txt")
+
+	fs := new(CacheFs).Init(mem)
+	fs.MaxAttrs = 2
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt", "d.txt"} {
+		fs.Stat(name)
+	}
+
+	fs.mu.Lock()
+	n := len(fs.attrs)
+	fs.mu.Unlock()
+	if n != 2 {
+		t.Errorf("Attrs expect:2, get:%d", n)
+	}
+	if st := fs.Stats(); st.Evictions != 2 {
+		t.Errorf("Evictions expect:2, get:%d", st.Evictions)
+	}
+
+	//同一秒内写入相同大小的内容，数据页过期后重新读取
+	fs = new(CacheFs).Init(mem)
+	fs.AttrTTL = 0
+	fs.PageTTL = 50 * time.Millisecond
+
+	if s := test_read_file(fs, "a.txt"); s != "a.txt" {
+		t.Errorf("Read expect:a.txt, get:%s", s)
+	}
+
+	fi, _ := mem.Stat("a.txt")
+	test_write_file(t, mem, "a.txt", "A.TXT")
+	mem.Chtimes("a.txt", fi.ModTime(), fi.ModTime())
+
+	if s := test_read_file(fs, "a.txt"); s != "a.txt" {
+		t.Errorf("Read expect:a.txt (cached), get:%s", s)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if s := test_read_file(fs, "a.txt"); s != "A.TXT" {
+		t.Errorf("Read expect:A.TXT, get:%s", s)
+	}
+}
+
+func test_cache_paths(fs *CacheFs) string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	var list []string
+	for name := range fs.paths {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func Test_CacheFs_Index(t *testing.T) {
+	fs := new(CacheFs).Init(test_mem_fs(t, "a/", "a/b/", "a/b/c.txt", "a/d.txt", "e.txt"))
+	fs.PageSize = 4
+
+	for _, name := range []string{"a", "a/b", "a/b/c.txt", "a/d.txt", "e.txt"} {
+		fs.Stat(name)
+	}
+	test_read_file(fs, "a/b/c.txt")
+
+	if s := test_cache_paths(fs); s != "/,/a,/a/b,/a/b/c.txt,/a/d.txt,/e.txt" {
+		t.Errorf("Paths expect:/,/a,/a/b,/a/b/c.txt,/a/d.txt,/e.txt, get:%s", s)
+	}
+
+	//子目录及其下所有路径失效，上级目录的属性失效
+	fs.invalidate("a/b")
+	if s := test_cache_paths(fs); s != "/,/a,/a/d.txt,/e.txt" {
+		t.Errorf("Paths expect:/,/a,/a/d.txt,/e.txt, get:%s", s)
+	}
+	if n := len(fs.pages); n != 0 {
+		t.Errorf("Pages expect:0, get:%d", n)
+	}
+	if _, ok := fs.attrs[cacheAttrKey{"/a", false}]; ok {
+		t.Errorf("Attr /a expect:false, get:true")
+	}
+	if _, ok := fs.attrs[cacheAttrKey{"/a/d.txt", false}]; !ok {
+		t.Errorf("Attr /a/d.txt expect:true, get:false")
+	}
+
+	fs.invalidate("a/d.txt", "e.txt")
+	if s := test_cache_paths(fs); s != "" {
+		t.Errorf("Paths expect:, get:%s", s)
+	}
+}
+
+//未调用 Init 时不缓存，只转发
+func Test_CacheFs_Zero(t *testing.T) {
+	mem := test_mem_fs(t, "a.txt")
+	fs := &CacheFs{Fs: mem}
+
+	if s := test_read_file(fs, "a.txt"); s != "a.txt" {
+		t.Errorf("Read expect:a.txt, get:%s", s)
+	}
+	if _, err := fs.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+	if err := fs.Remove("a.txt"); err != nil {
+		t.Errorf("Remove expect:nil, get:%v", err)
+	}
+	if _, err := fs.Stat("a.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+	if st := fs.Stats(); st.AttrHits != 0 || st.PageMisses != 0 {
+		t.Errorf("Stats expect:0/0, get:%+v", st)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"errors"
 	"time"
+	"syscall"
 )
 
 var test_client *Client
@@ -542,7 +543,7 @@ func Test_f_Write(t *testing.T) {
 	}
 
 	if n != test_file.n {
-		t.Errorf("Write expect:%n, get:%n", test_file.n, n)
+		t.Errorf("Write expect:%d, get:%d", test_file.n, n)
 	}
 }
 
@@ -565,7 +566,7 @@ func Test_f_WriteAt(t *testing.T) {
 	}
 
 	if n != test_file.n {
-		t.Errorf("WriteAt expect:%n, get:%n", test_file.n, n)
+		t.Errorf("WriteAt expect:%d, get:%d", test_file.n, n)
 	}
 }
 
@@ -585,6 +586,28 @@ func Test_f_Close(t *testing.T) {
 	}
 }
 
+func Test_ErrorKind(t *testing.T) {
+	test_fs.t = t
+	test_fs.name = "test_n"
+	test_fs.err = &os.PathError{Op: "stat", Path: "test_n", Err: os.ErrNotExist}
+
+	_, err := test_client.Stat(test_fs.name)
+
+	if !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+
+	test_fs.oldpath = "test_o"
+	test_fs.newpath = "test_p"
+	test_fs.err = &os.LinkError{Op: "rename", Old: "test_o", New: "test_p", Err: syscall.EXDEV}
+
+	err = test_client.Rename(test_fs.oldpath, test_fs.newpath)
+
+	if e, ok := err.(*os.LinkError); !ok || e.Err != syscall.EXDEV || err.Error() != test_fs.err.Error() {
+		t.Errorf("Rename err expect:%v, get:%v", test_fs.err, err)
+	}
+}
+
 func Test_Close(t *testing.T) {
 	err := test_client.Close()
 
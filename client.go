@@ -1,32 +1,131 @@
 package netfs
 
 import (
+	"crypto/tls"
 	"net"
+	"time"
 )
 
 func Dial(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
+	dial := func() (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	}
+	return dialClient(dial)
+}
+
+func DialTLS(addr string, config *tls.Config) (*Client, error) {
+	dial := func() (net.Conn, error) {
+		return tls.Dial("tcp", addr, config)
+	}
+	return dialClient(dial)
+}
+
+func dialClient(dial func() (net.Conn, error)) (*Client, error) {
+	conn, err := dial()
 	if err != nil {
 		return nil, err
 	}
 
-	return new(Client).Init(conn, 4096, 4096)
+	c, err := new(Client).Init(conn, 4096, 4096)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	c.dial = dial
+	return c, nil
 }
 
 type Client struct {
 	conn
+	principal string
+	secret string
+	share string
+
+	//建立新连接，redial 时使用
+	dial func() (net.Conn, error)
+
+	//运行指标，为 nil 时不统计
+	Metrics Metrics
+	op uint8
+	start time.Time
 }
 
 func (c *Client) Init(conn net.Conn, rBuf, wBuf int) (*Client, error) {
 	c.init(conn, rBuf, wBuf)
+	c.Metrics = DefaultMetrics
 
 	if err := c.LinkInit(); err != nil {
+		if c.Metrics != nil {
+			c.Metrics.HandshakeFailed("client")
+		}
 		return nil, err
 	}
 
 	return c, nil
 }
 
+func (c *Client) doRequest(code uint8) {
+	c.op, c.start = code, time.Now()
+	c.conn.doRequest(code)
+}
+
+//响应以错误结尾，读到错误即请求完成
+func (c *Client) readError() error {
+	err := c.conn.readError()
+	if c.Metrics != nil && !c.start.IsZero() {
+		c.Metrics.Request("client", c.op, time.Since(c.start), err)
+		c.start = time.Time{}
+	}
+	return err
+}
+
+func (c *Client) transfer(read, written int) {
+	if c.Metrics != nil {
+		c.Metrics.Transfer("client", int64(read), int64(written))
+	}
+}
+
+//建立到同一服务端的新连接，并恢复认证与共享目录
+func (c *Client) redial() (nc *conn, err error) {
+	dial := c.dial
+	if dial == nil {
+		addr := c.conn.conn.RemoteAddr()
+		dial = func() (net.Conn, error) {
+			return net.Dial(addr.Network(), addr.String())
+		}
+	}
+
+	raw, err := dial()
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Client)
+	s.init(raw, 4096, 4096)
+
+	defer func() {
+		if err != nil {
+			raw.Close()
+		}
+	}()
+
+	if err = s.LinkInit(); err != nil {
+		return nil, err
+	}
+	if c.principal != "" {
+		if err = s.Auth(c.principal, c.secret); err != nil {
+			return nil, err
+		}
+	}
+	if c.share != "" {
+		if err = s.selectShare(c.share); err != nil {
+			return nil, err
+		}
+	}
+
+	return &s.conn, nil
+}
+
 func (c *Client) Ping() (err error) {
 	defer onPanic(&err)
 	c.doRequest(LINK_PING)
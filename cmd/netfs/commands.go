@@ -0,0 +1,331 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"syscall"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+type command func(a *app, args []string) error
+
+var commands map[string]command
+
+func init() {
+	commands = map[string]command{
+		"ls":    cmdLs,
+		"stat":  cmdStat,
+		"cat":   cmdCat,
+		"get":   cmdGet,
+		"put":   cmdPut,
+		"cp":    cmdCp,
+		"mv":    cmdMv,
+		"rm":    cmdRm,
+		"mkdir": cmdMkdir,
+		"chmod": cmdChmod,
+		"touch": cmdTouch,
+		"ping":  cmdPing,
+		"sh":    cmdSh,
+	}
+}
+
+//子命令参数，出错时不退出进程
+func flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+func parse(fs *flag.FlagSet, args []string, min int) ([]string, error) {
+	if err := fs.Parse(args); err != nil || fs.NArg() < min {
+		return nil, errUsage
+	}
+	return fs.Args(), nil
+}
+
+//已输出过的错误
+type reported struct {
+	error
+}
+
+//依次处理每个目标，逐个输出错误并返回最后一个
+func (a *app) each(args []string, fn func(t *target) error) error {
+	var last error
+	for _, s := range args {
+		t, err := a.target(s)
+		if err == nil {
+			err = fn(t)
+		}
+		if err != nil {
+			fmt.Fprintln(a.errOut, "netfs:", err)
+			last = reported{err}
+		}
+	}
+	return last
+}
+
+func formatInfo(fi os.FileInfo) string {
+	return fmt.Sprintf("%s %12d %s %s", fi.Mode(), fi.Size(), fi.ModTime().Format("2006-01-02 15:04"), fi.Name())
+}
+
+func cmdLs(a *app, args []string) error {
+	fs := flags("ls")
+	long := fs.Bool("l", false, "long format")
+	args, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.each(args, func(t *target) error {
+		fi, err := t.fs.Stat(t.path)
+		if err != nil {
+			return err
+		}
+
+		fis := []os.FileInfo{fi}
+		if fi.IsDir() {
+			if fis, err = readdir(t); err != nil {
+				return err
+			}
+		}
+
+		if len(args) > 1 {
+			fmt.Fprintf(a.out, "%s:\n", t)
+		}
+		for _, fi := range fis {
+			if *long {
+				fmt.Fprintln(a.out, formatInfo(fi))
+			} else {
+				fmt.Fprintln(a.out, fi.Name())
+			}
+		}
+		return nil
+	})
+}
+
+//按名称排序的目录内容
+func readdir(t *target) ([]os.FileInfo, error) {
+	f, err := t.fs.Open(t.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fis, err := f.Readdir(-1)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	sort.Slice(fis, func(i, j int) bool {
+		return fis[i].Name() < fis[j].Name()
+	})
+	return fis, nil
+}
+
+func cmdStat(a *app, args []string) error {
+	args, err := parse(flags("stat"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.each(args, func(t *target) error {
+		fi, err := t.fs.Stat(t.path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "  File: %s\n  Size: %d\n  Mode: %s (%04o)\nModify: %s\n",
+			t, fi.Size(), fi.Mode(), fi.Mode().Perm(), fi.ModTime().Format(time.RFC3339))
+		return nil
+	})
+}
+
+func cmdCat(a *app, args []string) error {
+	args, err := parse(flags("cat"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.each(args, func(t *target) error {
+		f, err := t.fs.Open(t.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(a.out, f)
+		return err
+	})
+}
+
+func cmdGet(a *app, args []string) error {
+	return a.transfer("get", args, true, false)
+}
+
+func cmdPut(a *app, args []string) error {
+	return a.transfer("put", args, false, true)
+}
+
+func cmdCp(a *app, args []string) error {
+	return a.transfer("cp", args, false, false)
+}
+
+//srcRemote/dstRemote 为 true 时要求对应一侧为远程目标
+func (a *app) transfer(name string, args []string, srcRemote, dstRemote bool) error {
+	fs := flags(name)
+	recursive := fs.Bool("r", false, "copy directories recursively")
+	args, err := parse(fs, args, 2)
+	if err != nil || len(args) != 2 {
+		return errUsage
+	}
+
+	src, err := a.target(args[0])
+	if err != nil {
+		return err
+	}
+	dst, err := a.target(args[1])
+	if err != nil {
+		return err
+	}
+
+	if (srcRemote && !src.remote()) || (dstRemote && !dst.remote()) {
+		return errUsage
+	}
+
+	return a.copy(src, dst, *recursive)
+}
+
+func cmdMv(a *app, args []string) error {
+	args, err := parse(flags("mv"), args, 2)
+	if err != nil || len(args) != 2 {
+		return errUsage
+	}
+
+	src, err := a.target(args[0])
+	if err != nil {
+		return err
+	}
+	dst, err := a.target(args[1])
+	if err != nil {
+		return err
+	}
+
+	if src.addr != dst.addr {
+		return &os.LinkError{Op: "rename", Old: src.String(), New: dst.String(), Err: syscall.EXDEV}
+	}
+
+	//移动到已有目录中
+	if fi, err := dst.fs.Stat(dst.path); err == nil && fi.IsDir() {
+		dst = dst.join(baseName(src.path))
+	}
+	return src.fs.Rename(src.path, dst.path)
+}
+
+func cmdRm(a *app, args []string) error {
+	fs := flags("rm")
+	recursive := fs.Bool("r", false, "remove directories and their contents")
+	args, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.each(args, func(t *target) error {
+		if *recursive {
+			//RemoveAll 对不存在的路径不报错
+			if _, err := t.fs.Lstat(t.path); err != nil {
+				return err
+			}
+			return t.fs.RemoveAll(t.path)
+		}
+		return t.fs.Remove(t.path)
+	})
+}
+
+func cmdMkdir(a *app, args []string) error {
+	fs := flags("mkdir")
+	parents := fs.Bool("p", false, "create parent directories as needed")
+	args, err := parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.each(args, func(t *target) error {
+		if *parents {
+			return t.fs.MkdirAll(t.path, 0755)
+		}
+		return t.fs.Mkdir(t.path, 0755)
+	})
+}
+
+func cmdChmod(a *app, args []string) error {
+	args, err := parse(flags("chmod"), args, 2)
+	if err != nil {
+		return err
+	}
+
+	mode, err := strconv.ParseUint(args[0], 8, 32)
+	if err != nil {
+		return errUsage
+	}
+
+	return a.each(args[1:], func(t *target) error {
+		return t.fs.Chmod(t.path, os.FileMode(mode))
+	})
+}
+
+func cmdTouch(a *app, args []string) error {
+	args, err := parse(flags("touch"), args, 1)
+	if err != nil {
+		return err
+	}
+
+	return a.each(args, func(t *target) error {
+		_, err := t.fs.Stat(t.path)
+		if os.IsNotExist(err) {
+			f, err := t.fs.OpenFile(t.path, os.O_WRONLY|os.O_CREATE, 0644)
+			if err != nil {
+				return err
+			}
+			return f.Close()
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return t.fs.Chtimes(t.path, now, now)
+	})
+}
+
+func cmdPing(a *app, args []string) error {
+	fs := flags("ping")
+	count := fs.Int("c", 4, "number of pings")
+	args, err := parse(fs, args, 1)
+	if err != nil || len(args) != 1 {
+		return errUsage
+	}
+
+	t, err := a.target(args[0])
+	if err != nil {
+		return err
+	}
+	c, ok := t.fs.(*netfs.Client)
+	if !ok {
+		return errUsage
+	}
+
+	for i := 1; i <= *count; i++ {
+		start := time.Now()
+		if err := c.Ping(); err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "%s: seq=%d time=%v\n", t.addr, i, time.Since(start))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+//运行一条命令，返回标准输出
+func test_run(t *testing.T, name string, args ...string) (string, error) {
+	var out, errOut bytes.Buffer
+	a := newApp(&out, &errOut)
+	a.quiet = true
+	defer a.close()
+
+	err := a.run(name, args)
+	return out.String(), err
+}
+
+func Test_Commands(t *testing.T) {
+	fs := new(netfs.MemFs).Init()
+	go netfs.Listen("127.0.0.1:11146", fs)
+	time.Sleep(100 * time.Millisecond)
+
+	dir, err := ioutil.TempDir("", "netfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := func(name string) string {
+		return filepath.Join(dir, name)
+	}
+	remote := func(name string) string {
+		return "127.0.0.1:11146" + name
+	}
+
+	os.MkdirAll(local("src/sub"), 0755)
+	ioutil.WriteFile(local("src/a.txt"), []byte("a"), 0644)
+	ioutil.WriteFile(local("src/sub/b.txt"), []byte("b"), 0644)
+
+	//put 单个文件与目录
+	if _, err := test_run(t, "put", local("src/a.txt"), remote("/a.txt")); err != nil {
+		t.Errorf("put expect:nil, get:%v", err)
+	}
+	if _, err := test_run(t, "put", "-r", local("src"), remote("/")); err != nil {
+		t.Errorf("put -r expect:nil, get:%v", err)
+	}
+	if _, err := test_run(t, "put", local("src"), remote("/")); exitCode(err) != EXIT_ERROR {
+		t.Errorf("put dir expect:%d, get:%v", EXIT_ERROR, err)
+	}
+
+	//ls
+	if out, err := test_run(t, "ls", remote("/")); err != nil || out != "a.txt\nsrc\n" {
+		t.Errorf("ls expect:a.txt src, get:%q %v", out, err)
+	}
+	if out, err := test_run(t, "ls", remote("/src")); err != nil || out != "a.txt\nsub\n" {
+		t.Errorf("ls expect:a.txt sub, get:%q %v", out, err)
+	}
+	if _, err := test_run(t, "ls", remote("/none")); exitCode(err) != EXIT_NOT_EXIST {
+		t.Errorf("ls expect:%d, get:%v", EXIT_NOT_EXIST, err)
+	}
+
+	//get 单个文件与目录
+	if _, err := test_run(t, "get", remote("/src/sub/b.txt"), local("b.txt")); err != nil {
+		t.Errorf("get expect:nil, get:%v", err)
+	}
+	if b, _ := ioutil.ReadFile(local("b.txt")); string(b) != "b" {
+		t.Errorf("get expect:b, get:%s", b)
+	}
+	if _, err := test_run(t, "get", "-r", remote("/src"), local("dst")); err != nil {
+		t.Errorf("get -r expect:nil, get:%v", err)
+	}
+	if b, _ := ioutil.ReadFile(local("dst/sub/b.txt")); string(b) != "b" {
+		t.Errorf("get -r expect:b, get:%s", b)
+	}
+
+	//服务端内的 cp -r
+	if _, err := test_run(t, "cp", "-r", remote("/src"), remote("/copy")); err != nil {
+		t.Errorf("cp -r expect:nil, get:%v", err)
+	}
+	if out, err := test_run(t, "cat", remote("/copy/sub/b.txt")); err != nil || out != "b" {
+		t.Errorf("cp -r expect:b, get:%q %v", out, err)
+	}
+
+	//复制到自身不能截断源文件
+	for _, args := range [][]string{
+		{remote("/a.txt"), remote("/a.txt")},
+		{remote("/a.txt"), remote("/")},
+		{local("src/a.txt"), local("src/../src/a.txt")},
+	} {
+		if _, err := test_run(t, "cp", args...); err == nil {
+			t.Errorf("cp %v expect:error, get:nil", args)
+		}
+	}
+	if out, _ := test_run(t, "cat", remote("/a.txt")); out != "a" {
+		t.Errorf("cat expect:a, get:%q", out)
+	}
+	if b, _ := ioutil.ReadFile(local("src/a.txt")); string(b) != "a" {
+		t.Errorf("read expect:a, get:%s", b)
+	}
+
+	//复制目录到其子目录不能无限递归
+	for _, args := range [][]string{
+		{"-r", remote("/src"), remote("/src/sub")},
+		{"-r", local("src"), local("src/sub/x")},
+	} {
+		if _, err := test_run(t, "cp", args...); err == nil || !strings.Contains(err.Error(), "into itself") {
+			t.Errorf("cp %v expect:into itself, get:%v", args, err)
+		}
+	}
+	if out, _ := test_run(t, "ls", remote("/src/sub")); out != "b.txt\n" {
+		t.Errorf("ls expect:b.txt, get:%q", out)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+func baseName(name string) string {
+	return path.Base(strings.TrimRight(name, "/"))
+}
+
+//复制文件或目录，dst 为已有目录时复制到其中
+func (a *app) copy(src, dst *target, recursive bool) error {
+	fi, err := src.fs.Stat(src.path)
+	if err != nil {
+		return err
+	}
+
+	dfi, err := dst.fs.Stat(dst.path)
+	if err == nil && dfi.IsDir() {
+		dst = dst.join(baseName(src.path))
+		dfi, err = dst.fs.Stat(dst.path)
+	}
+
+	//打开前检查，否则截断 dst 即截断了 src，或者无限递归
+	if src.same(dst) || err == nil && os.SameFile(fi, dfi) {
+		return fmt.Errorf("%s and %s are the same file", src, dst)
+	}
+
+	if fi.IsDir() {
+		if !recursive {
+			return &os.PathError{Op: "copy", Path: src.String(), Err: syscall.EISDIR}
+		}
+		if src.contains(dst) {
+			return fmt.Errorf("cannot copy %s into itself, %s", src, dst)
+		}
+		return a.copyDir(src, dst, fi)
+	}
+	return a.copyFile(src, dst, fi)
+}
+
+func (a *app) copyDir(src, dst *target, fi os.FileInfo) error {
+	if err := dst.fs.Mkdir(dst.path, fi.Mode().Perm()); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	fis, err := readdir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range fis {
+		s, d := src.join(fi.Name()), dst.join(fi.Name())
+		if fi.IsDir() {
+			err = a.copyDir(s, d, fi)
+		} else if fi.Mode().IsRegular() {
+			err = a.copyFile(s, d, fi)
+		} else {
+			fmt.Fprintln(a.errOut, "netfs: skipping", s)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *app) copyFile(src, dst *target, fi os.FileInfo) error {
+	in, err := src.fs.Open(src.path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := dst.fs.OpenFile(dst.path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	p := a.progress(dst.String(), fi.Size())
+	_, err = io.Copy(io.MultiWriter(out, p), in)
+	p.done()
+
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ----- 进度 -----
+
+//在 errOut 上输出传输进度，每 200ms 最多刷新一次
+type progress struct {
+	a     *app
+	name  string
+	total int64
+	n     int64
+	last  time.Time
+}
+
+func (a *app) progress(name string, total int64) *progress {
+	return &progress{a: a, name: name, total: total, last: time.Now()}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.n += int64(len(b))
+	if time.Since(p.last) >= 200*time.Millisecond {
+		p.print("\r")
+		p.last = time.Now()
+	}
+	return len(b), nil
+}
+
+func (p *progress) done() {
+	p.print("\r")
+	if !p.a.quiet {
+		fmt.Fprintln(p.a.errOut)
+	}
+}
+
+func (p *progress) print(prefix string) {
+	if p.a.quiet {
+		return
+	}
+
+	percent := 100
+	if p.total > 0 {
+		percent = int(p.n * 100 / p.total)
+	}
+	fmt.Fprintf(p.a.errOut, "%s%s %s/%s %3d%%", prefix, p.name, formatBytes(p.n), formatBytes(p.total), percent)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+//交互式行编辑，支持历史记录、常用快捷键与 Tab 补全
+//输入不是终端时退化为按行读取
+type lineReader struct {
+	in      *os.File
+	out     io.Writer
+	r       *bufio.Reader
+	history []string
+
+	//补全光标前的内容，返回替换后的内容与候选项
+	complete func(line string) (string, []string)
+}
+
+func newLineReader(in *os.File, out io.Writer) *lineReader {
+	return &lineReader{in: in, out: out, r: bufio.NewReader(in)}
+}
+
+func (l *lineReader) readLine(prompt string) (string, error) {
+	restore, err := makeRaw(int(l.in.Fd()))
+	if err != nil {
+		fmt.Fprint(l.out, prompt)
+		line, err := l.r.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	return l.edit(prompt)
+}
+
+//读取一个按键，方向键等转义序列返回为 "\x1b[A" 形式
+func (l *lineReader) readKey() (string, error) {
+	r, _, err := l.r.ReadRune()
+	if err != nil {
+		return "", err
+	}
+	if r != 0x1b {
+		return string(r), nil
+	}
+
+	key := "\x1b"
+	for l.r.Buffered() > 0 {
+		r, _, err := l.r.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		key += string(r)
+		if len(key) > 2 && (r == '~' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			break
+		}
+	}
+	return key, nil
+}
+
+func (l *lineReader) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	hist := len(l.history)
+
+	redraw := func() {
+		fmt.Fprintf(l.out, "\r%s%s\x1b[K", prompt, string(buf))
+		if n := len(buf) - pos; n > 0 {
+			fmt.Fprintf(l.out, "\x1b[%dD", n)
+		}
+	}
+	set := func(s string) {
+		buf = []rune(s)
+		pos = len(buf)
+	}
+
+	redraw()
+	for {
+		key, err := l.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case "\r", "\n":
+			fmt.Fprint(l.out, "\r\n")
+			line := string(buf)
+			if strings.TrimSpace(line) != "" {
+				l.history = append(l.history, line)
+			}
+			return line, nil
+		case "\x03": //Ctrl-C 放弃当前行
+			fmt.Fprint(l.out, "^C\r\n")
+			return "", nil
+		case "\x04": //Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(l.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case "\x7f", "\x08":
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case "\x1b[3~":
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case "\x01", "\x1b[H", "\x1bOH":
+			pos = 0
+		case "\x05", "\x1b[F", "\x1bOF":
+			pos = len(buf)
+		case "\x1b[D", "\x02":
+			if pos > 0 {
+				pos--
+			}
+		case "\x1b[C", "\x06":
+			if pos < len(buf) {
+				pos++
+			}
+		case "\x15": //Ctrl-U
+			buf = buf[pos:]
+			pos = 0
+		case "\x0b": //Ctrl-K
+			buf = buf[:pos]
+		case "\x17": //Ctrl-W 删除前一个词
+			i := pos
+			for i > 0 && buf[i-1] == ' ' {
+				i--
+			}
+			for i > 0 && buf[i-1] != ' ' {
+				i--
+			}
+			buf = append(buf[:i], buf[pos:]...)
+			pos = i
+		case "\x1b[A", "\x10":
+			if hist > 0 {
+				hist--
+				set(l.history[hist])
+			}
+		case "\x1b[B", "\x0e":
+			if hist < len(l.history)-1 {
+				hist++
+				set(l.history[hist])
+			} else {
+				hist = len(l.history)
+				set("")
+			}
+		case "\t":
+			if l.complete == nil {
+				break
+			}
+			head, tail := string(buf[:pos]), string(buf[pos:])
+			s, candidates := l.complete(head)
+			if s == head && len(candidates) > 1 {
+				fmt.Fprint(l.out, "\r\n"+columns(candidates, 80)+"\r\n")
+			}
+			buf = []rune(s + tail)
+			pos = len([]rune(s))
+		default:
+			r := []rune(key)
+			if len(r) == 1 && r[0] >= 0x20 {
+				buf = append(buf[:pos], append(r, buf[pos:]...)...)
+				pos++
+			}
+		}
+		redraw()
+	}
+}
+
+//按列排列候选项
+func columns(items []string, width int) string {
+	w := 0
+	for _, s := range items {
+		if len(s) > w {
+			w = len(s)
+		}
+	}
+	w += 2
+
+	n := width / w
+	if n < 1 {
+		n = 1
+	}
+
+	var b strings.Builder
+	for i, s := range items {
+		if i > 0 && i%n == 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(s + strings.Repeat(" ", w-len(s)))
+	}
+	return strings.TrimRight(b.String(), " ")
+}
@@ -0,0 +1,186 @@
+// netfs 命令行客户端
+//
+//	netfs [-u principal] [-p secret] [-share name] [-tls] [-ca file] [-q] <command> [args...]
+//
+// 远程目标写作 host:port[/path]，本地路径不含冒号或以 ./ / 开头。
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"syscall"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+//退出码
+const (
+	EXIT_OK = iota
+	EXIT_ERROR
+	EXIT_USAGE
+	EXIT_NOT_EXIST
+	EXIT_PERMISSION
+	EXIT_EXIST
+	EXIT_NO_SPACE
+	EXIT_NETWORK
+)
+
+var errUsage = errors.New("usage")
+
+func exitCode(err error) int {
+	if r, ok := err.(reported); ok {
+		err = r.error
+	}
+
+	switch {
+	case err == nil:
+		return EXIT_OK
+	case err == errUsage:
+		return EXIT_USAGE
+	case os.IsNotExist(err):
+		return EXIT_NOT_EXIST
+	case os.IsPermission(err) || isErrno(err, syscall.EROFS):
+		return EXIT_PERMISSION
+	case isErrno(err, syscall.ENOTEMPTY):
+		return EXIT_ERROR
+	case os.IsExist(err):
+		return EXIT_EXIST
+	case isErrno(err, syscall.ENOSPC) || isErrno(err, syscall.EDQUOT):
+		return EXIT_NO_SPACE
+	}
+
+	switch err.(type) {
+	case netfs.IO_Error, netfs.Data_Error, net.Error:
+		return EXIT_NETWORK
+	}
+	return EXIT_ERROR
+}
+
+func isErrno(err error, errno syscall.Errno) bool {
+	switch e := err.(type) {
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	return err == errno
+}
+
+func usage() {
+	fmt.Fprint(os.Stderr, `usage: netfs [-u principal] [-p secret] [-share name] [-tls] [-ca file] [-q] <command> [args...]
+
+commands:
+  ls [-l] target...          list directories
+  stat target...             show file information
+  cat target...              print files
+  get [-r] remote local      download
+  put [-r] local remote      upload
+  cp [-r] src dst            copy, either side may be local or remote
+  mv src dst                 rename on the same server
+  rm [-r] target...          remove
+  mkdir [-p] target...       create directories
+  chmod mode target...       change mode (octal)
+  touch target...            create files or update their times
+  ping host:port             measure round trip time
+  sh host:port[/path]        interactive shell
+
+remote targets are host:port[/path]; the secret may also be set in NETFS_SECRET.
+`)
+}
+
+func main() {
+	a := newApp(os.Stdout, os.Stderr)
+
+	flag.StringVar(&a.principal, "u", "", "principal to authenticate as")
+	flag.StringVar(&a.secret, "p", os.Getenv("NETFS_SECRET"), "secret for -u")
+	flag.StringVar(&a.share, "share", "", "share to select after connecting")
+	flag.BoolVar(&a.quiet, "q", false, "no progress output")
+	useTLS := flag.Bool("tls", false, "connect with TLS")
+	ca := flag.String("ca", "", "CA certificates for -tls (PEM)")
+	flag.Usage = usage
+	flag.Parse()
+
+	if *useTLS || *ca != "" {
+		tc, err := tlsConfig(*ca)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "netfs:", err)
+			os.Exit(EXIT_USAGE)
+		}
+		a.tls = tc
+	}
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(EXIT_USAGE)
+	}
+
+	err := a.run(flag.Arg(0), flag.Args()[1:])
+	a.close()
+
+	if err == errUsage {
+		usage()
+	} else if _, ok := err.(reported); !ok && err != nil {
+		fmt.Fprintln(os.Stderr, "netfs:", err)
+	}
+	os.Exit(exitCode(err))
+}
+
+//命令运行环境，保存到各服务端的连接
+type app struct {
+	principal string
+	secret    string
+	share     string
+	quiet     bool
+	tls       *tls.Config
+
+	out     io.Writer
+	errOut  io.Writer
+	clients map[string]*netfs.Client
+}
+
+func newApp(out, errOut io.Writer) *app {
+	return &app{
+		out:     out,
+		errOut:  errOut,
+		clients: make(map[string]*netfs.Client),
+	}
+}
+
+func (a *app) run(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintln(a.errOut, "netfs: unknown command", name)
+		return errUsage
+	}
+	return cmd(a, args)
+}
+
+func tlsConfig(ca string) (*tls.Config, error) {
+	tc := new(tls.Config)
+	if ca == "" {
+		return tc, nil
+	}
+
+	pem, err := ioutil.ReadFile(ca)
+	if err != nil {
+		return nil, err
+	}
+	tc.RootCAs = x509.NewCertPool()
+	if !tc.RootCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.New(ca + ": no certificates")
+	}
+	return tc, nil
+}
+
+func (a *app) close() {
+	for _, c := range a.clients {
+		c.Close()
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+func Test_ExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{nil, EXIT_OK},
+		{errUsage, EXIT_USAGE},
+		{&os.PathError{Op: "open", Path: "a", Err: syscall.ENOENT}, EXIT_NOT_EXIST},
+		{&os.PathError{Op: "open", Path: "a", Err: syscall.EACCES}, EXIT_PERMISSION},
+		{&os.PathError{Op: "open", Path: "a", Err: syscall.EROFS}, EXIT_PERMISSION},
+		{&os.PathError{Op: "remove", Path: "a", Err: syscall.ENOTEMPTY}, EXIT_ERROR},
+		{&os.LinkError{Op: "rename", Old: "a", New: "b", Err: syscall.EEXIST}, EXIT_EXIST},
+		{&os.PathError{Op: "write", Path: "a", Err: syscall.ENOSPC}, EXIT_NO_SPACE},
+		{&os.PathError{Op: "write", Path: "a", Err: syscall.EDQUOT}, EXIT_NO_SPACE},
+		{netfs.IO_Error("broken pipe"), EXIT_NETWORK},
+		{netfs.Data_Error("bad response"), EXIT_NETWORK},
+		{reported{&os.PathError{Op: "open", Path: "a", Err: syscall.ENOENT}}, EXIT_NOT_EXIST},
+		{errors.New("other"), EXIT_ERROR},
+	}
+
+	for _, tt := range tests {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("exitCode(%v) expect:%d, get:%d", tt.err, tt.code, code)
+		}
+	}
+}
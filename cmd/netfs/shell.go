@@ -0,0 +1,452 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+//交互命令的参数类型：r 远程路径，l 本地路径，- 原样传递，大写表示其后所有参数
+var shellArgs = map[string]string{
+	"ls":    "R",
+	"stat":  "R",
+	"cat":   "R",
+	"less":  "R",
+	"rm":    "R",
+	"mkdir": "R",
+	"touch": "R",
+	"chmod": "-R",
+	"mv":    "rr",
+	"cp":    "rr",
+	"get":   "rl",
+	"put":   "lr",
+	"cd":    "r",
+	"pwd":   "",
+	"lcd":   "l",
+	"lpwd":  "",
+	"lls":   "L",
+	"help":  "",
+	"exit":  "",
+	"quit":  "",
+}
+
+const shellHelp = `commands:
+  ls [-l] [path]       stat path            cat path           less path
+  cd [path]            pwd                  mkdir [-p] path    rm [-r] path
+  mv src dst           cp [-r] src dst      chmod mode path    touch path
+  get [-r] remote [local]                   put [-r] local [remote]
+  lcd path             lpwd                 lls [-l] [path]
+  help                 exit
+remote paths are relative to the working directory; Tab completes names.
+`
+
+type shell struct {
+	a    *app
+	addr string
+	cwd  string
+	c    *netfs.Client
+	lr   *lineReader
+}
+
+func cmdSh(a *app, args []string) error {
+	args, err := parse(flags("sh"), args, 1)
+	if err != nil || len(args) != 1 {
+		return errUsage
+	}
+
+	addr, dir, ok := splitRemote(args[0])
+	if !ok {
+		return errUsage
+	}
+
+	c, err := a.client(addr)
+	if err != nil {
+		return err
+	}
+
+	sh := &shell{a: a, addr: addr, c: c, lr: newLineReader(os.Stdin, a.out)}
+	sh.lr.complete = sh.complete
+
+	if err := sh.cd(dir); err != nil {
+		return err
+	}
+	return sh.run()
+}
+
+func (sh *shell) run() error {
+	for {
+		line, err := sh.lr.readLine(fmt.Sprintf("%s:%s> ", sh.addr, sh.cwd))
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		words := splitWords(line)
+		if len(words) == 0 {
+			continue
+		}
+
+		if err := sh.exec(words[0], words[1:]); err == errExit {
+			return nil
+		} else if err == errUsage {
+			fmt.Fprintf(sh.a.errOut, "usage error, try help\n")
+		} else if _, ok := err.(reported); !ok && err != nil {
+			fmt.Fprintln(sh.a.errOut, "netfs:", err)
+		}
+	}
+}
+
+var errExit = fmt.Errorf("exit")
+
+func (sh *shell) exec(name string, args []string) error {
+	kinds, ok := shellArgs[name]
+	if !ok {
+		fmt.Fprintln(sh.a.errOut, "netfs: unknown command", name)
+		return nil
+	}
+
+	args = sh.rewrite(kinds, args)
+
+	switch name {
+	case "exit", "quit":
+		return errExit
+	case "help":
+		fmt.Fprint(sh.a.out, shellHelp)
+		return nil
+	case "pwd":
+		fmt.Fprintln(sh.a.out, sh.cwd)
+		return nil
+	case "lpwd":
+		dir, err := os.Getwd()
+		if err == nil {
+			fmt.Fprintln(sh.a.out, dir)
+		}
+		return err
+	case "cd":
+		dir := "/"
+		if len(args) > 0 {
+			dir = args[0][len(sh.addr):]
+		}
+		return sh.cd(dir)
+	case "lcd":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return os.Chdir(args[0])
+	case "lls":
+		if positional(args) == 0 {
+			args = append(args, ".")
+		}
+		return sh.a.run("ls", args)
+	case "less":
+		if len(args) == 0 {
+			return errUsage
+		}
+		return sh.a.each(args, sh.less)
+	case "ls":
+		if positional(args) == 0 {
+			args = append(args, sh.addr+sh.cwd)
+		}
+	case "get":
+		if positional(args) == 1 {
+			args = append(args, ".")
+		}
+	case "put":
+		if positional(args) == 1 {
+			args = append(args, sh.addr+sh.cwd)
+		}
+	}
+
+	return sh.a.run(name, args)
+}
+
+func (sh *shell) cd(dir string) error {
+	fi, err := sh.c.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "cd", Path: dir, Err: syscall.ENOTDIR}
+	}
+	sh.cwd = dir
+	return nil
+}
+
+func (sh *shell) resolve(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return path.Clean(name)
+	}
+	return path.Join(sh.cwd, name)
+}
+
+func positional(args []string) int {
+	n := 0
+	for _, s := range args {
+		if !strings.HasPrefix(s, "-") {
+			n++
+		}
+	}
+	return n
+}
+
+//第 i 个非选项参数的类型
+func argKind(kinds string, i int) byte {
+	for j := 0; j < len(kinds); j++ {
+		k := kinds[j]
+		if k == 'R' || k == 'L' {
+			return k + 'a' - 'A'
+		}
+		if j == i {
+			return k
+		}
+	}
+	return 0
+}
+
+//远程路径改写为 host:port/path
+func (sh *shell) rewrite(kinds string, args []string) []string {
+	out := make([]string, 0, len(args))
+	i := 0
+	for _, s := range args {
+		if strings.HasPrefix(s, "-") {
+			out = append(out, s)
+			continue
+		}
+		if argKind(kinds, i) == 'r' {
+			s = sh.addr + sh.resolve(s)
+		}
+		out = append(out, s)
+		i++
+	}
+	return out
+}
+
+// ----- 补全 -----
+
+func (sh *shell) complete(head string) (string, []string) {
+	i := strings.LastIndex(head, " ")
+	before, word := head[:i+1], head[i+1:]
+	words := strings.Fields(before)
+
+	var names []string
+	if len(words) == 0 {
+		for name := range shellArgs {
+			names = append(names, name+" ")
+		}
+	} else {
+		switch argKind(shellArgs[words[0]], positional(words[1:])) {
+		case 'r':
+			names = sh.remoteNames(word)
+		case 'l':
+			names = localNames(word)
+		}
+	}
+
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+
+	switch len(matches) {
+	case 0:
+		return head, nil
+	case 1:
+		return before + matches[0], matches
+	}
+	return before + commonPrefix(matches), matches
+}
+
+func splitDir(word string) string {
+	if i := strings.LastIndex(word, "/"); i >= 0 {
+		return word[:i+1]
+	}
+	return ""
+}
+
+//与 word 同一目录下的所有候选项，目录以 / 结尾，文件以空格结尾
+func (sh *shell) remoteNames(word string) []string {
+	dir := splitDir(word)
+
+	f, err := sh.c.Open(sh.resolve(dir))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	fis, _ := f.Readdir(-1)
+	var names []string
+	for _, fi := range fis {
+		names = append(names, completion(dir, fi))
+	}
+	return names
+}
+
+func localNames(word string) []string {
+	dir := splitDir(word)
+
+	fis, err := ioutil.ReadDir(dir + ".")
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, fi := range fis {
+		names = append(names, completion(dir, fi))
+	}
+	return names
+}
+
+func completion(dir string, fi os.FileInfo) string {
+	if fi.IsDir() {
+		return dir + fi.Name() + "/"
+	}
+	return dir + fi.Name() + " "
+}
+
+func commonPrefix(items []string) string {
+	p := items[0]
+	for _, s := range items[1:] {
+		for !strings.HasPrefix(s, p) {
+			p = p[:len(p)-1]
+		}
+	}
+	return p
+}
+
+//按空白拆分，支持引号与反斜杠转义
+func splitWords(line string) []string {
+	var words []string
+	var cur strings.Builder
+	var quote rune
+	inWord, escape := false, false
+
+	for _, r := range line {
+		switch {
+		case escape:
+			cur.WriteRune(r)
+			escape = false
+		case r == '\\' && quote != '\'':
+			escape, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words
+}
+
+// ----- 分页 -----
+
+//分页显示文件：空格/f 下一页，b 上一页，回车/j 下一行，k 上一行，g/G 首尾，q 退出
+func (sh *shell) less(t *target) error {
+	f, err := t.fs.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fd := int(sh.lr.in.Fd())
+	restore, err := makeRaw(fd)
+	if err != nil {
+		_, err = io.Copy(sh.a.out, f)
+		return err
+	}
+	defer restore()
+
+	width, height := termSize(fd)
+	rows := height - 1
+
+	var lines []string
+	br := bufio.NewReader(f)
+	eof := false
+	load := func(n int) {
+		for (n < 0 || len(lines) < n) && !eof {
+			s, err := br.ReadString('\n')
+			if s != "" {
+				lines = append(lines, strings.Replace(strings.TrimRight(s, "\r\n"), "\t", "    ", -1))
+			}
+			if err != nil {
+				eof = true
+			}
+		}
+	}
+
+	top := 0
+	for {
+		load(top + rows)
+		if max := len(lines) - rows; eof && top > max {
+			top = max
+		}
+		if top < 0 {
+			top = 0
+		}
+
+		fmt.Fprint(sh.a.out, "\x1b[H\x1b[2J")
+		for i := top; i < top+rows && i < len(lines); i++ {
+			line := []rune(lines[i])
+			if len(line) > width {
+				line = line[:width]
+			}
+			fmt.Fprint(sh.a.out, string(line)+"\r\n")
+		}
+
+		status := t.path
+		if eof && top+rows >= len(lines) {
+			status += " (END)"
+		}
+		fmt.Fprint(sh.a.out, "\x1b[7m"+status+"\x1b[0m")
+
+		key, err := sh.lr.readKey()
+		if err != nil {
+			return err
+		}
+
+		switch key {
+		case "q", "Q", "\x03":
+			fmt.Fprint(sh.a.out, "\r\x1b[K")
+			return nil
+		case " ", "f", "\x1b[6~":
+			top += rows
+		case "b", "\x1b[5~":
+			top -= rows
+		case "\r", "\n", "j", "\x1b[B":
+			top++
+		case "k", "\x1b[A":
+			top--
+		case "g", "<":
+			top = 0
+		case "G", ">":
+			load(-1)
+			top = len(lines)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+func Test_SplitWords(t *testing.T) {
+	tests := []struct {
+		line  string
+		words string
+	}{
+		{"", ""},
+		{"  ls  -l\t/a ", "ls|-l|/a"},
+		{`get "a b.txt" 'c d'`, "get|a b.txt|c d"},
+		{`cat a\ b.txt`, "cat|a b.txt"},
+		{`echo "a\"b" 'a\b'`, `echo|a"b|a\b`},
+		{`put "" x`, "put||x"},
+	}
+
+	for _, tt := range tests {
+		if s := strings.Join(splitWords(tt.line), "|"); s != tt.words {
+			t.Errorf("splitWords(%s) expect:%s, get:%s", tt.line, tt.words, s)
+		}
+	}
+}
+
+func Test_ArgKind(t *testing.T) {
+	tests := []struct {
+		kinds string
+		i     int
+		kind  byte
+	}{
+		{"rl", 0, 'r'},
+		{"rl", 1, 'l'},
+		{"rl", 2, 0},
+		{"R", 5, 'r'},
+		{"-R", 0, '-'},
+		{"-R", 3, 'r'},
+		{"", 0, 0},
+	}
+
+	for _, tt := range tests {
+		if k := argKind(tt.kinds, tt.i); k != tt.kind {
+			t.Errorf("argKind(%s, %d) expect:%q, get:%q", tt.kinds, tt.i, tt.kind, k)
+		}
+	}
+}
+
+func Test_Rewrite(t *testing.T) {
+	sh := &shell{addr: "127.0.0.1:11120", cwd: "/home"}
+
+	tests := []struct {
+		name string
+		args string
+		out  string
+	}{
+		{"ls", "-l a /b ..", "-l 127.0.0.1:11120/home/a 127.0.0.1:11120/b 127.0.0.1:11120/"},
+		{"get", "-r a.txt ./local", "-r 127.0.0.1:11120/home/a.txt ./local"},
+		{"put", "a.txt b", "a.txt 127.0.0.1:11120/home/b"},
+		{"chmod", "644 a.txt", "644 127.0.0.1:11120/home/a.txt"},
+		{"lls", "dir", "dir"},
+	}
+
+	for _, tt := range tests {
+		out := strings.Join(sh.rewrite(shellArgs[tt.name], strings.Fields(tt.args)), " ")
+		if out != tt.out {
+			t.Errorf("rewrite(%s %s) expect:%s, get:%s", tt.name, tt.args, tt.out, out)
+		}
+	}
+}
+
+func Test_Complete(t *testing.T) {
+	fs := new(netfs.MemFs).Init()
+	fs.MkdirAll("/home/docs", 0755)
+	for _, name := range []string{"/home/a1.txt", "/home/a2.txt", "/home/docs/b.txt"} {
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+
+	go netfs.Listen("127.0.0.1:11138", fs)
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := netfs.Dial("127.0.0.1:11138")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	sh := &shell{addr: "127.0.0.1:11138", cwd: "/home", c: c}
+
+	tests := []struct {
+		head    string
+		line    string
+		matches string
+	}{
+		{"pw", "pwd ", "pwd "},
+		{"l", "l", "lcd |less |lls |lpwd |ls "},
+		{"cat a", "cat a", "a1.txt |a2.txt "},
+		{"cat a1", "cat a1.txt ", "a1.txt "},
+		{"cat d", "cat docs/", "docs/"},
+		{"cat docs/", "cat docs/b.txt ", "docs/b.txt "},
+		{"cat x", "cat x", ""},
+		{"pwd a", "pwd a", ""},
+	}
+
+	for _, tt := range tests {
+		line, matches := sh.complete(tt.head)
+		if line != tt.line || strings.Join(matches, "|") != tt.matches {
+			t.Errorf("complete(%s) expect:%q %q, get:%q %q", tt.head, tt.line, tt.matches, line, strings.Join(matches, "|"))
+		}
+	}
+}
+
+func Test_CommonPrefix(t *testing.T) {
+	tests := []struct {
+		items  string
+		prefix string
+	}{
+		{"abc", "abc"},
+		{"abc abd", "ab"},
+		{"abc abd x", ""},
+		{"a.txt a.txt", "a.txt"},
+		{"docs/ docs/a", "docs/"},
+	}
+
+	for _, tt := range tests {
+		if p := commonPrefix(strings.Fields(tt.items)); p != tt.prefix {
+			t.Errorf("commonPrefix(%s) expect:%s, get:%s", tt.items, tt.prefix, p)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+//命令的操作对象，远程为 host:port[/path]，否则为本地路径
+type target struct {
+	addr string
+	path string
+	fs   netfs.FileSystem
+}
+
+func (t *target) remote() bool {
+	return t.addr != ""
+}
+
+func (t *target) String() string {
+	if t.remote() {
+		return t.addr + t.path
+	}
+	return t.path
+}
+
+//子路径
+func (t *target) join(name string) *target {
+	return &target{addr: t.addr, path: path.Join(t.path, name), fs: t.fs}
+}
+
+//用于比较的路径，本地路径转为绝对路径
+func (t *target) abs() string {
+	if t.remote() {
+		return path.Clean(t.path)
+	}
+	p, err := filepath.Abs(t.path)
+	if err != nil {
+		return filepath.Clean(t.path)
+	}
+	return filepath.ToSlash(p)
+}
+
+//是否为同一路径
+func (t *target) same(o *target) bool {
+	return t.addr == o.addr && t.abs() == o.abs()
+}
+
+//o 是否在 t 之下
+func (t *target) contains(o *target) bool {
+	if t.addr != o.addr {
+		return false
+	}
+	p := t.abs()
+	return strings.HasPrefix(o.abs(), strings.TrimSuffix(p, "/")+"/")
+}
+
+//拆分远程目标，不是 host:port 形式时返回 false
+func splitRemote(s string) (addr, name string, ok bool) {
+	addr, name = s, "/"
+	if i := strings.Index(s, "/"); i >= 0 {
+		addr, name = s[:i], s[i:]
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", "", false
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", false
+	}
+	return addr, path.Clean(name), true
+}
+
+func (a *app) target(s string) (*target, error) {
+	addr, name, ok := splitRemote(s)
+	if !ok {
+		return &target{path: s, fs: new(netfs.LocalFs).Init("")}, nil
+	}
+
+	c, err := a.client(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &target{addr: addr, path: name, fs: c}, nil
+}
+
+//到 addr 的连接，同一服务端只连接一次
+func (a *app) client(addr string) (*netfs.Client, error) {
+	if c, ok := a.clients[addr]; ok {
+		return c, nil
+	}
+
+	var c *netfs.Client
+	var err error
+	if a.tls != nil {
+		c, err = netfs.DialTLS(addr, a.tls)
+	} else {
+		c, err = netfs.Dial(addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if a.principal != "" {
+		if err := c.Auth(a.principal, a.secret); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+
+	if a.share != "" {
+		s, err := c.Share(a.share)
+		c.Close()
+		if err != nil {
+			return nil, err
+		}
+		c = s
+	}
+
+	a.clients[addr] = c
+	return c, nil
+}
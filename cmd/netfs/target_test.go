@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func Test_SplitRemote(t *testing.T) {
+	tests := []struct {
+		s    string
+		addr string
+		name string
+		ok   bool
+	}{
+		{"127.0.0.1:11120", "127.0.0.1:11120", "/", true},
+		{"127.0.0.1:11120/", "127.0.0.1:11120", "/", true},
+		{"127.0.0.1:11120/a/../b/", "127.0.0.1:11120", "/b", true},
+		{"host:80/a.txt", "host:80", "/a.txt", true},
+		{"[::1]:11120/a", "[::1]:11120", "/a", true},
+		{"a.txt", "", "", false},
+		{"./a:b", "", "", false},
+		{"/tmp/a:1", "", "", false},
+		{"host:http/a", "", "", false},
+		{"host:70000", "", "", false},
+	}
+
+	for _, tt := range tests {
+		addr, name, ok := splitRemote(tt.s)
+		if addr != tt.addr || name != tt.name || ok != tt.ok {
+			t.Errorf("splitRemote(%s) expect:%s %s %v, get:%s %s %v", tt.s, tt.addr, tt.name, tt.ok, addr, name, ok)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+//其它平台按行读取，不支持补全与分页
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal not supported")
+}
+
+func termSize(fd int) (int, int) {
+	return 80, 24
+}
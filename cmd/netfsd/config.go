@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+//配置文件(JSON)
+type Config struct {
+	Listen  []string `json:"listen"`
+	Connect []string `json:"connect"` //主动连接到这些地址并在连接上提供服务
+
+	TLS *TLSConfig `json:"tls"`
+
+	//principal => secret，secret 可写作 "sha256:<hex>"
+	Users map[string]string `json:"users"`
+
+	Exports []ExportConfig `json:"exports"`
+	Limits  *LimitsConfig  `json:"limits"`
+	Log     LogConfig      `json:"log"`
+	Audit   *AuditConfig   `json:"audit"`
+
+	Metrics         string `json:"metrics"` //Prometheus 指标的 HTTP 地址
+	ShutdownTimeout string `json:"shutdown_timeout"`
+}
+
+type TLSConfig struct {
+	Cert     string `json:"cert"`
+	Key      string `json:"key"`
+	ClientCA string `json:"client_ca"` //设置后要求客户端证书
+}
+
+type ExportConfig struct {
+	Name       string       `json:"name"`
+	Root       string       `json:"root"`
+	ReadOnly   bool         `json:"read_only"`
+	Principals []string     `json:"principals"` //为空时允许所有连接
+	Quota      *QuotaConfig `json:"quota"`
+}
+
+type QuotaConfig struct {
+	Bytes           int64  `json:"bytes"`
+	Inodes          int64  `json:"inodes"`
+	PrincipalBytes  int64  `json:"principal_bytes"`
+	PrincipalInodes int64  `json:"principal_inodes"`
+	Index           string `json:"index"` //文件所有者索引，为空时重启后用户用量从零开始
+}
+
+type LimitsConfig struct {
+	Global    RateConfig `json:"global"`
+	Session   RateConfig `json:"session"`
+	Principal RateConfig `json:"principal"`
+}
+
+type RateConfig struct {
+	Requests float64 `json:"requests"`
+	Bytes    float64 `json:"bytes"`
+}
+
+type LogConfig struct {
+	Level string `json:"level"` //debug, info, warn, error
+	File  string `json:"file"`  //为空时输出到 stderr
+}
+
+type AuditConfig struct {
+	File       string `json:"file"`
+	MaxSize    int64  `json:"max_size"`
+	MaxBackups int    `json:"max_backups"`
+}
+
+func loadConfig(name string) (*Config, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := new(Config)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	if len(cfg.Listen) == 0 && len(cfg.Connect) == 0 {
+		return nil, fmt.Errorf("%s: no listen or connect address", name)
+	}
+	if len(cfg.Exports) == 0 {
+		return nil, fmt.Errorf("%s: no exports", name)
+	}
+	for _, e := range cfg.Exports {
+		if e.Root == "" {
+			return nil, fmt.Errorf("%s: export %q has no root", name, e.Name)
+		}
+	}
+	if _, err := cfg.shutdownTimeout(); err != nil {
+		return nil, fmt.Errorf("%s: shutdown_timeout: %v", name, err)
+	}
+	if _, err := parseLevel(cfg.Log.Level); err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return cfg, nil
+}
+
+func (cfg *Config) shutdownTimeout() (time.Duration, error) {
+	if cfg.ShutdownTimeout == "" {
+		return 30 * time.Second, nil
+	}
+	return time.ParseDuration(cfg.ShutdownTimeout)
+}
+
+func parseLevel(s string) (netfs.LogLevel, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return netfs.LOG_DEBUG, nil
+	case "", "info":
+		return netfs.LOG_INFO, nil
+	case "warn":
+		return netfs.LOG_WARN, nil
+	case "error":
+		return netfs.LOG_ERROR, nil
+	}
+	return 0, errors.New("unknown log level " + s)
+}
+
+func (cfg *Config) tlsConfig() (*tls.Config, error) {
+	if cfg.TLS == nil {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLS.Cert, cfg.TLS.Key)
+	if err != nil {
+		return nil, err
+	}
+	tc := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if cfg.TLS.ClientCA != "" {
+		pem, err := ioutil.ReadFile(cfg.TLS.ClientCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(cfg.TLS.ClientCA + ": no certificates")
+		}
+		tc.ClientCAs = pool
+		tc.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tc, nil
+}
+
+func checkSecret(want, got string) bool {
+	if strings.HasPrefix(want, "sha256:") {
+		sum := sha256.Sum256([]byte(got))
+		got = hex.EncodeToString(sum[:])
+		want = strings.ToLower(want[len("sha256:"):])
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+//允许访问的用户，为 nil 时允许所有连接
+func (e *ExportConfig) allowed() map[string]bool {
+	if len(e.Principals) == 0 {
+		return nil
+	}
+	allowed := make(map[string]bool)
+	for _, p := range e.Principals {
+		allowed[p] = true
+	}
+	return allowed
+}
+
+//重新加载时 root、read_only、是否有配额及配额索引不变的共享目录沿用原来的对象
+func (e *ExportConfig) sameShare(o *ExportConfig) bool {
+	if e.Root != o.Root || e.ReadOnly != o.ReadOnly || (e.Quota == nil) != (o.Quota == nil) {
+		return false
+	}
+	return e.Quota == nil || e.Quota.Index == o.Quota.Index
+}
+
+func (e *ExportConfig) checkRoot() error {
+	fi, err := os.Stat(e.Root)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: "export", Path: e.Root, Err: errors.New("not a directory")}
+	}
+	return nil
+}
+
+func (q *QuotaConfig) limits() (export, principal netfs.QuotaLimit) {
+	return netfs.QuotaLimit{Bytes: q.Bytes, Inodes: q.Inodes},
+		netfs.QuotaLimit{Bytes: q.PrincipalBytes, Inodes: q.PrincipalInodes}
+}
+
+func (l *LimitsConfig) rateLimits() *netfs.RateLimits {
+	if l == nil {
+		return nil
+	}
+	return &netfs.RateLimits{
+		Global:    netfs.RateLimit{Requests: l.Global.Requests, Bytes: l.Global.Bytes},
+		Session:   netfs.RateLimit{Requests: l.Session.Requests, Bytes: l.Session.Bytes},
+		Principal: netfs.RateLimit{Requests: l.Principal.Requests, Bytes: l.Principal.Bytes},
+	}
+}
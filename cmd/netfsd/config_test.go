@@ -0,0 +1,200 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+func test_config(t *testing.T, body string) string {
+	f, err := ioutil.TempFile("", "netfsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(body)
+	f.Close()
+	return f.Name()
+}
+
+func Test_LoadConfig(t *testing.T) {
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{`{"listen":[":11120"],"exports":[{"root":"/tmp"}]}`, ""},
+		{`{"connect":["a:1"],"exports":[{"root":"/tmp"}],"shutdown_timeout":"5s","log":{"level":"WARN"}}`, ""},
+		{`{"listen":[":11120"]`, "unexpected end"},
+		{`{"exports":[{"root":"/tmp"}]}`, "no listen or connect"},
+		{`{"listen":[":11120"]}`, "no exports"},
+		{`{"listen":[":11120"],"exports":[{"name":"x"}]}`, `export "x" has no root`},
+		{`{"listen":[":11120"],"exports":[{"root":"/tmp"}],"shutdown_timeout":"5"}`, "shutdown_timeout"},
+		{`{"listen":[":11120"],"exports":[{"root":"/tmp"}],"log":{"level":"loud"}}`, "unknown log level"},
+	}
+
+	for _, test := range tests {
+		name := test_config(t, test.body)
+		_, err := loadConfig(name)
+		os.Remove(name)
+
+		if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("loadConfig %s expect:%q, get:%v", test.body, test.err, err)
+		}
+	}
+
+	if _, err := loadConfig("/none/netfsd.json"); !os.IsNotExist(err) {
+		t.Errorf("loadConfig expect:not exist, get:%v", err)
+	}
+}
+
+func Test_CheckSecret(t *testing.T) {
+	tests := []struct {
+		want, got string
+		ok        bool
+	}{
+		{"secret", "secret", true},
+		{"secret", "Secret", false},
+		{"secret", "", false},
+		{"sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", "secret", true},
+		{"sha256:2BB80D537B1DA3E38BD30361AA855686BDE0EACD7162FEF6A25FE97BF527A25B", "secret", true},
+		{"sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", "other", false},
+		{"sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", false},
+	}
+
+	for _, test := range tests {
+		if ok := checkSecret(test.want, test.got); ok != test.ok {
+			t.Errorf("checkSecret(%q, %q) expect:%v, get:%v", test.want, test.got, test.ok, ok)
+		}
+	}
+}
+
+func Test_ReloadExports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netfsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	os.Mkdir(a, 0755)
+	os.Mkdir(b, 0755)
+
+	d := &daemon{exports: new(netfs.Exports).Init()}
+	cfg := &Config{Exports: []ExportConfig{
+		{Name: "home", Root: a, Principals: []string{"bob"}, Quota: &QuotaConfig{Bytes: 100}},
+		{Name: "old", Root: b},
+	}}
+	if err := d.reloadExports(cfg); err != nil {
+		t.Fatal(err)
+	}
+	home := d.exports.Get("home")
+	if home == nil || home.Allow("alice", nil) || !home.Allow("bob", nil) {
+		t.Fatalf("Share expect:bob only, get:%v", home)
+	}
+
+	//只改变用户与配额限制时沿用原来的 Share
+	cfg.Exports = []ExportConfig{
+		{Name: "home", Root: a, Principals: []string{"alice"}, Quota: &QuotaConfig{Bytes: 200}},
+	}
+	if err := d.reloadExports(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.exports.Get("home"); s != home {
+		t.Error("Share expect:same object, get:new")
+	}
+	if !home.Allow("alice", nil) || home.Allow("bob", nil) {
+		t.Error("Allow expect:alice only")
+	}
+	if home.Quota.Export.Bytes != 200 {
+		t.Errorf("Quota expect:200, get:%d", home.Quota.Export.Bytes)
+	}
+	if s := d.exports.Get("old"); s != nil {
+		t.Error("Removed share expect:nil")
+	}
+
+	//root 改变时重新创建
+	cfg.Exports[0].Root = b
+	if err := d.reloadExports(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if s := d.exports.Get("home"); s == nil || s == home {
+		t.Error("Share expect:new object")
+	}
+
+	//root 不存在时不做任何改变
+	cfg.Exports[0].Root = filepath.Join(dir, "none")
+	if err := d.reloadExports(cfg); err == nil {
+		t.Error("reloadExports expect:error, get:nil")
+	}
+	if d.shares["home"].cfg.Root != b {
+		t.Errorf("Root expect:%s, get:%s", b, d.shares["home"].cfg.Root)
+	}
+}
+
+func Test_ExportEscape(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netfsd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"pub", "bob", "alice"} {
+		os.Mkdir(filepath.Join(dir, name), 0755)
+		ioutil.WriteFile(filepath.Join(dir, name, "s.txt"), []byte(name), 0644)
+	}
+
+	d := &daemon{exports: new(netfs.Exports).Init()}
+	d.exports.Auth = d.auth
+	d.users.Store(map[string]string{"bob": "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"})
+
+	cfg := &Config{Exports: []ExportConfig{
+		{Name: "", Root: filepath.Join(dir, "pub"), ReadOnly: true},
+		{Name: "bob", Root: filepath.Join(dir, "bob"), Principals: []string{"bob"}},
+		{Name: "alice", Root: filepath.Join(dir, "alice"), Principals: []string{"alice"}},
+	}}
+	if err := d.reloadExports(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	go d.exports.Listen("127.0.0.1:11140")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := netfs.Dial("127.0.0.1:11140")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Auth("bob", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Share("alice"); !os.IsPermission(err) {
+		t.Errorf("Share expect:permission denied, get:%v", err)
+	}
+
+	//只读的默认目录与 bob 的目录都不能通过 .. 访问 alice 的目录
+	b, err := c.Share("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, fs := range []netfs.FileSystem{c, b} {
+		if _, err := fs.Open("../alice/s.txt"); !os.IsNotExist(err) {
+			t.Errorf("Open expect:not exist, get:%v", err)
+		}
+		fs.Remove("../alice/s.txt")
+	}
+	if f, err := b.Create("../pub/w.txt"); err == nil {
+		f.Close()
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "alice", "s.txt")); err != nil {
+		t.Errorf("Stat alice/s.txt expect:nil, get:%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pub", "w.txt")); !os.IsNotExist(err) {
+		t.Errorf("Stat pub/w.txt expect:not exist, get:%v", err)
+	}
+}
@@ -0,0 +1,302 @@
+// netfsd 服务端
+//
+//	netfsd -config /etc/netfsd.json
+//
+// 始终在前台运行。SIGTERM/SIGINT 时停止接受新连接，等待进行中的请求完成后退出；
+// SIGHUP 时重新读取配置文件，共享目录与用户立即生效，其它配置需重启；
+// root、read_only 与是否有配额都不变的共享目录沿用原来的对象，配额用量与锁不受影响。
+// 在 systemd 下可使用 Type=notify，启动、重载与退出时会通过 NOTIFY_SOCKET 通知：
+//
+//	[Service]
+//	Type=notify
+//	ExecStart=/usr/local/bin/netfsd -config /etc/netfsd.json
+//	ExecReload=/bin/kill -HUP $MAINPID
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+func main() {
+	name := flag.String("config", "/etc/netfsd.json", "configuration file")
+	check := flag.Bool("check", false, "check the configuration file and exit")
+	flag.Parse()
+
+	cfg, err := loadConfig(*name)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "netfsd:", err)
+		os.Exit(1)
+	}
+	if *check {
+		return
+	}
+
+	d := new(daemon)
+	if err := d.start(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "netfsd:", err)
+		os.Exit(1)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+
+	notify("READY=1")
+
+	for s := range sig {
+		if s != syscall.SIGHUP {
+			break
+		}
+
+		notify("RELOADING=1")
+		if cfg, err := loadConfig(*name); err != nil {
+			netfs.Logger.Error("reload failed", "error", err)
+		} else {
+			d.reload(cfg)
+		}
+		notify("READY=1")
+	}
+
+	notify("STOPPING=1")
+	if err := d.stop(); err != nil {
+		netfs.Logger.Error("shutdown", "error", err)
+		os.Exit(1)
+	}
+}
+
+type daemon struct {
+	exports *netfs.Exports
+	users   atomic.Value //map[string]string
+	shares  map[string]*export
+	timeout time.Duration
+
+	audit   *netfs.AuditLog
+	metrics *http.Server
+	closers []io.Closer
+
+	stopping int32
+	wg       sync.WaitGroup
+}
+
+func (d *daemon) start(cfg *Config) error {
+	level, _ := parseLevel(cfg.Log.Level)
+	out := io.Writer(os.Stderr)
+	if cfg.Log.File != "" {
+		f, err := os.OpenFile(cfg.Log.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+		if err != nil {
+			return err
+		}
+		out = f
+		d.closers = append(d.closers, f)
+	}
+	netfs.Logger = new(netfs.TextLog).Init(out, level)
+
+	d.timeout, _ = cfg.shutdownTimeout()
+	d.exports = new(netfs.Exports).Init()
+	d.exports.Auth = d.auth
+	d.exports.RateLimits = cfg.Limits.rateLimits()
+
+	if cfg.Audit != nil {
+		a, err := new(netfs.AuditLog).Init(cfg.Audit.File, cfg.Audit.MaxSize, cfg.Audit.MaxBackups)
+		if err != nil {
+			return err
+		}
+		d.audit = a
+		d.exports.Audit = a
+	}
+
+	if cfg.Metrics != "" {
+		registry := new(netfs.Registry).Init()
+		d.exports.Metrics = registry
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry)
+		d.metrics = &http.Server{Addr: cfg.Metrics, Handler: mux}
+
+		ln, err := net.Listen("tcp", cfg.Metrics)
+		if err != nil {
+			return err
+		}
+		go d.metrics.Serve(ln)
+	}
+
+	if err := d.reloadExports(cfg); err != nil {
+		return err
+	}
+	d.users.Store(cfg.Users)
+
+	tc, err := cfg.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range cfg.Listen {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		if tc != nil {
+			ln = tls.NewListener(ln, tc)
+		}
+
+		netfs.Logger.Info("listening", "addr", addr, "tls", tc != nil)
+		go func(addr string, ln net.Listener) {
+			if err := d.exports.ServeListener(ln); err != nil {
+				netfs.Logger.Error("accept failed", "addr", addr, "error", err)
+			}
+		}(addr, ln)
+	}
+
+	for _, addr := range cfg.Connect {
+		d.wg.Add(1)
+		go d.connect(addr, tc)
+	}
+	return nil
+}
+
+//反向连接：主动连接对方并在该连接上提供服务，断开后重连
+func (d *daemon) connect(addr string, tc *tls.Config) {
+	defer d.wg.Done()
+
+	for atomic.LoadInt32(&d.stopping) == 0 {
+		conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+		if err != nil {
+			netfs.Logger.Warn("connect failed", "addr", addr, "error", err)
+		} else {
+			if tc != nil {
+				conn = tls.Server(conn, tc)
+			}
+			d.exports.Serve(conn)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func (d *daemon) auth(principal, secret string) bool {
+	users, _ := d.users.Load().(map[string]string)
+	want, ok := users[principal]
+	return ok && checkSecret(want, secret)
+}
+
+//已加入的共享目录，重新加载时未改变的沿用同一个 Share，
+//已连接的会话与新会话使用同一份配额用量和锁表
+type export struct {
+	cfg     ExportConfig
+	share   *netfs.Share
+	allowed atomic.Value //map[string]bool
+}
+
+func newExport(e ExportConfig) *export {
+	x := &export{cfg: e}
+	x.allowed.Store(e.allowed())
+	x.share = &netfs.Share{
+		Name:     e.Name,
+		Fs:       new(netfs.LocalFs).Init(e.Root),
+		ReadOnly: e.ReadOnly,
+		Allow: func(principal string, addr net.Addr) bool {
+			allowed, _ := x.allowed.Load().(map[string]bool)
+			return allowed == nil || allowed[principal]
+		},
+	}
+	if e.Quota != nil {
+		x.share.Quota = &netfs.Quota{Index: e.Quota.Index}
+		x.share.Quota.Export, x.share.Quota.Principal = e.Quota.limits()
+	}
+	return x
+}
+
+//用新的配置更新访问控制与配额限制
+func (x *export) update(e ExportConfig) {
+	x.cfg = e
+	x.allowed.Store(e.allowed())
+	if e.Quota != nil {
+		export, principal := e.Quota.limits()
+		x.share.Quota.SetLimits(export, principal, nil)
+	}
+}
+
+func (d *daemon) reloadExports(cfg *Config) error {
+	for i := range cfg.Exports {
+		if err := cfg.Exports[i].checkRoot(); err != nil {
+			return err
+		}
+	}
+
+	shares := make(map[string]*export)
+	for _, e := range cfg.Exports {
+		if x, ok := d.shares[e.Name]; ok && x.cfg.sameShare(&e) {
+			x.update(e)
+			shares[e.Name] = x
+			continue
+		}
+
+		x := newExport(e)
+		d.exports.Add(x.share)
+		shares[e.Name] = x
+	}
+	for name := range d.shares {
+		if _, ok := shares[name]; !ok {
+			d.exports.Remove(name)
+		}
+	}
+	d.shares = shares
+	return nil
+}
+
+func (d *daemon) reload(cfg *Config) {
+	if err := d.reloadExports(cfg); err != nil {
+		netfs.Logger.Error("reload failed", "error", err)
+		return
+	}
+	d.users.Store(cfg.Users)
+	netfs.Logger.Info("reloaded", "exports", len(cfg.Exports), "users", len(cfg.Users))
+}
+
+func (d *daemon) stop() error {
+	atomic.StoreInt32(&d.stopping, 1)
+	netfs.Logger.Info("shutting down", "timeout", d.timeout)
+
+	err := d.exports.Shutdown(d.timeout)
+	d.wg.Wait()
+
+	if d.metrics != nil {
+		d.metrics.Close()
+	}
+	if d.audit != nil {
+		d.audit.Close()
+	}
+	for _, c := range d.closers {
+		c.Close()
+	}
+	return err
+}
+
+//systemd 通知，未在 systemd 下运行时忽略
+func notify(state string) {
+	name := os.Getenv("NOTIFY_SOCKET")
+	if name == "" {
+		return
+	}
+	if name[0] == '@' {
+		name = "\x00" + name[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte(state))
+}
@@ -8,6 +8,7 @@ import (
 	"bufio"
 	"fmt"
 	"time"
+	"syscall"
 	"encoding/binary"
 )
 
@@ -137,6 +138,10 @@ func (c *conn) readUint64() (number uint64) {
 	return
 }
 
+func (c *conn) readBool() bool {
+	return c.readUint8() != 0
+}
+
 // ----- int 读取 -----
 
 func (c *conn) readInt8() (number int8) {
@@ -201,6 +206,14 @@ func (c *conn) writeUint64(data uint64) {
 	}
 }
 
+func (c *conn) writeBool(data bool) {
+	if data {
+		c.writeUint8(1)
+	} else {
+		c.writeUint8(0)
+	}
+}
+
 // ------ uint 写入 -----------
 
 func (c *conn) writeInt8(data int8) {
@@ -277,6 +290,17 @@ func (c *conn) readError() error {
 		switch _len16 {
 		case ERROR_NIL : return nil
 		case ERROR_EOF : return io.EOF
+		case ERROR_PATH :
+			op := c.readString()
+			path := c.readString()
+			return &os.PathError{Op: op, Path: path, Err: c.readErrno()}
+		case ERROR_LINK :
+			op := c.readString()
+			oldpath := c.readString()
+			newpath := c.readString()
+			return &os.LinkError{Op: op, Old: oldpath, New: newpath, Err: c.readErrno()}
+		case ERROR_ERRNO :
+			return c.readErrno()
 		default:
 			panic(IO_Error("ReadError Len Not Defined"))
 		}
@@ -313,6 +337,32 @@ func (c *conn) writeError(err error) {
 		return
 	}
 
+	switch e := err.(type) {
+	case *os.PathError :
+		if code := errnoCode(e.Err); code != 0 {
+			c.writeUint16(ERROR_PATH)
+			c.writeString(e.Op)
+			c.writeString(e.Path)
+			c.writeUint16(code)
+			return
+		}
+	case *os.LinkError :
+		if code := errnoCode(e.Err); code != 0 {
+			c.writeUint16(ERROR_LINK)
+			c.writeString(e.Op)
+			c.writeString(e.Old)
+			c.writeString(e.New)
+			c.writeUint16(code)
+			return
+		}
+	case syscall.Errno :
+		if code := errnoCode(e); code != 0 {
+			c.writeUint16(ERROR_ERRNO)
+			c.writeUint16(code)
+			return
+		}
+	}
+
 	errs := err.Error()
 
 	if len(errs) > int(ERROR_MAX) {
@@ -323,6 +373,59 @@ func (c *conn) writeError(err error) {
 	c.writeData([]byte(errs))
 }
 
+// ----- 错误码 -----
+
+//与平台无关的错误码，下标即传输的编号
+var errnoTable = []syscall.Errno{
+	0,
+	syscall.ENOENT,
+	syscall.EEXIST,
+	syscall.EACCES,
+	syscall.EPERM,
+	syscall.ENOTDIR,
+	syscall.EISDIR,
+	syscall.ENOTEMPTY,
+	syscall.EROFS,
+	syscall.EXDEV,
+	syscall.EINVAL,
+	syscall.EBADF,
+	syscall.ENOSPC,
+	syscall.ENAMETOOLONG,
+	syscall.ELOOP,
+	syscall.EAGAIN,
+	syscall.EDQUOT,
+}
+
+func errnoCode(err error) uint16 {
+	switch err {
+	case os.ErrNotExist :
+		err = syscall.ENOENT
+	case os.ErrExist :
+		err = syscall.EEXIST
+	case os.ErrPermission :
+		err = syscall.EACCES
+	case os.ErrClosed :
+		err = syscall.EBADF
+	}
+
+	if errno, ok := err.(syscall.Errno); ok {
+		for i, v := range errnoTable {
+			if i > 0 && v == errno {
+				return uint16(i)
+			}
+		}
+	}
+	return 0
+}
+
+func (c *conn) readErrno() syscall.Errno {
+	code := c.readUint16()
+	if code == 0 || int(code) >= len(errnoTable) {
+		panic(Data_Error(fmt.Sprintf("Undefined Errno:%d", code)))
+	}
+	return errnoTable[code]
+}
+
 func (c *conn) writeData(data interface{}) {
 	err := binary.Write(c.buf, binary.BigEndian, data)
 	if err != nil {
@@ -334,6 +437,10 @@ func (c *conn) writeData(data interface{}) {
 //----------------
 
 func (c *conn) writeFileInfo(fi os.FileInfo) {
+	if fi == nil {
+		fi = new(FileInfo)
+	}
+
 	c.writeString(fi.Name())
 	c.writeInt64(fi.Size())
 	c.writeUint32(uint32(fi.Mode()))
@@ -0,0 +1,161 @@
+// WebDAV 网关，把任意 netfs.FileSystem 发布为 WebDAV 服务
+//
+//	http.Handle("/dav/", dav.NewHandler(fs, "/dav"))
+package dav
+
+import (
+	"context"
+	"encoding/xml"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
+	netfs "github.com/bybzmt/golang-netfs"
+	"golang.org/x/net/webdav"
+)
+
+//适配 webdav.FileSystem
+//自定义属性(PROPPATCH)保存在内存中，随文件的移动与删除同步更新
+type FileSystem struct {
+	Fs netfs.FileSystem
+
+	mu    sync.Mutex
+	props map[string]map[xml.Name]webdav.Property
+}
+
+//Client 不能并发使用，它的操作依次进行
+func (d *FileSystem) Init(fs netfs.FileSystem) *FileSystem {
+	if c, ok := fs.(*netfs.Client); ok {
+		fs = netfs.Serialize(c)
+	}
+
+	d.Fs = fs
+	d.props = make(map[string]map[xml.Name]webdav.Property)
+	return d
+}
+
+//WebDAV 处理器，锁保存在内存中
+func NewHandler(fs netfs.FileSystem, prefix string) *webdav.Handler {
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: new(FileSystem).Init(fs),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
+
+func (d *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return d.Fs.Mkdir(clean(name), perm)
+}
+
+func (d *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = clean(name)
+	f, err := d.Fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &file{File: f, d: d, name: name}, nil
+}
+
+func (d *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = clean(name)
+	if name == "/" {
+		return os.ErrInvalid
+	}
+
+	err := d.Fs.RemoveAll(name)
+	if err == nil {
+		d.moveProps(name, "")
+	}
+	return err
+}
+
+func (d *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldName, newName = clean(oldName), clean(newName)
+
+	err := d.Fs.Rename(oldName, newName)
+	if err == nil {
+		d.moveProps(oldName, newName)
+	}
+	return err
+}
+
+func (d *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return d.Fs.Stat(clean(name))
+}
+
+//移动 name 及其下所有文件的属性，to 为空时删除
+func (d *FileSystem) moveProps(name, to string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for p, props := range d.props {
+		if p != name && !strings.HasPrefix(p, name+"/") {
+			continue
+		}
+		delete(d.props, p)
+		if to != "" {
+			d.props[to+p[len(name):]] = props
+		}
+	}
+}
+
+// ----- 文件 -----
+
+type file struct {
+	netfs.File
+	d    *FileSystem
+	name string
+}
+
+func (f *file) DeadProps() (map[xml.Name]webdav.Property, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+
+	props := make(map[xml.Name]webdav.Property, len(f.d.props[f.name]))
+	for k, v := range f.d.props[f.name] {
+		props[k] = v
+	}
+	return props, nil
+}
+
+func (f *file) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	f.d.mu.Lock()
+	defer f.d.mu.Unlock()
+
+	props := f.d.props[f.name]
+	if props == nil {
+		props = make(map[xml.Name]webdav.Property)
+		f.d.props[f.name] = props
+	}
+
+	stat := webdav.Propstat{Status: http.StatusOK}
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			stat.Props = append(stat.Props, webdav.Property{XMLName: p.XMLName})
+			if patch.Remove {
+				delete(props, p.XMLName)
+			} else {
+				props[p.XMLName] = p
+			}
+		}
+	}
+	if len(props) == 0 {
+		delete(f.d.props, f.name)
+	}
+	return []webdav.Propstat{stat}, nil
+}
+
+//按扩展名判断类型，避免为此读取远程文件内容
+func (f *file) ContentType(ctx context.Context) (string, error) {
+	if typ := mime.TypeByExtension(path.Ext(f.name)); typ != "" {
+		return typ, nil
+	}
+	return "", webdav.ErrNotImplemented
+}
@@ -0,0 +1,148 @@
+package dav
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+)
+
+func test_request(t *testing.T, srv *httptest.Server, method, name, body string, header ...string) (int, string) {
+	req, err := http.NewRequest(method, srv.URL+name, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(b)
+}
+
+func Test_Dav(t *testing.T) {
+	fs := new(netfs.MemFs).Init()
+	srv := httptest.NewServer(NewHandler(fs, "/dav"))
+	defer srv.Close()
+
+	if code, _ := test_request(t, srv, "MKCOL", "/dav/a", ""); code != http.StatusCreated {
+		t.Errorf("MKCOL expect:201, get:%d", code)
+	}
+	if code, _ := test_request(t, srv, "PUT", "/dav/a/b.txt", "hello"); code != http.StatusCreated {
+		t.Errorf("PUT expect:201, get:%d", code)
+	}
+	if code, body := test_request(t, srv, "GET", "/dav/a/b.txt", ""); code != http.StatusOK || body != "hello" {
+		t.Errorf("GET expect:200 hello, get:%d %s", code, body)
+	}
+
+	code, body := test_request(t, srv, "PROPFIND", "/dav/a/", "", "Depth", "1")
+	if code != http.StatusMultiStatus || !strings.Contains(body, "/dav/a/b.txt") || !strings.Contains(body, "text/plain") {
+		t.Errorf("PROPFIND expect:207 b.txt, get:%d %s", code, body)
+	}
+
+	//自定义属性随文件移动
+	patch := `<?xml version="1.0"?>
+<D:propertyupdate xmlns:D="DAV:" xmlns:Z="urn:test">
+<D:set><D:prop><Z:color>red</Z:color></D:prop></D:set>
+</D:propertyupdate>`
+	if code, _ := test_request(t, srv, "PROPPATCH", "/dav/a/b.txt", patch); code != http.StatusMultiStatus {
+		t.Errorf("PROPPATCH expect:207, get:%d", code)
+	}
+	if code, _ := test_request(t, srv, "MOVE", "/dav/a", "", "Destination", srv.URL+"/dav/c"); code != http.StatusCreated {
+		t.Errorf("MOVE expect:201, get:%d", code)
+	}
+	if _, err := fs.Stat("/c/b.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+	code, body = test_request(t, srv, "PROPFIND", "/dav/c/b.txt", "", "Depth", "0")
+	if code != http.StatusMultiStatus || !strings.Contains(body, "red") {
+		t.Errorf("PROPFIND expect:207 red, get:%d %s", code, body)
+	}
+
+	//加锁后没有令牌不能修改
+	lock := `<?xml version="1.0"?>
+<D:lockinfo xmlns:D="DAV:">
+<D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype>
+</D:lockinfo>`
+	req, _ := http.NewRequest("LOCK", srv.URL+"/dav/c/b.txt", strings.NewReader(lock))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	token := resp.Header.Get("Lock-Token")
+	if resp.StatusCode != http.StatusOK || token == "" {
+		t.Fatalf("LOCK expect:200, get:%d", resp.StatusCode)
+	}
+
+	if code, _ := test_request(t, srv, "PUT", "/dav/c/b.txt", "x"); code != http.StatusLocked {
+		t.Errorf("PUT expect:423, get:%d", code)
+	}
+	if code, _ := test_request(t, srv, "PUT", "/dav/c/b.txt", "x", "If", "("+token+")"); code != http.StatusCreated {
+		t.Errorf("PUT expect:201, get:%d", code)
+	}
+	if code, _ := test_request(t, srv, "UNLOCK", "/dav/c/b.txt", "", "Lock-Token", token); code != http.StatusNoContent {
+		t.Errorf("UNLOCK expect:204, get:%d", code)
+	}
+
+	if code, _ := test_request(t, srv, "DELETE", "/dav/c", ""); code != http.StatusNoContent {
+		t.Errorf("DELETE expect:204, get:%d", code)
+	}
+	if _, err := fs.Stat("/c"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+}
+
+func Test_Dav_Client(t *testing.T) {
+	fs := new(netfs.MemFs).Init()
+	f, _ := fs.Create("a.txt")
+	f.WriteString("a.txt")
+	f.Close()
+
+	exports := new(netfs.Exports).Init()
+	exports.Add(&netfs.Share{Fs: fs})
+
+	go exports.Listen("127.0.0.1:11132")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := netfs.Dial("127.0.0.1:11132")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	srv := httptest.NewServer(NewHandler(c, ""))
+	defer srv.Close()
+
+	//并发请求共用一个连接
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code, body := test_request(t, srv, "GET", "/a.txt", ""); code != http.StatusOK || body != "a.txt" {
+				t.Errorf("GET expect:200 a.txt, get:%d %s", code, body)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if code, _ := test_request(t, srv, "PUT", "/b.txt", "hello"); code != http.StatusCreated {
+		t.Errorf("PUT expect:201, get:%d", code)
+	}
+	if _, err := fs.Stat("/b.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+}
@@ -40,7 +40,9 @@ func (f *netFile) Close() (err error) {
 
 func (f *Server) f_close() {
 	fid := f.readUint32()
-	err := f.getFile(fid).Close()
+	file := f.getFile(fid)
+	err := file.Close()
+	fileLocks.release(file)
 	f.delFile(fid)
 
 	f.doResponse(FILE_CLOSE)
@@ -58,6 +60,7 @@ func (f *netFile) Read(b []byte) (n int, err error) {
 
 	f.waitResponse(FILE_READ)
 	n = f.readByteTo(b)
+	f.transfer(n, 0)
 	err = f.readError()
 	return
 }
@@ -68,6 +71,8 @@ func (f *Server) f_read() {
 
 	b := make([]byte, int(_len))
 	n, err := f.getFile(fid).Read(b)
+	f.transfer(n, 0)
+	f.throttle(0, n)
 
 	f.doResponse(FILE_READ)
 	f.writeByte(b[:n])
@@ -86,6 +91,7 @@ func (f *netFile) ReadAt(b []byte, off int64) (n int, err error) {
 
 	f.waitResponse(FILE_READAT)
 	n = f.readByteTo(b)
+	f.transfer(n, 0)
 	err = f.readError()
 	return
 }
@@ -97,6 +103,8 @@ func (f *Server) f_readAt() {
 
 	b := make([]byte, int(_len))
 	n, err := f.getFile(fid).ReadAt(b, off)
+	f.transfer(n, 0)
+	f.throttle(0, n)
 
 	f.doResponse(FILE_READAT)
 	f.writeByte(b[:n])
@@ -278,6 +286,7 @@ func (f *netFile) Write(b []byte) (n int, err error) {
 
 	f.waitResponse(FILE_WRITE)
 	n = int(f.readUint32())
+	f.transfer(0, n)
 	err = f.readError()
 	return
 }
@@ -286,7 +295,9 @@ func (f *Server) f_write() {
 	fid := f.readUint32()
 	b := f.readByte()
 
+	f.throttle(0, len(b))
 	n, err := f.getFile(fid).Write(b)
+	f.transfer(0, n)
 
 	f.doResponse(FILE_WRITE)
 	f.writeUint32(uint32(n))
@@ -305,6 +316,7 @@ func (f *netFile) WriteAt(b []byte, off int64) (n int, err error) {
 
 	f.waitResponse(FILE_WRITEAT)
 	n = int(f.readUint32())
+	f.transfer(0, n)
 	err = f.readError()
 	return
 }
@@ -314,7 +326,9 @@ func (f *Server) f_writeAt() {
 	b := f.readByte()
 	off := f.readInt64()
 
+	f.throttle(0, len(b))
 	n, err := f.getFile(fid).WriteAt(b, off)
+	f.transfer(0, n)
 
 	f.doResponse(FILE_WRITEAT)
 	f.writeUint32(uint32(n))
@@ -17,7 +17,7 @@ func (c *Client) Chmod(name string, mode os.FileMode) (err error) {
 }
 
 func (c *Server) fs_chmod() {
-	name := c.readString()
+	name := c.readPath()
 	mode := c.readUint32()
 
 	err := c.fs.Chmod(name, os.FileMode(mode))
@@ -41,7 +41,7 @@ func (c *Client) Chtimes(name string, atime time.Time, mtime time.Time) (err err
 }
 
 func (c *Server) fs_chtimes() {
-	name := c.readString()
+	name := c.readPath()
 	t1 := c.readInt64()
 	t2 := c.readInt64()
 
@@ -65,7 +65,7 @@ func (c *Client) Mkdir(name string, perm os.FileMode) (err error) {
 }
 
 func (c *Server) fs_mkdir() {
-	name := c.readString()
+	name := c.readPath()
 	perm := c.readUint32()
 
 	err := c.fs.Mkdir(name, os.FileMode(perm))
@@ -88,7 +88,7 @@ func (c *Client) MkdirAll(path string, perm os.FileMode) (err error) {
 }
 
 func (c *Server) fs_mkdirAll() {
-	path := c.readString()
+	path := c.readPath()
 	perm := c.readUint32()
 
 	err := c.fs.MkdirAll(path, os.FileMode(perm))
@@ -110,7 +110,7 @@ func (c *Client) Remove(name string) (err error) {
 }
 
 func (c *Server) fs_remove() {
-	name := c.readString()
+	name := c.readPath()
 
 	err := c.fs.Remove(name)
 
@@ -131,7 +131,7 @@ func (c *Client) RemoveAll(path string) (err error) {
 }
 
 func (c *Server) fs_removeAll() {
-	path := c.readString()
+	path := c.readPath()
 
 	err := c.fs.RemoveAll(path)
 
@@ -153,8 +153,8 @@ func (c *Client) Rename(oldpath, newpath string) (err error) {
 }
 
 func (c *Server) fs_rename() {
-	oldpath := c.readString()
-	newpath := c.readString()
+	oldpath := c.readPath()
+	newpath := cleanPath(c.readString())
 
 	err := c.fs.Rename(oldpath, newpath)
 
@@ -176,7 +176,7 @@ func (c *Client) Truncate(name string, size int64) (err error) {
 }
 
 func (c *Server) fs_truncate() {
-	name := c.readString()
+	name := c.readPath()
 	size := c.readInt64()
 
 	err := c.fs.Truncate(name, size)
@@ -202,7 +202,7 @@ func (c *Client) Create(name string) (file File, err error) {
 }
 
 func (c *Server) fs_create() {
-	name := c.readString()
+	name := c.readPath()
 
 	fd, err := c.fs.Create(name)
 	fid := c.addFile(fd)
@@ -227,7 +227,7 @@ func (c *Client) Open(name string) (file File, err error) {
 }
 
 func (c *Server) fs_open() {
-	name := c.readString()
+	name := c.readPath()
 
 	fd, err := c.fs.Open(name)
 	fid := c.addFile(fd)
@@ -255,7 +255,7 @@ func (c *Client) OpenFile(name string, flag int, perm os.FileMode) (file File, e
 }
 
 func (c *Server) fs_openFile() {
-	name := c.readString()
+	name := c.readPath()
 	flag := c.readInt32()
 	perm := c.readUint32()
 
@@ -282,7 +282,7 @@ func (c *Client) Lstat(name string) (fi os.FileInfo, err error) {
 }
 
 func (c *Server) fs_lstat() {
-	name := c.readString()
+	name := c.readPath()
 
 	fi, err := c.fs.Lstat(name)
 
@@ -306,7 +306,7 @@ func (c *Client) Stat(name string) (fi os.FileInfo, err error) {
 }
 
 func (c *Server) fs_stat() {
-	name := c.readString()
+	name := c.readPath()
 
 	fi, err := c.fs.Stat(name)
 
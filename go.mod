@@ -0,0 +1,14 @@
+module github.com/bybzmt/golang-netfs
+
+go 1.25.0
+
+require (
+	github.com/pkg/sftp v1.13.9
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+)
+
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
+)
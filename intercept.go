@@ -0,0 +1,365 @@
+package netfs
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+//会话信息，客户端上 ID 为 0
+type Session struct {
+	ID        uint64
+	Remote    string
+	Principal string
+	Share     string
+}
+
+//一次被拦截的操作
+//Args 为解码后的参数，Results 为除错误外的返回值，顺序与对应方法一致。
+//拦截器可修改 Args(需保持类型)，也可不调用 next 直接设置 Results 与 Err。
+type Call struct {
+	Op      uint8
+	Session *Session
+	Path    string
+	Args    []interface{}
+	Results []interface{}
+	Err     error
+}
+
+func (c *Call) result(i int) interface{} {
+	if i < len(c.Results) {
+		return c.Results[i]
+	}
+	return nil
+}
+
+type Handler func(call *Call)
+
+type Interceptor func(call *Call, next Handler)
+
+//先注册的拦截器在最外层
+func chain(ics []Interceptor, h Handler) Handler {
+	for i := len(ics) - 1; i >= 0; i-- {
+		ic, next := ics[i], h
+		h = func(call *Call) {
+			ic(call, next)
+		}
+	}
+	return h
+}
+
+//让文件系统及其打开的文件的每个操作都经过拦截器
+func Intercept(fs FileSystem, s *Session, ics ...Interceptor) FileSystem {
+	return &interceptFs{FileSystem: fs, session: s, ics: ics}
+}
+
+//所有操作依次进行，使 Client 这类不能并发使用的文件系统可被多个 goroutine 共用
+func Serialize(fs FileSystem) FileSystem {
+	var mu sync.Mutex
+	return Intercept(fs, new(Session), func(call *Call, next Handler) {
+		mu.Lock()
+		defer mu.Unlock()
+		next(call)
+	})
+}
+
+// ----- 服务端 -----
+
+//注册服务端拦截器，按注册顺序由外到内执行，作用于之后选择共享目录的会话
+func (e *Exports) Use(ics ...Interceptor) *Exports {
+	e.mu.Lock()
+	e.interceptors = append(e.interceptors, ics...)
+	e.mu.Unlock()
+	return e
+}
+
+func (c *Server) interceptors() []Interceptor {
+	if c.exports == nil {
+		return nil
+	}
+	c.exports.mu.RLock()
+	defer c.exports.mu.RUnlock()
+	return c.exports.interceptors
+}
+
+func (c *Server) sessionInfo() *Session {
+	s := &Session{ID: c.session, Remote: c.remote, Principal: c.principal}
+	if c.share != nil {
+		s.Share = c.share.Name
+	}
+	return s
+}
+
+func (c *Server) intercepted(fs FileSystem) FileSystem {
+	ics := c.interceptors()
+	if len(ics) == 0 {
+		return fs
+	}
+	return Intercept(fs, c.sessionInfo(), ics...)
+}
+
+//不经过 FileSystem 的请求(LINK_AUTH、LINK_SHARE、FILE_LOCK、FILE_UNLOCK)在分发时经过拦截器
+func (c *Server) intercept(op uint8, path string, args []interface{}, h Handler) *Call {
+	call := &Call{Op: op, Session: c.sessionInfo(), Path: path, Args: args}
+	chain(c.interceptors(), h)(call)
+	return call
+}
+
+// ----- 客户端 -----
+
+//返回经过拦截器的文件系统，操作仍通过该客户端发出
+func (c *Client) Intercept(ics ...Interceptor) FileSystem {
+	s := &Session{Remote: c.conn.conn.RemoteAddr().String(), Principal: c.principal, Share: c.share}
+	return Intercept(c, s, ics...)
+}
+
+// ----- 文件系统 -----
+
+type interceptFs struct {
+	FileSystem
+	session *Session
+	ics     []Interceptor
+}
+
+func (f *interceptFs) do(op uint8, path string, args []interface{}, h Handler) *Call {
+	call := &Call{Op: op, Session: f.session, Path: path, Args: args}
+	chain(f.ics, h)(call)
+	return call
+}
+
+//包装打开的文件，拦截器未返回文件时视为失败
+func (f *interceptFs) file(call *Call) (File, error) {
+	if call.Err != nil {
+		return nil, call.Err
+	}
+	file, ok := call.result(0).(File)
+	if !ok || file == nil {
+		return nil, &os.PathError{Op: "open", Path: call.Path, Err: os.ErrInvalid}
+	}
+	return &interceptFile{File: file, fs: f}, nil
+}
+
+func (f *interceptFs) Watch(name string, recursive bool) (*Watcher, error) {
+	call := f.do(FS_WATCH, name, []interface{}{name, recursive}, func(c *Call) {
+		if fs, ok := f.FileSystem.(WatchFs); ok {
+			w, err := fs.Watch(c.Args[0].(string), c.Args[1].(bool))
+			c.Results, c.Err = []interface{}{w}, err
+		} else {
+			c.Err = errors.New("Watch Not Supported")
+		}
+	})
+	w, _ := call.result(0).(*Watcher)
+	return w, call.Err
+}
+
+func (f *interceptFs) Chmod(name string, mode os.FileMode) error {
+	return f.do(FS_CHMOD, name, []interface{}{name, mode}, func(c *Call) {
+		c.Err = f.FileSystem.Chmod(c.Args[0].(string), c.Args[1].(os.FileMode))
+	}).Err
+}
+
+func (f *interceptFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return f.do(FS_CHTIMES, name, []interface{}{name, atime, mtime}, func(c *Call) {
+		c.Err = f.FileSystem.Chtimes(c.Args[0].(string), c.Args[1].(time.Time), c.Args[2].(time.Time))
+	}).Err
+}
+
+func (f *interceptFs) Mkdir(name string, perm os.FileMode) error {
+	return f.do(FS_MKDIR, name, []interface{}{name, perm}, func(c *Call) {
+		c.Err = f.FileSystem.Mkdir(c.Args[0].(string), c.Args[1].(os.FileMode))
+	}).Err
+}
+
+func (f *interceptFs) MkdirAll(path string, perm os.FileMode) error {
+	return f.do(FS_MKDIRALL, path, []interface{}{path, perm}, func(c *Call) {
+		c.Err = f.FileSystem.MkdirAll(c.Args[0].(string), c.Args[1].(os.FileMode))
+	}).Err
+}
+
+func (f *interceptFs) Remove(name string) error {
+	return f.do(FS_REMOVE, name, []interface{}{name}, func(c *Call) {
+		c.Err = f.FileSystem.Remove(c.Args[0].(string))
+	}).Err
+}
+
+func (f *interceptFs) RemoveAll(path string) error {
+	return f.do(FS_REMOVEALL, path, []interface{}{path}, func(c *Call) {
+		c.Err = f.FileSystem.RemoveAll(c.Args[0].(string))
+	}).Err
+}
+
+func (f *interceptFs) Rename(oldpath, newpath string) error {
+	return f.do(FS_RENAME, oldpath, []interface{}{oldpath, newpath}, func(c *Call) {
+		c.Err = f.FileSystem.Rename(c.Args[0].(string), c.Args[1].(string))
+	}).Err
+}
+
+func (f *interceptFs) Truncate(name string, size int64) error {
+	return f.do(FS_TRUNCATE, name, []interface{}{name, size}, func(c *Call) {
+		c.Err = f.FileSystem.Truncate(c.Args[0].(string), c.Args[1].(int64))
+	}).Err
+}
+
+func (f *interceptFs) Create(name string) (File, error) {
+	return f.file(f.do(FS_CREATE, name, []interface{}{name}, func(c *Call) {
+		file, err := f.FileSystem.Create(c.Args[0].(string))
+		c.Results, c.Err = []interface{}{file}, err
+	}))
+}
+
+func (f *interceptFs) Open(name string) (File, error) {
+	return f.file(f.do(FS_OPEN, name, []interface{}{name}, func(c *Call) {
+		file, err := f.FileSystem.Open(c.Args[0].(string))
+		c.Results, c.Err = []interface{}{file}, err
+	}))
+}
+
+func (f *interceptFs) OpenFile(name string, flag int, perm os.FileMode) (File, error) {
+	return f.file(f.do(FS_OPENFILE, name, []interface{}{name, flag, perm}, func(c *Call) {
+		file, err := f.FileSystem.OpenFile(c.Args[0].(string), c.Args[1].(int), c.Args[2].(os.FileMode))
+		c.Results, c.Err = []interface{}{file}, err
+	}))
+}
+
+func (f *interceptFs) Stat(name string) (os.FileInfo, error) {
+	call := f.do(FS_STAT, name, []interface{}{name}, func(c *Call) {
+		fi, err := f.FileSystem.Stat(c.Args[0].(string))
+		c.Results, c.Err = []interface{}{fi}, err
+	})
+	fi, _ := call.result(0).(os.FileInfo)
+	return fi, call.Err
+}
+
+func (f *interceptFs) Lstat(name string) (os.FileInfo, error) {
+	call := f.do(FS_LSTAT, name, []interface{}{name}, func(c *Call) {
+		fi, err := f.FileSystem.Lstat(c.Args[0].(string))
+		c.Results, c.Err = []interface{}{fi}, err
+	})
+	fi, _ := call.result(0).(os.FileInfo)
+	return fi, call.Err
+}
+
+// ----- 文件对象 -----
+
+//FILE_LOCK/FILE_UNLOCK 由服务端在分发时经过拦截器
+type interceptFile struct {
+	File
+	fs *interceptFs
+}
+
+func (f *interceptFile) do(op uint8, args []interface{}, h Handler) *Call {
+	return f.fs.do(op, f.File.Name(), args, h)
+}
+
+func (f *interceptFile) Chmod(mode os.FileMode) error {
+	return f.do(FILE_CHMOD, []interface{}{mode}, func(c *Call) {
+		c.Err = f.File.Chmod(c.Args[0].(os.FileMode))
+	}).Err
+}
+
+func (f *interceptFile) Close() error {
+	return f.do(FILE_CLOSE, nil, func(c *Call) {
+		c.Err = f.File.Close()
+	}).Err
+}
+
+func (f *interceptFile) Read(b []byte) (int, error) {
+	call := f.do(FILE_READ, []interface{}{b}, func(c *Call) {
+		n, err := f.File.Read(c.Args[0].([]byte))
+		c.Results, c.Err = []interface{}{n}, err
+	})
+	n, _ := call.result(0).(int)
+	return n, call.Err
+}
+
+func (f *interceptFile) ReadAt(b []byte, off int64) (int, error) {
+	call := f.do(FILE_READAT, []interface{}{b, off}, func(c *Call) {
+		n, err := f.File.ReadAt(c.Args[0].([]byte), c.Args[1].(int64))
+		c.Results, c.Err = []interface{}{n}, err
+	})
+	n, _ := call.result(0).(int)
+	return n, call.Err
+}
+
+func (f *interceptFile) Readdir(n int) ([]os.FileInfo, error) {
+	call := f.do(FILE_READDIR, []interface{}{n}, func(c *Call) {
+		fis, err := f.File.Readdir(c.Args[0].(int))
+		c.Results, c.Err = []interface{}{fis}, err
+	})
+	fis, _ := call.result(0).([]os.FileInfo)
+	return fis, call.Err
+}
+
+func (f *interceptFile) Readdirnames(n int) ([]string, error) {
+	call := f.do(FILE_READDIRNAMES, []interface{}{n}, func(c *Call) {
+		names, err := f.File.Readdirnames(c.Args[0].(int))
+		c.Results, c.Err = []interface{}{names}, err
+	})
+	names, _ := call.result(0).([]string)
+	return names, call.Err
+}
+
+func (f *interceptFile) Seek(offset int64, whence int) (int64, error) {
+	call := f.do(FILE_SEEK, []interface{}{offset, whence}, func(c *Call) {
+		ret, err := f.File.Seek(c.Args[0].(int64), c.Args[1].(int))
+		c.Results, c.Err = []interface{}{ret}, err
+	})
+	ret, _ := call.result(0).(int64)
+	return ret, call.Err
+}
+
+func (f *interceptFile) Stat() (os.FileInfo, error) {
+	call := f.do(FILE_STAT, nil, func(c *Call) {
+		fi, err := f.File.Stat()
+		c.Results, c.Err = []interface{}{fi}, err
+	})
+	fi, _ := call.result(0).(os.FileInfo)
+	return fi, call.Err
+}
+
+func (f *interceptFile) Sync() error {
+	return f.do(FILE_SYNC, nil, func(c *Call) {
+		c.Err = f.File.Sync()
+	}).Err
+}
+
+func (f *interceptFile) Truncate(size int64) error {
+	return f.do(FILE_TRUNCATE, []interface{}{size}, func(c *Call) {
+		c.Err = f.File.Truncate(c.Args[0].(int64))
+	}).Err
+}
+
+func (f *interceptFile) Write(b []byte) (int, error) {
+	call := f.do(FILE_WRITE, []interface{}{b}, func(c *Call) {
+		n, err := f.File.Write(c.Args[0].([]byte))
+		c.Results, c.Err = []interface{}{n}, err
+	})
+	n, _ := call.result(0).(int)
+	return n, call.Err
+}
+
+func (f *interceptFile) WriteAt(b []byte, off int64) (int, error) {
+	call := f.do(FILE_WRITEAT, []interface{}{b, off}, func(c *Call) {
+		n, err := f.File.WriteAt(c.Args[0].([]byte), c.Args[1].(int64))
+		c.Results, c.Err = []interface{}{n}, err
+	})
+	n, _ := call.result(0).(int)
+	return n, call.Err
+}
+
+func (f *interceptFile) WriteString(s string) (int, error) {
+	return f.Write([]byte(s))
+}
+
+func (f *interceptFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *interceptFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *interceptFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
@@ -0,0 +1,159 @@
+package netfs
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func Test_Intercept(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+
+	exports := new(Exports).Init()
+	exports.Add(&Share{Fs: test_mem_fs(t, "a.txt")})
+
+	//按注册顺序由外到内
+	exports.Use(func(call *Call, next Handler) {
+		mu.Lock()
+		trace = append(trace, "outer:"+OpName(call.Op))
+		mu.Unlock()
+		next(call)
+	}, func(call *Call, next Handler) {
+		mu.Lock()
+		trace = append(trace, "inner:"+call.Path)
+		mu.Unlock()
+
+		//拒绝未认证的删除
+		if call.Op == FS_REMOVE && call.Session.Principal == "" {
+			call.Err = &os.PathError{Op: "remove", Path: call.Path, Err: os.ErrPermission}
+			return
+		}
+		next(call)
+	})
+
+	go exports.Listen("127.0.0.1:11128")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+	if err := c.Remove("a.txt"); !os.IsPermission(err) {
+		t.Errorf("Remove expect:permission denied, get:%v", err)
+	}
+
+	mu.Lock()
+	s := strings.Join(trace, ",")
+	mu.Unlock()
+	if s != "outer:fs_stat,inner:a.txt,outer:fs_remove,inner:a.txt" {
+		t.Errorf("Trace expect:outer:fs_stat,inner:a.txt,..., get:%s", s)
+	}
+
+	//客户端：改写参数并注入错误
+	fs := c.Intercept(func(call *Call, next Handler) {
+		if call.Op == FS_STAT {
+			call.Args[0] = "a.txt"
+		}
+		if call.Op == FILE_READ {
+			call.Err = errors.New("injected")
+			return
+		}
+		next(call)
+	})
+
+	fi, err := fs.Stat("other.txt")
+	if err != nil || fi.Name() != "a.txt" {
+		t.Errorf("Stat expect:a.txt, get:%v %v", fi, err)
+	}
+
+	f, err := fs.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Read(make([]byte, 10)); err == nil || err.Error() != "injected" {
+		t.Errorf("Read expect:injected, get:%v", err)
+	}
+	if n, err := f.ReadAt(make([]byte, 10), 0); n != 5 {
+		t.Errorf("ReadAt expect:5, get:%d %v", n, err)
+	}
+}
+
+func Test_Intercept_Link(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+
+	exports := new(Exports).Init()
+	exports.Auth = func(principal, secret string) bool {
+		return secret == "pw"
+	}
+	exports.Add(&Share{Fs: test_mem_fs(t, "a.txt")})
+	exports.Add(&Share{Name: "x", Fs: test_mem_fs(t)})
+
+	exports.Use(func(call *Call, next Handler) {
+		switch call.Op {
+		case LINK_AUTH, LINK_SHARE, FILE_LOCK, FILE_UNLOCK:
+			mu.Lock()
+			trace = append(trace, OpName(call.Op)+":"+call.Path+":"+call.Session.Principal)
+			mu.Unlock()
+		}
+
+		//拒绝切换到 x
+		if call.Op == LINK_SHARE && call.Args[0] == "x" {
+			call.Err = &os.PathError{Op: "share", Path: call.Path, Err: os.ErrPermission}
+			return
+		}
+		next(call)
+	})
+
+	go exports.Listen("127.0.0.1:11136")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11136")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Auth("bob", "pw"); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := c.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	l := f.(FileLocker)
+	if err := l.TryLock(LOCK_EX, 0, 0); err != nil {
+		t.Errorf("TryLock expect:nil, get:%v", err)
+	}
+	if err := l.Unlock(0, 0); err != nil {
+		t.Errorf("Unlock expect:nil, get:%v", err)
+	}
+
+	if _, err := c.Share("x"); !os.IsPermission(err) {
+		t.Errorf("Share expect:permission denied, get:%v", err)
+	}
+
+	mu.Lock()
+	s := strings.Join(trace, ",")
+	mu.Unlock()
+
+	//Share 重新连接后会再次认证
+	expect := "link_auth:bob:,file_lock:a.txt:bob,file_unlock:a.txt:bob,link_auth:bob:,link_share:x:bob"
+	if s != expect {
+		t.Errorf("Trace expect:%s, get:%s", expect, s)
+	}
+}
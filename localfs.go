@@ -15,69 +15,85 @@ func (l *LocalFs) Init(rootPath string) *LocalFs {
 	return l
 }
 
+//本地路径，.. 不能越过 RootPath
+func (l *LocalFs) realPath(name string) string {
+	return path.Join(l.RootPath, path.Clean("/"+name))
+}
+
 func (l *LocalFs) Chmod(name string, mode os.FileMode) error {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Chmod(_name, mode)
 }
 
 func (l *LocalFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Chtimes(_name, atime, mtime)
 }
 
 func (l *LocalFs) Mkdir(name string, perm os.FileMode) error {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Mkdir(_name, perm)
 }
 
 func (l *LocalFs) MkdirAll(pathName string, perm os.FileMode) error {
-	_path := path.Join(l.RootPath, pathName)
+	_path := l.realPath(pathName)
 	return os.MkdirAll(_path, perm)
 }
 
 func (l *LocalFs) Remove(name string) error {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Remove(_name)
 }
 
 func (l *LocalFs) RemoveAll(pathName string) error {
-	_path := path.Join(l.RootPath, pathName)
+	_path := l.realPath(pathName)
 	return os.RemoveAll(_path)
 }
 
 func (l *LocalFs) Rename(oldpath, newpath string) error {
-	_oldpath := path.Join(l.RootPath, oldpath)
-	_newpath := path.Join(l.RootPath, newpath)
+	_oldpath := l.realPath(oldpath)
+	_newpath := l.realPath(newpath)
 	return os.Rename(_oldpath, _newpath)
 }
 
 func (l *LocalFs) Truncate(name string, size int64) error {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Truncate(_name, size)
 }
 
 func (l *LocalFs) Create(name string) (file File, err error) {
-	_name := path.Join(l.RootPath, name)
-	return os.Create(_name)
+	_name := l.realPath(name)
+	return localOpen(os.Create(_name))
 }
 
 func (l *LocalFs) Open(name string) (file File, err error) {
-	_name := path.Join(l.RootPath, name)
-	return os.Open(_name)
+	_name := l.realPath(name)
+	return localOpen(os.Open(_name))
 }
 
 func (l *LocalFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
-	_name := path.Join(l.RootPath, name)
-	return os.OpenFile(_name, flag, perm)
+	_name := l.realPath(name)
+	return localOpen(os.OpenFile(_name, flag, perm))
 }
 
 func (l *LocalFs) Stat(name string) (fi os.FileInfo, err error) {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Stat(_name)
 }
 
 func (l *LocalFs) Lstat(name string) (fi os.FileInfo, err error) {
-	_name := path.Join(l.RootPath, name)
+	_name := l.realPath(name)
 	return os.Lstat(_name)
 }
 
+//本地文件对象，在支持的平台上提供建议锁
+type localFile struct {
+	*os.File
+}
+
+func localOpen(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &localFile{f}, nil
+}
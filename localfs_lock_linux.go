@@ -0,0 +1,54 @@
+//go:build linux
+// +build linux
+
+package netfs
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+//open file description 锁，属于打开的文件对象而不是进程，
+//同一进程内不同会话打开的文件之间也能互斥，文件关闭时自动释放
+const (
+	f_OFD_SETLK  = 37
+	f_OFD_SETLKW = 38
+)
+
+func (f *localFile) fcntlLock(cmd int, typ int16, off, length int64) error {
+	lk := syscall.Flock_t{
+		Type:   typ,
+		Whence: io.SeekStart,
+		Start:  off,
+		Len:    length,
+	}
+
+	err := syscall.FcntlFlock(f.Fd(), cmd, &lk)
+	if err == syscall.EACCES {
+		err = syscall.EAGAIN
+	}
+	if err != nil {
+		return &os.PathError{Op: "lock", Path: f.Name(), Err: err}
+	}
+	return nil
+}
+
+func lockFcntlType(typ LockType) int16 {
+	if typ == LOCK_EX {
+		return syscall.F_WRLCK
+	}
+	return syscall.F_RDLCK
+}
+
+func (f *localFile) Lock(typ LockType, off, length int64) error {
+	return f.fcntlLock(f_OFD_SETLKW, lockFcntlType(typ), off, length)
+}
+
+func (f *localFile) TryLock(typ LockType, off, length int64) error {
+	return f.fcntlLock(f_OFD_SETLK, lockFcntlType(typ), off, length)
+}
+
+func (f *localFile) Unlock(off, length int64) error {
+	return f.fcntlLock(f_OFD_SETLK, syscall.F_UNLCK, off, length)
+}
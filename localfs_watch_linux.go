@@ -0,0 +1,208 @@
+//go:build linux
+// +build linux
+
+package netfs
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_DELETE_SELF | syscall.IN_MOVED_FROM |
+	syscall.IN_MOVE_SELF | syscall.IN_ATTRIB
+
+//通过 inotify 监视本地文件，可感知所有来源的修改
+func (l *LocalFs) Watch(name string, recursive bool) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	n := &inotify{
+		fs:        l,
+		file:      os.NewFile(uintptr(fd), "inotify"),
+		fd:        fd,
+		recursive: recursive,
+		wds:       make(map[int32]string),
+	}
+
+	p := watchClean(name)
+	if err := n.add(p); err != nil {
+		n.file.Close()
+		return nil, err
+	}
+
+	w := newWatcher(n.file.Close)
+	go n.run(w)
+
+	return w, nil
+}
+
+type inotify struct {
+	fs        *LocalFs
+	file      *os.File
+	fd        int
+	recursive bool
+
+	mu  sync.Mutex
+	wds map[int32]string
+}
+
+func (n *inotify) add(p string) error {
+	_path := n.fs.realPath(p)
+
+	wd, err := syscall.InotifyAddWatch(n.fd, _path, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "watch", Path: p, Err: err}
+	}
+
+	n.mu.Lock()
+	n.wds[int32(wd)] = p
+	n.mu.Unlock()
+
+	if !n.recursive {
+		return nil
+	}
+
+	return filepath.Walk(_path, func(sub string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() || sub == _path {
+			return nil
+		}
+
+		rel, err := filepath.Rel(n.fs.RootPath, sub)
+		if err != nil {
+			return nil
+		}
+		rel = watchClean(filepath.ToSlash(rel))
+
+		wd, err := syscall.InotifyAddWatch(n.fd, sub, inotifyMask)
+		if err == nil {
+			n.mu.Lock()
+			n.wds[int32(wd)] = rel
+			n.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+func (n *inotify) run(w *Watcher) {
+	defer close(w.Errors)
+	defer close(w.Events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			select {
+			case <-w.done:
+			default:
+				w.sendError(err)
+			}
+			return
+		}
+
+		for off := 0; off+syscall.SizeofInotifyEvent <= size; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameLen := int(raw.Len)
+			off += syscall.SizeofInotifyEvent
+
+			var name string
+			if nameLen > 0 {
+				name = strings.TrimRight(string(buf[off:off+nameLen]), "\x00")
+			}
+			off += nameLen
+
+			n.event(w, raw.Wd, raw.Mask, name)
+		}
+	}
+}
+
+func (n *inotify) event(w *Watcher, wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.sendError(ErrEventOverflow)
+		return
+	}
+
+	n.mu.Lock()
+	dir, ok := n.wds[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(n.wds, wd)
+	}
+	n.mu.Unlock()
+
+	if !ok || mask&syscall.IN_IGNORED != 0 {
+		return
+	}
+
+	p := dir
+	if name != "" {
+		p = path.Join(dir, name)
+	}
+
+	//自身的删除或移动事件已由上级目录报告
+	if name == "" && mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 && dir != "/" {
+		if n.watching(path.Dir(dir)) {
+			return
+		}
+	}
+
+	var op EventOp
+	switch {
+	case mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0:
+		op = EVENT_CREATE
+	case mask&syscall.IN_MODIFY != 0:
+		op = EVENT_WRITE
+	case mask&(syscall.IN_DELETE|syscall.IN_DELETE_SELF) != 0:
+		op = EVENT_REMOVE
+	case mask&(syscall.IN_MOVED_FROM|syscall.IN_MOVE_SELF) != 0:
+		op = EVENT_RENAME
+	case mask&syscall.IN_ATTRIB != 0:
+		op = EVENT_CHMOD
+	default:
+		return
+	}
+
+	//移走的目录不再以原路径监视，移入的目录按新路径重新监视
+	if mask&(syscall.IN_MOVED_FROM|syscall.IN_ISDIR) == syscall.IN_MOVED_FROM|syscall.IN_ISDIR {
+		n.remove(p)
+	}
+
+	//新建的子目录也需要监视
+	if n.recursive && op == EVENT_CREATE && mask&syscall.IN_ISDIR != 0 {
+		n.add(p)
+	}
+
+	w.send(Event{p, op})
+}
+
+//移除 p 及其下所有目录的监视
+func (n *inotify) remove(p string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for wd, v := range n.wds {
+		if v == p || strings.HasPrefix(v, p+"/") {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.wds, wd)
+		}
+	}
+}
+
+func (n *inotify) watching(p string) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, v := range n.wds {
+		if v == p {
+			return true
+		}
+	}
+	return false
+}
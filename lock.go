@@ -0,0 +1,304 @@
+package netfs
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type LockType uint8
+
+const (
+	LOCK_SH LockType = iota + 1 //共享锁
+	LOCK_EX                     //排它锁
+)
+
+//支持建议锁的文件对象
+//off 与 length 指定锁定范围，length 为 0 表示直到文件末尾(包括以后追加的部分)，
+//TryLock 在冲突时立即返回 EAGAIN 错误，Lock 则一直等待
+type FileLocker interface {
+	Lock(typ LockType, off, length int64) error
+	TryLock(typ LockType, off, length int64) error
+	Unlock(off, length int64) error
+}
+
+//包装的文件对象转发锁操作，内层不支持锁时返回 errNoLock，服务端据此改用进程内的锁表
+var errNoLock = errors.New("Lock Not Supported")
+
+func fileLock(f File, typ LockType, off, length int64) error {
+	if l, ok := f.(FileLocker); ok {
+		return l.Lock(typ, off, length)
+	}
+	return errNoLock
+}
+
+func fileTryLock(f File, typ LockType, off, length int64) error {
+	if l, ok := f.(FileLocker); ok {
+		return l.TryLock(typ, off, length)
+	}
+	return errNoLock
+}
+
+func fileUnlock(f File, off, length int64) error {
+	if l, ok := f.(FileLocker); ok {
+		return l.Unlock(off, length)
+	}
+	return errNoLock
+}
+
+//服务端单次等待锁的最长时间，超时后由客户端重新发起
+var LockWait = 3 * time.Second
+
+func lockRange(off, length int64) (start, end int64) {
+	if length <= 0 {
+		return off, math.MaxInt64
+	}
+	return off, off + length
+}
+
+func errLocked(name string) error {
+	return &os.PathError{Op: "lock", Path: name, Err: syscall.EAGAIN}
+}
+
+func isLocked(err error) bool {
+	if e, ok := err.(*os.PathError); ok {
+		err = e.Err
+	}
+	return err == syscall.EAGAIN
+}
+
+// ----- 进程内的锁表，用于不支持锁的文件对象 -----
+
+type lockKey struct {
+	fs   FileSystem
+	name string
+}
+
+type lockItem struct {
+	owner interface{}
+	typ   LockType
+	start int64
+	end   int64
+}
+
+type lockTable struct {
+	mu      sync.Mutex
+	locks   map[lockKey][]lockItem
+	owners  map[interface{}]lockKey
+	changed chan struct{}
+}
+
+var fileLocks = &lockTable{
+	locks:   make(map[lockKey][]lockItem),
+	owners:  make(map[interface{}]lockKey),
+	changed: make(chan struct{}),
+}
+
+func (t *lockTable) tryLock(key lockKey, owner interface{}, typ LockType, start, end int64) bool {
+	for _, l := range t.locks[key] {
+		if l.owner == owner || l.end <= start || end <= l.start {
+			continue
+		}
+		if typ == LOCK_EX || l.typ == LOCK_EX {
+			return false
+		}
+	}
+
+	t.remove(key, owner, start, end)
+	t.locks[key] = append(t.locks[key], lockItem{owner, typ, start, end})
+	t.owners[owner] = key
+	return true
+}
+
+//等待到 deadline 为止，deadline 为零值时不等待
+func (t *lockTable) lock(key lockKey, owner interface{}, typ LockType, start, end int64, deadline time.Time) bool {
+	for {
+		t.mu.Lock()
+		ok := t.tryLock(key, owner, typ, start, end)
+		changed := t.changed
+		t.mu.Unlock()
+
+		if ok {
+			return true
+		}
+
+		wait := deadline.Sub(time.Now())
+		if wait <= 0 {
+			return false
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+//解除范围内的锁并唤醒等待者，调用方需持有锁
+func (t *lockTable) unlock(key lockKey, owner interface{}, start, end int64) {
+	t.remove(key, owner, start, end)
+	t.broadcast()
+}
+
+//部分重叠时拆分
+func (t *lockTable) remove(key lockKey, owner interface{}, start, end int64) {
+	list := t.locks[key]
+	var out []lockItem
+
+	for _, l := range list {
+		if l.owner != owner || l.end <= start || end <= l.start {
+			out = append(out, l)
+			continue
+		}
+		if l.start < start {
+			out = append(out, lockItem{owner, l.typ, l.start, start})
+		}
+		if end < l.end {
+			out = append(out, lockItem{owner, l.typ, end, l.end})
+		}
+	}
+
+	if len(out) == 0 {
+		delete(t.locks, key)
+	} else {
+		t.locks[key] = out
+	}
+}
+
+//释放某个文件对象持有的全部锁
+func (t *lockTable) release(owner interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key, ok := t.owners[owner]
+	if !ok {
+		return
+	}
+	delete(t.owners, owner)
+
+	t.unlock(key, owner, 0, math.MaxInt64)
+}
+
+func (t *lockTable) broadcast() {
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// ----- 网络传输 -----
+
+func (f *netFile) Lock(typ LockType, off, length int64) (err error) {
+	for {
+		err = f.lock(typ, off, length, true)
+		if !isLocked(err) {
+			return err
+		}
+	}
+}
+
+func (f *netFile) TryLock(typ LockType, off, length int64) (err error) {
+	return f.lock(typ, off, length, false)
+}
+
+func (f *netFile) lock(typ LockType, off, length int64, wait bool) (err error) {
+	defer onPanic(&err)
+
+	f.doRequest(FILE_LOCK)
+	f.writeUint32(f.fid)
+	f.writeUint8(uint8(typ))
+	f.writeInt64(off)
+	f.writeInt64(length)
+	f.writeBool(wait)
+
+	f.waitResponse(FILE_LOCK)
+	return f.readError()
+}
+
+func (f *Server) f_lock() {
+	fid := f.readUint32()
+	typ := LockType(f.readUint8())
+	off := f.readInt64()
+	length := f.readInt64()
+	wait := f.readBool()
+
+	file := f.getFile(fid)
+	call := f.intercept(FILE_LOCK, file.Name(), []interface{}{typ, off, length, wait}, func(call *Call) {
+		if typ != LOCK_SH && typ != LOCK_EX {
+			call.Err = &os.PathError{Op: "lock", Path: file.Name(), Err: syscall.EINVAL}
+			return
+		}
+
+		err := fileTryLock(file, typ, off, length)
+		for deadline := time.Now().Add(LockWait); wait && isLocked(err) && time.Now().Before(deadline); {
+			time.Sleep(50 * time.Millisecond)
+			err = fileTryLock(file, typ, off, length)
+		}
+
+		if err == errNoLock {
+			var deadline time.Time
+			if wait {
+				deadline = time.Now().Add(LockWait)
+			}
+
+			start, end := lockRange(off, length)
+			err = nil
+			if !fileLocks.lock(f.lockKey(file), file, typ, start, end, deadline) {
+				err = errLocked(file.Name())
+			}
+		}
+		call.Err = err
+	})
+
+	f.doResponse(FILE_LOCK)
+	f.writeError(call.Err)
+}
+
+//----------------
+
+func (f *netFile) Unlock(off, length int64) (err error) {
+	defer onPanic(&err)
+
+	f.doRequest(FILE_UNLOCK)
+	f.writeUint32(f.fid)
+	f.writeInt64(off)
+	f.writeInt64(length)
+
+	f.waitResponse(FILE_UNLOCK)
+	return f.readError()
+}
+
+func (f *Server) f_unlock() {
+	fid := f.readUint32()
+	off := f.readInt64()
+	length := f.readInt64()
+
+	file := f.getFile(fid)
+	call := f.intercept(FILE_UNLOCK, file.Name(), []interface{}{off, length}, func(call *Call) {
+		if call.Err = fileUnlock(file, off, length); call.Err == errNoLock {
+			call.Err = nil
+			start, end := lockRange(off, length)
+
+			fileLocks.mu.Lock()
+			fileLocks.unlock(f.lockKey(file), file, start, end)
+			fileLocks.mu.Unlock()
+		}
+	})
+
+	f.doResponse(FILE_UNLOCK)
+	f.writeError(call.Err)
+}
+
+func (f *Server) lockKey(file File) lockKey {
+	//各会话的 fs 可能是按用户包装的，以共享目录区分
+	fs := f.fs
+	if f.share != nil {
+		fs = f.share.fs
+	}
+	return lockKey{fs, path.Clean("/" + file.Name())}
+}
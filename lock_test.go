@@ -0,0 +1,178 @@
+package netfs
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func test_is_locked(err error) bool {
+	e, ok := err.(*os.PathError)
+	return ok && e.Err == syscall.EAGAIN
+}
+
+func Test_Lock(t *testing.T) {
+	go Listen("127.0.0.1:11122", new(MemFs).Init())
+	time.Sleep(100 * time.Millisecond)
+
+	c1, err := Dial("127.0.0.1:11122")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+
+	c2, err := Dial("127.0.0.1:11122")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+
+	f1, err := c1.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f2, err := c2.OpenFile("a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+
+	l1 := f1.(FileLocker)
+	l2 := f2.(FileLocker)
+
+	if err := l1.TryLock(LOCK_EX, 0, 10); err != nil {
+		t.Errorf("TryLock expect:nil, get:%v", err)
+	}
+	if err := l2.TryLock(LOCK_SH, 5, 1); !test_is_locked(err) {
+		t.Errorf("TryLock expect:EAGAIN, get:%v", err)
+	}
+	if err := l2.TryLock(LOCK_EX, 10, 10); err != nil {
+		t.Errorf("TryLock byte-range expect:nil, get:%v", err)
+	}
+
+	//解锁部分范围
+	if err := l1.Unlock(0, 5); err != nil {
+		t.Errorf("Unlock expect:nil, get:%v", err)
+	}
+	if err := l2.TryLock(LOCK_SH, 0, 5); err != nil {
+		t.Errorf("TryLock expect:nil, get:%v", err)
+	}
+
+	//关闭后自动释放，等待中的 Lock 获得锁
+	done := make(chan error)
+	go func() {
+		done <- l2.Lock(LOCK_EX, 0, 0)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	f1.Close()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Lock expect:nil, get:%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Lock expect:nil, get:timeout")
+	}
+}
+
+func Test_LocalFs_Lock(t *testing.T) {
+	local, clean := test_local_fs(t, "a.txt")
+	defer clean()
+
+	f1, err := local.OpenFile("a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f1.Close()
+
+	f2, err := local.OpenFile("a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f2.Close()
+
+	l1, ok := f1.(FileLocker)
+	if !ok {
+		t.Skip("LocalFs locking not supported")
+	}
+	l2 := f2.(FileLocker)
+
+	if err := l1.TryLock(LOCK_SH, 0, 0); err != nil {
+		t.Errorf("TryLock expect:nil, get:%v", err)
+	}
+	if err := l2.TryLock(LOCK_SH, 0, 0); err != nil {
+		t.Errorf("TryLock shared expect:nil, get:%v", err)
+	}
+	if err := l2.TryLock(LOCK_EX, 0, 0); !test_is_locked(err) {
+		t.Errorf("TryLock expect:EAGAIN, get:%v", err)
+	}
+
+	l1.Unlock(0, 0)
+
+	if err := l2.TryLock(LOCK_EX, 0, 0); err != nil {
+		t.Errorf("TryLock expect:nil, get:%v", err)
+	}
+}
+
+func Test_Lock_Wrapped(t *testing.T) {
+	local, clean := test_local_fs(t, "a.txt")
+	defer clean()
+
+	f, err := local.OpenFile("a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	l, ok := f.(FileLocker)
+	if !ok {
+		t.Skip("LocalFs locking not supported")
+	}
+
+	audit, err := new(AuditLog).Init(filepath.Join(local.RootPath, "audit.log"), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer audit.Close()
+
+	//经过拦截器、配额与审计包装的文件仍使用 LocalFs 的锁
+	exports := new(Exports).Init()
+	exports.Audit = audit
+	exports.Use(func(call *Call, next Handler) {
+		next(call)
+	})
+	exports.Add(&Share{Fs: local, Quota: &Quota{Export: QuotaLimit{Bytes: 1 << 20}}})
+
+	go exports.Listen("127.0.0.1:11143")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11143")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	rf, err := c.OpenFile("a.txt", os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+
+	if err := rf.(FileLocker).TryLock(LOCK_EX, 0, 0); err != nil {
+		t.Fatalf("TryLock expect:nil, get:%v", err)
+	}
+	if err := l.TryLock(LOCK_SH, 0, 0); !test_is_locked(err) {
+		t.Errorf("Local TryLock expect:EAGAIN, get:%v", err)
+	}
+
+	if err := rf.(FileLocker).Unlock(0, 0); err != nil {
+		t.Errorf("Unlock expect:nil, get:%v", err)
+	}
+	if err := l.TryLock(LOCK_SH, 0, 0); err != nil {
+		t.Errorf("Local TryLock expect:nil, get:%v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package netfs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//日志接口，args 为交替的键值对
+//方法签名与 log/slog 的 *slog.Logger 一致，可直接使用 slog.Default()
+type Log interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+type LogLevel int
+
+const (
+	LOG_DEBUG LogLevel = iota
+	LOG_INFO
+	LOG_WARN
+	LOG_ERROR
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LOG_DEBUG:
+		return "DEBUG"
+	case LOG_INFO:
+		return "INFO"
+	case LOG_WARN:
+		return "WARN"
+	case LOG_ERROR:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+//默认日志，未单独指定时服务端使用，设为 nil 时不记录
+var Logger Log = new(TextLog).Init(os.Stderr, LOG_INFO)
+
+func getLog() Log {
+	if Logger == nil {
+		return NopLog{}
+	}
+	return Logger
+}
+
+//不输出任何内容的日志
+type NopLog struct{}
+
+func (NopLog) Debug(msg string, args ...interface{}) {}
+func (NopLog) Info(msg string, args ...interface{})  {}
+func (NopLog) Warn(msg string, args ...interface{})  {}
+func (NopLog) Error(msg string, args ...interface{}) {}
+
+//每行一条的文本日志：时间 级别 消息 key=value ...
+type TextLog struct {
+	Level LogLevel
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *TextLog) Init(w io.Writer, level LogLevel) *TextLog {
+	l.w = w
+	l.Level = level
+	return l
+}
+
+func (l *TextLog) Debug(msg string, args ...interface{}) { l.log(LOG_DEBUG, msg, args) }
+func (l *TextLog) Info(msg string, args ...interface{})  { l.log(LOG_INFO, msg, args) }
+func (l *TextLog) Warn(msg string, args ...interface{})  { l.log(LOG_WARN, msg, args) }
+func (l *TextLog) Error(msg string, args ...interface{}) { l.log(LOG_ERROR, msg, args) }
+
+func (l *TextLog) log(level LogLevel, msg string, args []interface{}) {
+	if level < l.Level {
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006-01-02T15:04:05.000Z07:00"))
+	b.WriteByte(' ')
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(logQuote(msg))
+
+	for i := 0; i < len(args); i += 2 {
+		key, ok := args[i].(string)
+		if !ok || i+1 == len(args) {
+			//与 slog 相同，无法配对的参数记为 !BADKEY
+			key = "!BADKEY"
+			b.WriteString(" " + key + "=" + logQuote(fmt.Sprint(args[i])))
+			i--
+			continue
+		}
+		b.WriteString(" " + key + "=" + logQuote(fmt.Sprint(args[i+1])))
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	io.WriteString(l.w, b.String())
+	l.mu.Unlock()
+}
+
+func logQuote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// ----- 会话字段 -----
+
+var sessionSeq uint64
+
+func nextSession() uint64 {
+	return atomic.AddUint64(&sessionSeq, 1)
+}
+
+//附加会话字段
+func (c *Server) logArgs(args ...interface{}) []interface{} {
+	return append([]interface{}{"remote", c.remote, "session", c.session}, args...)
+}
@@ -0,0 +1,80 @@
+package netfs
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+//可并发写入与读取的缓冲
+type test_log_buffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *test_log_buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *test_log_buffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+//*slog.Logger 可直接作为日志使用
+var _ Log = slog.Default()
+
+func Test_TextLog(t *testing.T) {
+	buf := new(test_log_buffer)
+	l := new(TextLog).Init(buf, LOG_INFO)
+
+	l.Debug("hidden")
+	l.Info("hello world", "path", "a b.txt", "n", 1, "odd")
+	l.Error("fail", "error", errors.New("x"))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Lines expect:2, get:%d", len(lines))
+	}
+
+	if s := lines[0][strings.Index(lines[0], " ")+1:]; s != `INFO "hello world" path="a b.txt" n=1 !BADKEY=odd` {
+		t.Errorf("Info expect:INFO \"hello world\" ..., get:%s", s)
+	}
+	if !strings.HasSuffix(lines[1], "ERROR fail error=x") {
+		t.Errorf("Error expect:ERROR fail error=x, get:%s", lines[1])
+	}
+}
+
+func Test_ServerLog(t *testing.T) {
+	buf := new(test_log_buffer)
+
+	exports := new(Exports).Init()
+	exports.Logger = new(TextLog).Init(buf, LOG_DEBUG)
+	exports.Add(&Share{Fs: new(MemFs).Init()})
+
+	go exports.Listen("127.0.0.1:11126")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11126")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Stat("none.txt")
+	c.Close()
+
+	time.Sleep(100 * time.Millisecond)
+	s := buf.String()
+
+	for _, want := range []string{"link open", "op=fs_stat path=none.txt duration=", "error=", "link close", "session="} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Log expect:%s, get:\n%s", want, s)
+		}
+	}
+}
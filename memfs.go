@@ -0,0 +1,572 @@
+package netfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//内存文件系统
+type MemFs struct {
+	mu   sync.Mutex
+	root *memNode
+}
+
+type memNode struct {
+	name     string
+	mode     os.FileMode
+	modtime  time.Time
+	data     []byte
+	children map[string]*memNode
+}
+
+func (m *MemFs) Init() *MemFs {
+	m.root = newMemNode("/", os.ModeDir|0755)
+	return m
+}
+
+func newMemNode(name string, mode os.FileMode) *memNode {
+	n := &memNode{name: name, mode: mode, modtime: time.Now()}
+	if mode.IsDir() {
+		n.children = make(map[string]*memNode)
+	}
+	return n
+}
+
+func (n *memNode) info() os.FileInfo {
+	fi := new(FileInfo)
+	fi.name = n.name
+	fi.size = int64(len(n.data))
+	fi.mode = n.mode
+	fi.modtime = n.modtime
+	return fi
+}
+
+func memSplit(name string) []string {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" {
+		return nil
+	}
+	return strings.Split(clean, "/")
+}
+
+//查找节点，调用方需持有锁
+func (m *MemFs) lookup(op, name string) (*memNode, error) {
+	n := m.root
+	for _, elem := range memSplit(name) {
+		if !n.mode.IsDir() {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		c, ok := n.children[elem]
+		if !ok {
+			return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		n = c
+	}
+	return n, nil
+}
+
+//查找上级目录，返回目录节点及文件名
+func (m *MemFs) lookupParent(op, name string) (*memNode, string, error) {
+	elems := memSplit(name)
+	if len(elems) == 0 {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: os.ErrExist}
+	}
+
+	dir, err := m.lookup(op, strings.Join(elems[:len(elems)-1], "/"))
+	if err != nil {
+		return nil, "", err
+	}
+	if !dir.mode.IsDir() {
+		return nil, "", &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return dir, elems[len(elems)-1], nil
+}
+
+func (m *MemFs) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	n.mode = (n.mode &^ os.ModePerm) | (mode & os.ModePerm)
+	return nil
+}
+
+func (m *MemFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	n.modtime = mtime
+	return nil
+}
+
+func (m *MemFs) Mkdir(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.lookupParent("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if _, ok := dir.children[base]; ok {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+
+	dir.children[base] = newMemNode(base, os.ModeDir|(perm&os.ModePerm))
+	dir.modtime = time.Now()
+	return nil
+}
+
+func (m *MemFs) MkdirAll(pathName string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.root
+	for _, elem := range memSplit(pathName) {
+		c, ok := n.children[elem]
+		if !ok {
+			c = newMemNode(elem, os.ModeDir|(perm&os.ModePerm))
+			n.children[elem] = c
+			n.modtime = time.Now()
+		}
+		if !c.mode.IsDir() {
+			return &os.PathError{Op: "mkdir", Path: pathName, Err: syscall.ENOTDIR}
+		}
+		n = c
+	}
+	return nil
+}
+
+func (m *MemFs) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.lookupParent("remove", name)
+	if err != nil {
+		return err
+	}
+	n, ok := dir.children[base]
+	if !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	if n.mode.IsDir() && len(n.children) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+
+	delete(dir.children, base)
+	dir.modtime = time.Now()
+	return nil
+}
+
+func (m *MemFs) RemoveAll(pathName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	dir, base, err := m.lookupParent("removeall", pathName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if _, ok := dir.children[base]; ok {
+		delete(dir.children, base)
+		dir.modtime = time.Now()
+	}
+	return nil
+}
+
+func (m *MemFs) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	linkErr := func(err error) error {
+		if e, ok := err.(*os.PathError); ok {
+			err = e.Err
+		}
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	odir, obase, err := m.lookupParent("rename", oldpath)
+	if err != nil {
+		return linkErr(err)
+	}
+	n, ok := odir.children[obase]
+	if !ok {
+		return linkErr(os.ErrNotExist)
+	}
+
+	np := path.Clean("/" + newpath)
+	op := path.Clean("/" + oldpath)
+	if np == op {
+		return nil
+	}
+	if n.mode.IsDir() && strings.HasPrefix(np, op+"/") {
+		return linkErr(syscall.EINVAL)
+	}
+
+	ndir, nbase, err := m.lookupParent("rename", newpath)
+	if err != nil {
+		return linkErr(err)
+	}
+
+	if old, ok := ndir.children[nbase]; ok {
+		switch {
+		case old.mode.IsDir() && !n.mode.IsDir():
+			return linkErr(syscall.EISDIR)
+		case !old.mode.IsDir() && n.mode.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		case old.mode.IsDir() && len(old.children) > 0:
+			return linkErr(syscall.ENOTEMPTY)
+		}
+	}
+
+	delete(odir.children, obase)
+	n.name = nbase
+	ndir.children[nbase] = n
+
+	now := time.Now()
+	odir.modtime = now
+	ndir.modtime = now
+	return nil
+}
+
+func (m *MemFs) Truncate(name string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("truncate", name)
+	if err != nil {
+		return err
+	}
+	return n.truncate("truncate", name, size)
+}
+
+func (n *memNode) truncate(op, name string, size int64) error {
+	if n.mode.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EISDIR}
+	}
+	if size < 0 {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EINVAL}
+	}
+
+	if size <= int64(len(n.data)) {
+		n.data = n.data[:size]
+	} else {
+		n.data = append(n.data, make([]byte, size-int64(len(n.data)))...)
+	}
+	n.modtime = time.Now()
+	return nil
+}
+
+func (m *MemFs) Create(name string) (file File, err error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MemFs) Open(name string) (file File, err error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MemFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("open", name)
+
+	if err != nil {
+		if !os.IsNotExist(err) || flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+
+		dir, base, err := m.lookupParent("open", name)
+		if err != nil {
+			return nil, err
+		}
+
+		n = newMemNode(base, perm&os.ModePerm)
+		dir.children[base] = n
+		dir.modtime = time.Now()
+	} else {
+		if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		}
+		if n.mode.IsDir() && isWriteFlag(flag) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+			n.data = nil
+			n.modtime = time.Now()
+		}
+	}
+
+	return &memFile{fs: m, node: n, name: name, flag: flag}, nil
+}
+
+func (m *MemFs) Stat(name string) (fi os.FileInfo, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+func (m *MemFs) Lstat(name string) (fi os.FileInfo, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, err := m.lookup("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return n.info(), nil
+}
+
+type memFile struct {
+	fs     *MemFs
+	node   *memNode
+	name   string
+	flag   int
+	off    int64
+	dirs   []string
+	closed bool
+}
+
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+
+	acc := f.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	if write && acc == os.O_RDONLY || !write && acc == os.O_WRONLY {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
+}
+
+func (f *memFile) Chmod(mode os.FileMode) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "chmod", Path: f.name, Err: os.ErrClosed}
+	}
+	f.node.mode = (f.node.mode &^ os.ModePerm) | (mode & os.ModePerm)
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Name() string {
+	return f.name
+}
+
+func (f *memFile) Read(b []byte) (n int, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err = f.readAt("read", b, f.off)
+	f.off += int64(n)
+	return
+}
+
+func (f *memFile) ReadAt(b []byte, off int64) (n int, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err = f.readAt("read", b, off)
+	if err == nil && n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *memFile) readAt(op string, b []byte, off int64) (n int, err error) {
+	if err = f.check(op, false); err != nil {
+		return 0, err
+	}
+	if f.node.mode.IsDir() {
+		return 0, &os.PathError{Op: op, Path: f.name, Err: syscall.EISDIR}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: op, Path: f.name, Err: syscall.EINVAL}
+	}
+	if off >= int64(len(f.node.data)) {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	return copy(b, f.node.data[off:]), nil
+}
+
+func (f *memFile) Readdir(n int) (fi []os.FileInfo, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	names, err := f.readdirnames(n)
+	for _, name := range names {
+		if c, ok := f.node.children[name]; ok {
+			fi = append(fi, c.info())
+		}
+	}
+	return
+}
+
+func (f *memFile) Readdirnames(n int) (names []string, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	return f.readdirnames(n)
+}
+
+func (f *memFile) readdirnames(n int) (names []string, err error) {
+	if err = f.check("readdirent", false); err != nil {
+		return nil, err
+	}
+	if !f.node.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	if f.dirs == nil {
+		f.dirs = make([]string, 0, len(f.node.children))
+		for name := range f.node.children {
+			f.dirs = append(f.dirs, name)
+		}
+		sort.Strings(f.dirs)
+	}
+
+	if n > 0 && len(f.dirs) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(f.dirs) {
+		n = len(f.dirs)
+	}
+
+	names = f.dirs[:n]
+	f.dirs = f.dirs[n:]
+	return
+}
+
+func (f *memFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = f.off + offset
+	case io.SeekEnd:
+		ret = int64(len(f.node.data)) + offset
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if ret < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	f.off = ret
+	if ret == 0 {
+		f.dirs = nil
+	}
+	return ret, nil
+}
+
+func (f *memFile) Stat() (fi os.FileInfo, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	return f.node.info(), nil
+}
+
+func (f *memFile) Sync() (err error) {
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	return f.node.truncate("truncate", f.name, size)
+}
+
+func (f *memFile) Write(b []byte) (n int, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.off = int64(len(f.node.data))
+	}
+
+	n, err = f.writeAt(b, f.off)
+	f.off += int64(n)
+	return
+}
+
+func (f *memFile) WriteAt(b []byte, off int64) (n int, err error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: syscall.EINVAL}
+	}
+	return f.writeAt(b, off)
+}
+
+func (f *memFile) writeAt(b []byte, off int64) (n int, err error) {
+	if err = f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	end := off + int64(len(b))
+	if end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+
+	n = copy(f.node.data[off:], b)
+	f.node.modtime = time.Now()
+	return n, nil
+}
+
+func (f *memFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
@@ -0,0 +1,333 @@
+package netfs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//运行指标，side 为 "server" 或 "client"，实现需并发安全
+type Metrics interface {
+	//一次请求完成，err 为返回给调用方的错误
+	Request(side string, op uint8, d time.Duration, err error)
+	//读写的文件数据字节数
+	Transfer(side string, read, written int64)
+	//活动会话数变化
+	Sessions(delta int64)
+	//打开的文件数变化
+	Fids(delta int64)
+	//握手失败
+	HandshakeFailed(side string)
+}
+
+//未单独指定时 Exports 与 Client 使用的指标，为 nil 时不统计
+var DefaultMetrics Metrics
+
+//操作码名称
+func OpName(op uint8) string {
+	switch op {
+	case LINK_CLOSE:
+		return "link_close"
+	case LINK_PING:
+		return "link_ping"
+	case LINK_AUTH:
+		return "link_auth"
+	case LINK_SHARE:
+		return "link_share"
+	case FS_CHMOD:
+		return "fs_chmod"
+	case FS_CHTIMES:
+		return "fs_chtimes"
+	case FS_MKDIR:
+		return "fs_mkdir"
+	case FS_MKDIRALL:
+		return "fs_mkdirall"
+	case FS_REMOVE:
+		return "fs_remove"
+	case FS_REMOVEALL:
+		return "fs_removeall"
+	case FS_RENAME:
+		return "fs_rename"
+	case FS_TRUNCATE:
+		return "fs_truncate"
+	case FS_CREATE:
+		return "fs_create"
+	case FS_OPEN:
+		return "fs_open"
+	case FS_OPENFILE:
+		return "fs_openfile"
+	case FS_LSTAT:
+		return "fs_lstat"
+	case FS_STAT:
+		return "fs_stat"
+	case FS_WATCH:
+		return "fs_watch"
+	case FILE_CHMOD:
+		return "file_chmod"
+	case FILE_CLOSE:
+		return "file_close"
+	case FILE_READ:
+		return "file_read"
+	case FILE_READAT:
+		return "file_readat"
+	case FILE_READDIR:
+		return "file_readdir"
+	case FILE_READDIRNAMES:
+		return "file_readdirnames"
+	case FILE_SEEK:
+		return "file_seek"
+	case FILE_STAT:
+		return "file_stat"
+	case FILE_SYNC:
+		return "file_sync"
+	case FILE_TRUNCATE:
+		return "file_truncate"
+	case FILE_WRITE:
+		return "file_write"
+	case FILE_WRITEAT:
+		return "file_writeat"
+	case FILE_LOCK:
+		return "file_lock"
+	case FILE_UNLOCK:
+		return "file_unlock"
+	}
+	return fmt.Sprintf("op_%d", op)
+}
+
+//错误分类，nil 与 io.EOF 返回空字符串
+func ErrorClass(err error) string {
+	switch err {
+	case nil, io.EOF:
+		return ""
+	}
+
+	switch e := err.(type) {
+	case IO_Error:
+		return "io"
+	case Data_Error:
+		return "protocol"
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+
+	switch errnoCode(err) {
+	case 0:
+		return "other"
+	case errnoCode(syscall.ENOENT):
+		return "not_exist"
+	case errnoCode(syscall.EEXIST):
+		return "exist"
+	case errnoCode(syscall.EACCES), errnoCode(syscall.EPERM), errnoCode(syscall.EROFS):
+		return "permission"
+	case errnoCode(syscall.ENOSPC), errnoCode(syscall.EDQUOT):
+		return "no_space"
+	case errnoCode(syscall.EAGAIN):
+		return "locked"
+	}
+	return "invalid"
+}
+
+// ----- Prometheus 文本格式 -----
+
+//默认的直方图分界(秒)
+var DefaultBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metricsKey struct {
+	side  string
+	op    string
+	class string
+}
+
+type histogram struct {
+	counts []int64
+	count  int64
+	sum    float64
+}
+
+//内存中的指标集合，同时是输出 Prometheus 文本格式的 http.Handler
+type Registry struct {
+	Buckets []float64
+
+	mu         sync.Mutex
+	latency    map[metricsKey]*histogram
+	errors     map[metricsKey]int64
+	read       map[string]int64
+	written    map[string]int64
+	handshakes map[string]int64
+	sessions   int64
+	fids       int64
+}
+
+func (r *Registry) Init() *Registry {
+	r.Buckets = DefaultBuckets
+	r.latency = make(map[metricsKey]*histogram)
+	r.errors = make(map[metricsKey]int64)
+	r.read = make(map[string]int64)
+	r.written = make(map[string]int64)
+	r.handshakes = make(map[string]int64)
+	return r
+}
+
+func (r *Registry) Request(side string, op uint8, d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := metricsKey{side: side, op: OpName(op)}
+
+	h, ok := r.latency[key]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(r.Buckets))}
+		r.latency[key] = h
+	}
+
+	sec := d.Seconds()
+	for i, le := range r.Buckets {
+		if sec <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += sec
+
+	if class := ErrorClass(err); class != "" {
+		key.class = class
+		r.errors[key]++
+	}
+}
+
+func (r *Registry) Transfer(side string, read, written int64) {
+	r.mu.Lock()
+	r.read[side] += read
+	r.written[side] += written
+	r.mu.Unlock()
+}
+
+func (r *Registry) Sessions(delta int64) {
+	r.mu.Lock()
+	r.sessions += delta
+	r.mu.Unlock()
+}
+
+func (r *Registry) Fids(delta int64) {
+	r.mu.Lock()
+	r.fids += delta
+	r.mu.Unlock()
+}
+
+func (r *Registry) HandshakeFailed(side string) {
+	r.mu.Lock()
+	r.handshakes[side]++
+	r.mu.Unlock()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	r.WriteTo(w)
+}
+
+//按 Prometheus 文本格式输出所有指标
+func (r *Registry) WriteTo(out io.Writer) (n int64, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cw := &countWriter{w: out}
+	w := bufio.NewWriter(cw)
+
+	var keys []metricsKey
+	for k := range r.latency {
+		keys = append(keys, k)
+	}
+	sortMetricsKeys(keys)
+
+	fmt.Fprintln(w, "# HELP netfs_requests_total Requests by side and opcode.")
+	fmt.Fprintln(w, "# TYPE netfs_requests_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "netfs_requests_total{side=%q,op=%q} %d\n", k.side, k.op, r.latency[k].count)
+	}
+
+	fmt.Fprintln(w, "# HELP netfs_request_duration_seconds Request latency by side and opcode.")
+	fmt.Fprintln(w, "# TYPE netfs_request_duration_seconds histogram")
+	for _, k := range keys {
+		h := r.latency[k]
+		for i, le := range r.Buckets {
+			fmt.Fprintf(w, "netfs_request_duration_seconds_bucket{side=%q,op=%q,le=\"%g\"} %d\n", k.side, k.op, le, h.counts[i])
+		}
+		fmt.Fprintf(w, "netfs_request_duration_seconds_bucket{side=%q,op=%q,le=\"+Inf\"} %d\n", k.side, k.op, h.count)
+		fmt.Fprintf(w, "netfs_request_duration_seconds_sum{side=%q,op=%q} %g\n", k.side, k.op, h.sum)
+		fmt.Fprintf(w, "netfs_request_duration_seconds_count{side=%q,op=%q} %d\n", k.side, k.op, h.count)
+	}
+
+	keys = keys[:0]
+	for k := range r.errors {
+		keys = append(keys, k)
+	}
+	sortMetricsKeys(keys)
+
+	fmt.Fprintln(w, "# HELP netfs_errors_total Failed requests by side, opcode and error class.")
+	fmt.Fprintln(w, "# TYPE netfs_errors_total counter")
+	for _, k := range keys {
+		fmt.Fprintf(w, "netfs_errors_total{side=%q,op=%q,class=%q} %d\n", k.side, k.op, k.class, r.errors[k])
+	}
+
+	writeSideCounter(w, "netfs_read_bytes_total", "File data bytes read.", r.read)
+	writeSideCounter(w, "netfs_written_bytes_total", "File data bytes written.", r.written)
+	writeSideCounter(w, "netfs_handshake_failures_total", "Failed protocol handshakes.", r.handshakes)
+
+	fmt.Fprintln(w, "# HELP netfs_sessions Active server sessions.")
+	fmt.Fprintln(w, "# TYPE netfs_sessions gauge")
+	fmt.Fprintf(w, "netfs_sessions %d\n", r.sessions)
+
+	fmt.Fprintln(w, "# HELP netfs_open_fids Files opened by clients on the server.")
+	fmt.Fprintln(w, "# TYPE netfs_open_fids gauge")
+	fmt.Fprintf(w, "netfs_open_fids %d\n", r.fids)
+
+	err = w.Flush()
+	return cw.n, err
+}
+
+//统计实际写出的字节数
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(b []byte) (n int, err error) {
+	n, err = c.w.Write(b)
+	c.n += int64(n)
+	return
+}
+
+func writeSideCounter(w io.Writer, name, help string, values map[string]int64) {
+	var sides []string
+	for side := range values {
+		sides = append(sides, side)
+	}
+	sort.Strings(sides)
+
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", name)
+	for _, side := range sides {
+		fmt.Fprintf(w, "%s{side=%q} %d\n", name, side, values[side])
+	}
+}
+
+func sortMetricsKeys(keys []metricsKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.side != b.side {
+			return a.side < b.side
+		}
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		return a.class < b.class
+	})
+}
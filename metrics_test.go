@@ -0,0 +1,110 @@
+package netfs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Metrics(t *testing.T) {
+	server := new(Registry).Init()
+	client := new(Registry).Init()
+
+	exports := new(Exports).Init()
+	exports.Metrics = server
+	exports.Add(&Share{Fs: new(MemFs).Init()})
+
+	go exports.Listen("127.0.0.1:11125")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11125")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Metrics = client
+
+	f, err := c.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello"))
+	f.ReadAt(make([]byte, 3), 0)
+
+	if _, err := c.Stat("none.txt"); err == nil {
+		t.Error("Stat expect:error, get:nil")
+	}
+
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(rec.Body)
+	s := string(body)
+
+	for _, want := range []string{
+		`netfs_requests_total{side="server",op="fs_create"} 1`,
+		`netfs_request_duration_seconds_count{side="server",op="file_write"} 1`,
+		`netfs_request_duration_seconds_bucket{side="server",op="fs_stat",le="+Inf"} 1`,
+		`netfs_errors_total{side="server",op="fs_stat",class="not_exist"} 1`,
+		`netfs_read_bytes_total{side="server"} 3`,
+		`netfs_written_bytes_total{side="server"} 5`,
+		"netfs_sessions 1",
+		"netfs_open_fids 1",
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Metrics expect:%s, get:\n%s", want, s)
+		}
+	}
+
+	f.Close()
+	c.Close()
+
+	rec = httptest.NewRecorder()
+	client.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = ioutil.ReadAll(rec.Body)
+	s = string(body)
+
+	for _, want := range []string{
+		`netfs_requests_total{side="client",op="file_close"} 1`,
+		`netfs_errors_total{side="client",op="fs_stat",class="not_exist"} 1`,
+		`netfs_written_bytes_total{side="client"} 5`,
+	} {
+		if !strings.Contains(s, want) {
+			t.Errorf("Metrics expect:%s, get:\n%s", want, s)
+		}
+	}
+
+	//协议版本不符时握手失败
+	conn, err := net.Dial("tcp", "127.0.0.1:11125")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{TYTE_INIT, 0, 0, 0, 99})
+	ioutil.ReadAll(conn)
+	conn.Close()
+
+	rec = httptest.NewRecorder()
+	server.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ = ioutil.ReadAll(rec.Body)
+
+	if want := `netfs_handshake_failures_total{side="server"} 1`; !strings.Contains(string(body), want) {
+		t.Errorf("Metrics expect:%s, get:\n%s", want, body)
+	}
+}
+
+func Test_Registry_WriteTo(t *testing.T) {
+	r := new(Registry).Init()
+
+	//输出超过 bufio 的缓冲区
+	for op := uint8(1); op < 30; op++ {
+		r.Request("server", op, time.Millisecond, nil)
+	}
+
+	var buf bytes.Buffer
+	n, err := r.WriteTo(&buf)
+	if err != nil || n != int64(buf.Len()) || n <= 4096 {
+		t.Errorf("WriteTo expect:%d, get:%d %v", buf.Len(), n, err)
+	}
+}
@@ -0,0 +1,775 @@
+package netfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//镜像文件系统，修改操作同时发往所有可用副本，读取由第一个可用的副本提供
+//
+//修改在至少 WriteQuorum 个副本上成功即视为成功，失败的副本标记为落后，不再参与读写，
+//直到 Repair 以可用副本为准重新同步。可用副本不足 WriteQuorum 时修改直接返回 ErrNoReplica。
+//读取遇到连接错误时换下一个副本。
+type MirrorFs struct {
+	Replicas    []FileSystem
+	WriteQuorum int //0 表示全部副本
+
+	rw      sync.RWMutex //修改操作共享，Repair 独占
+	mu      sync.Mutex
+	lagging []bool
+}
+
+var ErrNoReplica = errors.New("netfs: no healthy replica")
+
+func (m *MirrorFs) Init(replicas ...FileSystem) *MirrorFs {
+	m.Replicas = replicas
+	m.lagging = make([]bool, len(replicas))
+	return m
+}
+
+func (m *MirrorFs) quorum() int {
+	if m.WriteQuorum <= 0 || m.WriteQuorum > len(m.Replicas) {
+		return len(m.Replicas)
+	}
+	return m.WriteQuorum
+}
+
+//可用副本的序号
+func (m *MirrorFs) healthy() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var list []int
+	for i, lag := range m.lagging {
+		if !lag {
+			list = append(list, i)
+		}
+	}
+	return list
+}
+
+//落后的副本的序号
+func (m *MirrorFs) Lagging() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var list []int
+	for i, lag := range m.lagging {
+		if lag {
+			list = append(list, i)
+		}
+	}
+	return list
+}
+
+func (m *MirrorFs) setLagging(i int, lag bool) {
+	m.mu.Lock()
+	m.lagging[i] = lag
+	m.mu.Unlock()
+}
+
+//在各副本上并行执行 fn
+func mirrorFanout(replicas []int, fn func(k, i int) error) []error {
+	errs := make([]error, len(replicas))
+
+	var wg sync.WaitGroup
+	for k, i := range replicas {
+		wg.Add(1)
+		go func(k, i int) {
+			defer wg.Done()
+			errs[k] = fn(k, i)
+		}(k, i)
+	}
+	wg.Wait()
+	return errs
+}
+
+//汇总各副本的结果，部分成功时失败的副本标记为落后
+//成功数不足 quorum 时返回第一个错误
+func (m *MirrorFs) commit(replicas []int, errs []error) error {
+	ok := 0
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			ok++
+		} else if first == nil {
+			first = err
+		}
+	}
+
+	if ok > 0 {
+		for k, err := range errs {
+			if err != nil {
+				m.setLagging(replicas[k], true)
+			}
+		}
+	}
+	if ok >= m.quorum() {
+		return nil
+	}
+	if first == nil {
+		first = ErrNoReplica
+	}
+	return first
+}
+
+//可写入的副本，不足 quorum 时不做任何修改，以免只改了一部分副本
+func (m *MirrorFs) writable() ([]int, error) {
+	replicas := m.healthy()
+	if len(replicas) < m.quorum() {
+		return nil, ErrNoReplica
+	}
+	return replicas, nil
+}
+
+//在所有可用副本上执行修改
+func (m *MirrorFs) apply(fn func(fs FileSystem) error) error {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	replicas, err := m.writable()
+	if err != nil {
+		return err
+	}
+	errs := mirrorFanout(replicas, func(k, i int) error {
+		return fn(m.Replicas[i])
+	})
+	return m.commit(replicas, errs)
+}
+
+//连接类错误，换一个副本可能成功
+func mirrorRetry(err error) bool {
+	switch ErrorClass(err) {
+	case "io", "protocol":
+		return true
+	}
+	return false
+}
+
+//依次在可用副本上读取，直到成功或遇到与连接无关的错误
+func (m *MirrorFs) read(fn func(fs FileSystem) error) error {
+	err := ErrNoReplica
+	for _, i := range m.healthy() {
+		if err = fn(m.Replicas[i]); err == nil || !mirrorRetry(err) {
+			return err
+		}
+	}
+	return err
+}
+
+//修改内容后统一各副本的修改时间，以便按 mtime 比较
+func (m *MirrorFs) alignTimes(name string, replicas []int) {
+	if len(replicas) < 2 {
+		return
+	}
+	fi, err := m.Replicas[replicas[0]].Stat(name)
+	if err != nil {
+		return
+	}
+	for _, i := range replicas[1:] {
+		m.Replicas[i].Chtimes(name, fi.ModTime(), fi.ModTime())
+	}
+}
+
+func (m *MirrorFs) Chmod(name string, mode os.FileMode) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.Chmod(name, mode)
+	})
+}
+
+func (m *MirrorFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.Chtimes(name, atime, mtime)
+	})
+}
+
+func (m *MirrorFs) Mkdir(name string, perm os.FileMode) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.Mkdir(name, perm)
+	})
+}
+
+func (m *MirrorFs) MkdirAll(pathName string, perm os.FileMode) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.MkdirAll(pathName, perm)
+	})
+}
+
+func (m *MirrorFs) Remove(name string) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.Remove(name)
+	})
+}
+
+func (m *MirrorFs) RemoveAll(pathName string) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.RemoveAll(pathName)
+	})
+}
+
+func (m *MirrorFs) Rename(oldpath, newpath string) error {
+	return m.apply(func(fs FileSystem) error {
+		return fs.Rename(oldpath, newpath)
+	})
+}
+
+func (m *MirrorFs) Truncate(name string, size int64) error {
+	err := m.apply(func(fs FileSystem) error {
+		return fs.Truncate(name, size)
+	})
+	if err == nil {
+		m.alignTimes(name, m.healthy())
+	}
+	return err
+}
+
+func (m *MirrorFs) Create(name string) (file File, err error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MirrorFs) Open(name string) (file File, err error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MirrorFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if !isWriteFlag(flag) {
+		err = m.read(func(fs FileSystem) error {
+			file, err = fs.OpenFile(name, flag, perm)
+			return err
+		})
+		return file, err
+	}
+
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+
+	replicas, err := m.writable()
+	if err != nil {
+		return nil, err
+	}
+	files := make([]File, len(replicas))
+	errs := mirrorFanout(replicas, func(k, i int) (err error) {
+		files[k], err = m.Replicas[i].OpenFile(name, flag, perm)
+		return err
+	})
+
+	if err := m.commit(replicas, errs); err != nil {
+		for _, f := range files {
+			if f != nil {
+				f.Close()
+			}
+		}
+		return nil, err
+	}
+
+	f := &mirrorFile{fs: m, name: name, flag: flag}
+	for k, i := range replicas {
+		if errs[k] == nil {
+			f.replicas = append(f.replicas, i)
+			f.files = append(f.files, files[k])
+		}
+	}
+	return f, nil
+}
+
+func (m *MirrorFs) Stat(name string) (fi os.FileInfo, err error) {
+	err = m.read(func(fs FileSystem) error {
+		fi, err = fs.Stat(name)
+		return err
+	})
+	return fi, err
+}
+
+func (m *MirrorFs) Lstat(name string) (fi os.FileInfo, err error) {
+	err = m.read(func(fs FileSystem) error {
+		fi, err = fs.Lstat(name)
+		return err
+	})
+	return fi, err
+}
+
+// ----- 比较与修复 -----
+
+//副本间的一处差异
+//Reason 为 missing(副本中没有)、extra(副本中多出)、type、size、mtime 或 hash
+type MirrorDiff struct {
+	Path    string
+	Replica int
+	Reason  string
+}
+
+//以第一个可用副本为准，比较其余副本中 name 下的目录树
+//hash 为 true 时还比较文件内容的 SHA256
+func (m *MirrorFs) Verify(name string, hash bool) ([]MirrorDiff, error) {
+	healthy := m.healthy()
+	if len(healthy) == 0 {
+		return nil, ErrNoReplica
+	}
+	src := healthy[0]
+
+	var diffs []MirrorDiff
+	for i := range m.Replicas {
+		if i == src {
+			continue
+		}
+		err := mirrorDiff(m.Replicas[src], m.Replicas[i], path.Clean("/"+name), hash, func(p, reason string) error {
+			diffs = append(diffs, MirrorDiff{Path: p, Replica: i, Reason: reason})
+			return nil
+		})
+		if err != nil {
+			return diffs, err
+		}
+	}
+	return diffs, nil
+}
+
+//以可用副本为准重新同步副本 i 中 name 下的目录树
+//name 为 / 时同步完成后副本 i 恢复可用；同步期间其它修改操作等待
+func (m *MirrorFs) Repair(i int, name string, hash bool) error {
+	m.rw.Lock()
+	defer m.rw.Unlock()
+
+	src := -1
+	for _, j := range m.healthy() {
+		if j != i {
+			src = j
+			break
+		}
+	}
+	if src < 0 {
+		return ErrNoReplica
+	}
+
+	from, to := m.Replicas[src], m.Replicas[i]
+	p := path.Clean("/" + name)
+
+	err := mirrorDiff(from, to, p, hash, func(p, reason string) error {
+		switch reason {
+		case "extra":
+			return to.RemoveAll(p)
+		case "type":
+			if err := to.RemoveAll(p); err != nil {
+				return err
+			}
+		}
+		return copyTree(from, to, p)
+	})
+	if err != nil {
+		return err
+	}
+
+	if p == "/" {
+		m.setLagging(i, false)
+	}
+	return nil
+}
+
+//比较 src 与 dst 中 p 下的目录树，每处差异调用一次 fn，不同类型的目录不再深入
+func mirrorDiff(src, dst FileSystem, p string, hash bool, fn func(p, reason string) error) error {
+	a, err := src.Lstat(p)
+	if err != nil {
+		return err
+	}
+	b, err := dst.Lstat(p)
+	if os.IsNotExist(err) {
+		return fn(p, "missing")
+	}
+	if err != nil {
+		return err
+	}
+
+	reason := ""
+	switch {
+	case a.Mode().Type() != b.Mode().Type():
+		reason = "type"
+	case a.IsDir():
+	case a.Size() != b.Size():
+		reason = "size"
+	case a.ModTime().Unix() != b.ModTime().Unix():
+		reason = "mtime"
+	case hash:
+		ha, err := fileHash(src, p)
+		if err != nil {
+			return err
+		}
+		hb, err := fileHash(dst, p)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(ha, hb) {
+			reason = "hash"
+		}
+	}
+	if reason != "" {
+		return fn(p, reason)
+	}
+	if !a.IsDir() {
+		return nil
+	}
+
+	na, err := readdirnames(src, p)
+	if err != nil {
+		return err
+	}
+	nb, err := readdirnames(dst, p)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(na))
+	for _, name := range na {
+		seen[name] = true
+		if err := mirrorDiff(src, dst, path.Join(p, name), hash, fn); err != nil {
+			return err
+		}
+	}
+	for _, name := range nb {
+		if !seen[name] {
+			if err := fn(path.Join(p, name), "extra"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func readdirnames(fs FileSystem, p string) ([]string, error) {
+	f, err := fs.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdirnames(-1)
+}
+
+func fileHash(fs FileSystem, p string) ([]byte, error) {
+	f, err := fs.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+//把 src 中的 p 复制到 dst，目录递归复制，保留权限与修改时间
+func copyTree(src, dst FileSystem, p string) error {
+	fi, err := src.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		if err := dst.MkdirAll(p, fi.Mode().Perm()); err != nil {
+			return err
+		}
+		names, err := readdirnames(src, p)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := copyTree(src, dst, path.Join(p, name)); err != nil {
+				return err
+			}
+		}
+	} else {
+		if err := dst.MkdirAll(path.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := copyFile(src, dst, p, fi.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+
+	if err := dst.Chmod(p, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return dst.Chtimes(p, fi.ModTime(), fi.ModTime())
+}
+
+func copyFile(src, dst FileSystem, p string, perm os.FileMode) error {
+	r, err := src.Open(p)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	w, err := dst.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// ----- 文件 -----
+
+//以写方式打开的镜像文件，读写按自身的偏移进行
+type mirrorFile struct {
+	mu       sync.Mutex
+	fs       *MirrorFs
+	name     string
+	flag     int
+	replicas []int
+	files    []File
+	off      int64
+	dirty    bool
+}
+
+//在各副本的文件上执行修改，失败的副本不再参与
+func (f *mirrorFile) apply(fn func(file File) error) error {
+	if len(f.files) == 0 {
+		return &os.PathError{Op: "write", Path: f.name, Err: os.ErrClosed}
+	}
+
+	f.fs.rw.RLock()
+	defer f.fs.rw.RUnlock()
+
+	if _, err := f.fs.writable(); err != nil {
+		return err
+	}
+	errs := mirrorFanout(f.replicas, func(k, i int) error {
+		return fn(f.files[k])
+	})
+	err := f.fs.commit(f.replicas, errs)
+
+	var replicas []int
+	var files []File
+	for k, e := range errs {
+		if e == nil || err != nil {
+			replicas = append(replicas, f.replicas[k])
+			files = append(files, f.files[k])
+		} else {
+			f.files[k].Close()
+		}
+	}
+	f.replicas, f.files = replicas, files
+
+	//打开期间修复的副本没有收到本次修改
+	healthy := f.fs.healthy()
+	if len(healthy) > len(f.replicas) {
+		in := make(map[int]bool)
+		for _, i := range f.replicas {
+			in[i] = true
+		}
+		for _, i := range healthy {
+			if !in[i] {
+				f.fs.setLagging(i, true)
+			}
+		}
+	}
+
+	f.dirty = true
+	return err
+}
+
+//依次在各副本的文件上读取
+func (f *mirrorFile) read(fn func(file File) error) error {
+	err := ErrNoReplica
+	for _, file := range f.files {
+		if err = fn(file); err == nil || !mirrorRetry(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (f *mirrorFile) Chmod(mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.apply(func(file File) error {
+		return file.Chmod(mode)
+	})
+}
+
+func (f *mirrorFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(f.files) == 0 {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+
+	replicas := f.replicas
+	errs := mirrorFanout(replicas, func(k, i int) error {
+		return f.files[k].Close()
+	})
+	f.files = nil
+
+	err := f.fs.commit(replicas, errs)
+	if err == nil && f.dirty {
+		f.fs.alignTimes(f.name, replicas)
+	}
+	return err
+}
+
+func (f *mirrorFile) Name() string {
+	return f.name
+}
+
+func (f *mirrorFile) Read(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.read(func(file File) error {
+		n, err = file.ReadAt(b, f.off)
+		return err
+	})
+	f.off += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func (f *mirrorFile) ReadAt(b []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.read(func(file File) error {
+		n, err = file.ReadAt(b, off)
+		return err
+	})
+	return
+}
+
+func (f *mirrorFile) Readdir(n int) (fi []os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.read(func(file File) error {
+		fi, err = file.Readdir(n)
+		return err
+	})
+	return
+}
+
+func (f *mirrorFile) Readdirnames(n int) (names []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.read(func(file File) error {
+		names, err = file.Readdirnames(n)
+		return err
+	})
+	return
+}
+
+func (f *mirrorFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = f.off + offset
+	case io.SeekEnd:
+		var fi os.FileInfo
+		err = f.read(func(file File) error {
+			fi, err = file.Stat()
+			return err
+		})
+		if err != nil {
+			return 0, err
+		}
+		ret = fi.Size() + offset
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if ret < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+	f.off = ret
+	return ret, nil
+}
+
+func (f *mirrorFile) Stat() (fi os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.read(func(file File) error {
+		fi, err = file.Stat()
+		return err
+	})
+	return
+}
+
+func (f *mirrorFile) Sync() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.apply(func(file File) error {
+		return file.Sync()
+	})
+}
+
+func (f *mirrorFile) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.apply(func(file File) error {
+		return file.Truncate(size)
+	})
+}
+
+func (f *mirrorFile) Write(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.apply(func(file File) error {
+		var n int
+		var err error
+		if f.flag&os.O_APPEND != 0 {
+			n, err = file.Write(b)
+		} else {
+			n, err = file.WriteAt(b, f.off)
+		}
+		if err == nil && n < len(b) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	f.off += int64(len(b))
+	return len(b), nil
+}
+
+func (f *mirrorFile) WriteAt(b []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.apply(func(file File) error {
+		n, err := file.WriteAt(b, off)
+		if err == nil && n < len(b) {
+			err = io.ErrShortWrite
+		}
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (f *mirrorFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
@@ -0,0 +1,132 @@
+package netfs
+
+import (
+	"fmt"
+	"testing"
+)
+
+//可模拟断开的文件系统
+func test_down_fs(fs FileSystem, down *bool) FileSystem {
+	return Intercept(fs, new(Session), func(call *Call, next Handler) {
+		if *down {
+			call.Err = IO_Error("down")
+			return
+		}
+		next(call)
+	})
+}
+
+func test_write_file(t *testing.T, fs FileSystem, name, body string) {
+	f, err := fs.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(body)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_MirrorFs(t *testing.T) {
+	down := false
+	r0, r1, r2 := new(MemFs).Init(), new(MemFs).Init(), new(MemFs).Init()
+	fs := new(MirrorFs).Init(r0, r1, test_down_fs(r2, &down))
+	fs.WriteQuorum = 2
+
+	test_write_file(t, fs, "a.txt", "hello")
+	for i, r := range []FileSystem{r0, r1, r2} {
+		if s := test_read_file(r, "a.txt"); s != "hello" {
+			t.Errorf("Replica %d expect:hello, get:%s", i, s)
+		}
+	}
+	if diffs, err := fs.Verify("/", true); err != nil || len(diffs) != 0 {
+		t.Errorf("Verify expect:none, get:%v %v", diffs, err)
+	}
+
+	//一个副本断开时仍满足 quorum
+	down = true
+	test_write_file(t, fs, "b.txt", "b")
+	if err := fs.Mkdir("d", 0755); err != nil {
+		t.Errorf("Mkdir expect:nil, get:%v", err)
+	}
+	if s := fmt.Sprint(fs.Lagging()); s != "[2]" {
+		t.Errorf("Lagging expect:[2], get:%s", s)
+	}
+	if s := test_read_file(fs, "b.txt"); s != "b" {
+		t.Errorf("Read expect:b, get:%s", s)
+	}
+	down = false
+
+	//副本间的差异
+	test_write_file(t, r2, "x.txt", "x")
+	diffs, err := fs.Verify("/", false)
+	if s := fmt.Sprint(diffs); err != nil || s != "[{/b.txt 2 missing} {/d 2 missing} {/x.txt 2 extra}]" {
+		t.Errorf("Verify expect:missing b.txt d extra x.txt, get:%s %v", s, err)
+	}
+
+	if err := fs.Repair(2, "/", false); err != nil {
+		t.Fatal(err)
+	}
+	if len(fs.Lagging()) != 0 || test_list_dir(r2, "/") != "a.txt,b.txt,d" {
+		t.Errorf("Repair expect:a.txt,b.txt,d, get:%v %s", fs.Lagging(), test_list_dir(r2, "/"))
+	}
+	if diffs, err := fs.Verify("/", true); err != nil || len(diffs) != 0 {
+		t.Errorf("Verify expect:none, get:%v %v", diffs, err)
+	}
+
+	//大小与时间相同而内容不同
+	fi, _ := r1.Stat("a.txt")
+	test_write_file(t, r1, "a.txt", "HELLO")
+	r1.Chtimes("a.txt", fi.ModTime(), fi.ModTime())
+	if diffs, _ := fs.Verify("/", false); len(diffs) != 0 {
+		t.Errorf("Verify expect:none, get:%v", diffs)
+	}
+	if diffs, _ := fs.Verify("/", true); fmt.Sprint(diffs) != "[{/a.txt 1 hash}]" {
+		t.Errorf("Verify expect:a.txt hash, get:%v", diffs)
+	}
+
+	//有副本落后时不满足 quorum，不做任何修改
+	down = true
+	w, err := fs.Create("w.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := fmt.Sprint(fs.Lagging()); s != "[2]" {
+		t.Errorf("Lagging expect:[2], get:%s", s)
+	}
+	fs.WriteQuorum = 0
+	if err := fs.Mkdir("e", 0755); err != ErrNoReplica {
+		t.Errorf("Mkdir expect:ErrNoReplica, get:%v", err)
+	}
+	if _, err := fs.Create("x.txt"); err != ErrNoReplica {
+		t.Errorf("Create expect:ErrNoReplica, get:%v", err)
+	}
+	if _, err := w.WriteString("w"); err != ErrNoReplica {
+		t.Errorf("Write expect:ErrNoReplica, get:%v", err)
+	}
+	w.Close()
+	for i, r := range []FileSystem{r0, r1} {
+		if s := test_list_dir(r, "/"); s != "a.txt,b.txt,d,w.txt" {
+			t.Errorf("Replica %d expect:a.txt,b.txt,d,w.txt, get:%s", i, s)
+		}
+		if s := test_read_file(r, "w.txt"); s != "" {
+			t.Errorf("Replica %d w.txt expect:empty, get:%s", i, s)
+		}
+	}
+}
+
+func Test_MirrorFs_Failover(t *testing.T) {
+	down := true
+	fs := new(MirrorFs).Init(test_down_fs(test_mem_fs(t, "a.txt"), &down), test_mem_fs(t, "a.txt"))
+
+	if s := test_read_file(fs, "a.txt"); s != "a.txt" {
+		t.Errorf("Read expect:a.txt, get:%s", s)
+	}
+	if _, err := fs.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+	//读取失败不影响副本状态
+	if len(fs.Lagging()) != 0 {
+		t.Errorf("Lagging expect:none, get:%v", fs.Lagging())
+	}
+}
@@ -0,0 +1,430 @@
+package netfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//按路径前缀组合多个文件系统
+//
+//路径由最长的挂载点处理，挂载点的上级目录不存在时自动合成(只读)，
+//目录列表中合并挂载点；跨挂载点的 Rename 返回 EXDEV，挂载点本身不能删除或改名。
+type MountFs struct {
+	mu     sync.RWMutex
+	mounts map[string]FileSystem
+}
+
+func (m *MountFs) Init() *MountFs {
+	m.mounts = make(map[string]FileSystem)
+	return m
+}
+
+//挂载到 point，已有的同名挂载被替换
+func (m *MountFs) Mount(point string, fs FileSystem) *MountFs {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mounts[path.Clean("/"+point)] = fs
+	return m
+}
+
+func (m *MountFs) Unmount(point string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	point = path.Clean("/" + point)
+	_, ok := m.mounts[point]
+	delete(m.mounts, point)
+	return ok
+}
+
+//路径所在的挂载与其中的路径，fs 为 nil 表示不在任何挂载下
+func (m *MountFs) resolve(p string) (point string, fs FileSystem, inner string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for point = p; ; point = path.Dir(point) {
+		if fs, ok := m.mounts[point]; ok {
+			return point, fs, path.Clean("/" + strings.TrimPrefix(p, point))
+		}
+		if point == "/" {
+			return "", nil, ""
+		}
+	}
+}
+
+//p 下一级中通向挂载点的名称
+func (m *MountFs) children(p string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	prefix := p
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for point := range m.mounts {
+		if point == p || !strings.HasPrefix(point, prefix) {
+			continue
+		}
+		name := strings.SplitN(point[len(prefix):], "/", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//p 下是否有挂载点，包括 p 本身
+func (m *MountFs) busy(p string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for point := range m.mounts {
+		if point == p || p == "/" || strings.HasPrefix(point, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MountFs) isPoint(p string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	_, ok := m.mounts[p]
+	return ok
+}
+
+//合成的目录
+func mountDirInfo(p string) os.FileInfo {
+	return &FileInfo{name: path.Base(p), mode: os.ModeDir | 0555}
+}
+
+//错误中的路径改为 MountFs 中的路径
+func mountErr(err error, name string) error {
+	if e, ok := err.(*os.PathError); ok {
+		return &os.PathError{Op: e.Op, Path: name, Err: e.Err}
+	}
+	return err
+}
+
+//找到处理 name 的文件系统，不在任何挂载下时返回 err
+func (m *MountFs) backend(op, name string, err error) (FileSystem, string, error) {
+	p := path.Clean("/" + name)
+	_, fs, inner := m.resolve(p)
+	if fs == nil {
+		if len(m.children(p)) > 0 || p == "/" {
+			err = syscall.EROFS
+		}
+		return nil, "", &os.PathError{Op: op, Path: name, Err: err}
+	}
+	return fs, inner, nil
+}
+
+//修改操作，挂载点本身不能修改时返回 EBUSY
+func (m *MountFs) modify(op, name string, point bool, fn func(fs FileSystem, inner string) error) error {
+	p := path.Clean("/" + name)
+	if !point && m.busy(p) {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EBUSY}
+	}
+
+	fs, inner, err := m.backend(op, name, syscall.EROFS)
+	if err != nil {
+		return err
+	}
+	return mountErr(fn(fs, inner), name)
+}
+
+func (m *MountFs) Chmod(name string, mode os.FileMode) error {
+	return m.modify("chmod", name, true, func(fs FileSystem, inner string) error {
+		return fs.Chmod(inner, mode)
+	})
+}
+
+func (m *MountFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return m.modify("chtimes", name, true, func(fs FileSystem, inner string) error {
+		return fs.Chtimes(inner, atime, mtime)
+	})
+}
+
+func (m *MountFs) Mkdir(name string, perm os.FileMode) error {
+	p := path.Clean("/" + name)
+	if m.isPoint(p) || len(m.children(p)) > 0 {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	return m.modify("mkdir", name, false, func(fs FileSystem, inner string) error {
+		return fs.Mkdir(inner, perm)
+	})
+}
+
+func (m *MountFs) MkdirAll(pathName string, perm os.FileMode) error {
+	p := path.Clean("/" + pathName)
+	if m.isPoint(p) || len(m.children(p)) > 0 {
+		return nil
+	}
+	return m.modify("mkdir", pathName, false, func(fs FileSystem, inner string) error {
+		return fs.MkdirAll(inner, perm)
+	})
+}
+
+func (m *MountFs) Remove(name string) error {
+	return m.modify("remove", name, false, func(fs FileSystem, inner string) error {
+		return fs.Remove(inner)
+	})
+}
+
+func (m *MountFs) RemoveAll(pathName string) error {
+	return m.modify("removeall", pathName, false, func(fs FileSystem, inner string) error {
+		return fs.RemoveAll(inner)
+	})
+}
+
+func (m *MountFs) Rename(oldpath, newpath string) error {
+	po, pn := path.Clean("/"+oldpath), path.Clean("/"+newpath)
+	if m.busy(po) || m.busy(pn) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EBUSY}
+	}
+
+	point, fs, innerOld := m.resolve(po)
+	point2, _, innerNew := m.resolve(pn)
+	if fs == nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if point != point2 {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+
+	err := fs.Rename(innerOld, innerNew)
+	if e, ok := err.(*os.LinkError); ok {
+		err = &os.LinkError{Op: e.Op, Old: oldpath, New: newpath, Err: e.Err}
+	}
+	return err
+}
+
+func (m *MountFs) Truncate(name string, size int64) error {
+	return m.modify("truncate", name, true, func(fs FileSystem, inner string) error {
+		return fs.Truncate(inner, size)
+	})
+}
+
+func (m *MountFs) Create(name string) (file File, err error) {
+	return m.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (m *MountFs) Open(name string) (file File, err error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *MountFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	p := path.Clean("/" + name)
+
+	//含有下级挂载点的目录需合并列表，未挂载的根目录也是合成的
+	if len(m.children(p)) > 0 || p == "/" && !m.isPoint(p) {
+		if isWriteFlag(flag) {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		if _, err := m.Stat(p); err != nil {
+			return nil, err
+		}
+		return &mountDir{fs: m, name: name, path: p}, nil
+	}
+
+	e := error(os.ErrNotExist)
+	if flag&os.O_CREATE != 0 {
+		e = syscall.EROFS
+	}
+	fs, inner, err := m.backend("open", name, e)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err = fs.OpenFile(inner, flag, perm)
+	return file, mountErr(err, name)
+}
+
+func (m *MountFs) stat(op, name string, lstat bool) (os.FileInfo, error) {
+	p := path.Clean("/" + name)
+	point, fs, inner := m.resolve(p)
+
+	var fi os.FileInfo
+	err := error(os.ErrNotExist)
+	if fs != nil {
+		if lstat {
+			fi, err = fs.Lstat(inner)
+		} else {
+			fi, err = fs.Stat(inner)
+		}
+	}
+
+	if err == nil {
+		//挂载点使用 MountFs 中的名称
+		if p == point && p != "/" {
+			fi = &FileInfo{name: path.Base(p), size: fi.Size(), mode: fi.Mode(), modtime: fi.ModTime()}
+		}
+		return fi, nil
+	}
+	if p == "/" || len(m.children(p)) > 0 {
+		return mountDirInfo(p), nil
+	}
+	return nil, &os.PathError{Op: op, Path: name, Err: mountErrno(err)}
+}
+
+func mountErrno(err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	}
+	return err
+}
+
+func (m *MountFs) Stat(name string) (fi os.FileInfo, err error) {
+	return m.stat("stat", name, false)
+}
+
+func (m *MountFs) Lstat(name string) (fi os.FileInfo, err error) {
+	return m.stat("lstat", name, true)
+}
+
+//合并下层目录与挂载点的列表
+func (m *MountFs) readdir(p string) ([]os.FileInfo, error) {
+	seen := make(map[string]bool)
+	var list []os.FileInfo
+
+	for _, name := range m.children(p) {
+		fi, err := m.Stat(path.Join(p, name))
+		if err != nil {
+			fi = mountDirInfo(path.Join(p, name))
+		}
+		seen[name] = true
+		list = append(list, fi)
+	}
+
+	if _, fs, inner := m.resolve(p); fs != nil {
+		f, err := fs.Open(inner)
+		if err == nil {
+			fis, err := f.Readdir(-1)
+			f.Close()
+			if err != nil {
+				return nil, mountErr(err, p)
+			}
+			for _, fi := range fis {
+				if !seen[fi.Name()] {
+					list = append(list, fi)
+				}
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, mountErr(err, p)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+//合并后的目录对象
+type mountDir struct {
+	fs   *MountFs
+	name string
+	path string
+	list []os.FileInfo
+	read bool
+}
+
+func (d *mountDir) err(op string, err error) error {
+	return &os.PathError{Op: op, Path: d.name, Err: err}
+}
+
+func (d *mountDir) Chmod(mode os.FileMode) error {
+	return d.fs.Chmod(d.path, mode)
+}
+
+func (d *mountDir) Close() error {
+	d.list = nil
+	return nil
+}
+
+func (d *mountDir) Name() string {
+	return d.name
+}
+
+func (d *mountDir) Read(b []byte) (n int, err error) {
+	return 0, d.err("read", syscall.EISDIR)
+}
+
+func (d *mountDir) ReadAt(b []byte, off int64) (n int, err error) {
+	return 0, d.err("read", syscall.EISDIR)
+}
+
+func (d *mountDir) Readdir(n int) (fi []os.FileInfo, err error) {
+	if !d.read {
+		d.list, err = d.fs.readdir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+
+	if n > 0 && len(d.list) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(d.list) {
+		n = len(d.list)
+	}
+
+	fi = d.list[:n]
+	d.list = d.list[n:]
+	return
+}
+
+func (d *mountDir) Readdirnames(n int) (names []string, err error) {
+	fis, err := d.Readdir(n)
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return
+}
+
+func (d *mountDir) Seek(offset int64, whence int) (ret int64, err error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, d.err("seek", syscall.EINVAL)
+	}
+	d.list = nil
+	d.read = false
+	return 0, nil
+}
+
+func (d *mountDir) Stat() (fi os.FileInfo, err error) {
+	return d.fs.Stat(d.path)
+}
+
+func (d *mountDir) Sync() (err error) {
+	return nil
+}
+
+func (d *mountDir) Truncate(size int64) error {
+	return d.err("truncate", syscall.EISDIR)
+}
+
+func (d *mountDir) Write(b []byte) (n int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
+
+func (d *mountDir) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
+
+func (d *mountDir) WriteString(s string) (ret int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
@@ -0,0 +1,96 @@
+package netfs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+)
+
+func test_errno(err error) error {
+	switch e := err.(type) {
+	case *os.PathError:
+		return e.Err
+	case *os.LinkError:
+		return e.Err
+	}
+	return err
+}
+
+func Test_MountFs(t *testing.T) {
+	root := test_mem_fs(t, "r.txt")
+	tmp := test_mem_fs(t, "t.txt")
+	logs := test_mem_fs(t, "l.txt")
+
+	fs := new(MountFs).Init().Mount("/", root).Mount("/tmp", tmp).Mount("/data/logs", logs)
+
+	//挂载点与合成的上级目录
+	if s := test_list_dir(fs, "/"); s != "data,r.txt,tmp" {
+		t.Errorf("List expect:data,r.txt,tmp, get:%s", s)
+	}
+	if s := test_list_dir(fs, "/data"); s != "logs" {
+		t.Errorf("List expect:logs, get:%s", s)
+	}
+	if fi, err := fs.Stat("/data/logs"); err != nil || !fi.IsDir() || fi.Name() != "logs" {
+		t.Errorf("Stat expect:logs dir, get:%v %v", fi, err)
+	}
+	if s := test_read_file(fs, "/data/logs/l.txt"); s != "l.txt" {
+		t.Errorf("Read expect:l.txt, get:%s", s)
+	}
+
+	//按前缀分发
+	f, err := fs.Create("/tmp/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("a")
+	f.Close()
+	if s := test_read_file(tmp, "a.txt"); s != "a" {
+		t.Errorf("Read expect:a, get:%s", s)
+	}
+	if err := fs.MkdirAll("/data/logs/x/y", 0755); err != nil || test_list_dir(logs, "x") != "y" {
+		t.Errorf("MkdirAll expect:y, get:%v", err)
+	}
+
+	if err := fs.Rename("/tmp/a.txt", "/tmp/b.txt"); err != nil {
+		t.Errorf("Rename expect:nil, get:%v", err)
+	}
+	if err := fs.Rename("/tmp/b.txt", "/b.txt"); test_errno(err) != syscall.EXDEV {
+		t.Errorf("Rename expect:EXDEV, get:%v", err)
+	}
+	if err := fs.Rename("/tmp", "/tmp2"); test_errno(err) != syscall.EBUSY {
+		t.Errorf("Rename expect:EBUSY, get:%v", err)
+	}
+	if err := fs.Remove("/tmp"); test_errno(err) != syscall.EBUSY {
+		t.Errorf("Remove expect:EBUSY, get:%v", err)
+	}
+	if err := fs.RemoveAll("/data"); test_errno(err) != syscall.EBUSY {
+		t.Errorf("RemoveAll expect:EBUSY, get:%v", err)
+	}
+
+	//错误中的路径
+	if _, err := fs.Open("/tmp/none"); !os.IsNotExist(err) || err.Error() != "open /tmp/none: file does not exist" {
+		t.Errorf("Open expect:/tmp/none not exist, get:%v", err)
+	}
+}
+
+func Test_MountFs_NoRoot(t *testing.T) {
+	fs := new(MountFs).Init().Mount("/tmp", test_mem_fs(t, "t.txt"))
+
+	if s := test_list_dir(fs, "/"); s != "tmp" {
+		t.Errorf("List expect:tmp, get:%s", s)
+	}
+	if _, err := fs.Stat("/none"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+	if _, err := fs.Create("/x.txt"); !test_is_erofs(err) {
+		t.Errorf("Create expect:EROFS, get:%v", err)
+	}
+	if err := fs.Mkdir("/x", 0755); !test_is_erofs(err) {
+		t.Errorf("Mkdir expect:EROFS, get:%v", err)
+	}
+
+	fs.Unmount("/tmp")
+	if s := test_list_dir(fs, "/"); s != "" {
+		t.Errorf("List expect:empty, get:%s", s)
+	}
+}
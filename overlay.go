@@ -0,0 +1,617 @@
+package netfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//删除标记与不透明目录标记，保存在上层文件系统中
+const (
+	OverlayWhiteout = ".wh."
+	OverlayOpaque   = ".wh..wh..opq"
+)
+
+//叠加文件系统
+//Upper 为可写层，Lowers 为只读层(靠前的优先)，修改下层文件时先复制到上层
+type OverlayFs struct {
+	Upper  FileSystem
+	Lowers []FileSystem
+}
+
+func (o *OverlayFs) Init(upper FileSystem, lowers ...FileSystem) *OverlayFs {
+	o.Upper = upper
+	o.Lowers = lowers
+	return o
+}
+
+func overlayClean(name string) string {
+	return path.Clean("/" + name)
+}
+
+func overlayWhiteout(name string) string {
+	return path.Join(path.Dir(name), OverlayWhiteout+path.Base(name))
+}
+
+func (o *OverlayFs) layer(i int) FileSystem {
+	if i == 0 {
+		return o.Upper
+	}
+	return o.Lowers[i-1]
+}
+
+func (o *OverlayFs) upperHas(name string) bool {
+	_, err := o.Upper.Lstat(name)
+	return err == nil
+}
+
+//检查上级目录中的删除标记，返回路径是否被删除以及下层是否可见
+func (o *OverlayFs) visible(p string) (removed bool, lower bool) {
+	lower = true
+	if p == "/" {
+		return
+	}
+
+	elems := strings.Split(p[1:], "/")
+	dir := "/"
+
+	for _, elem := range elems {
+		if lower && o.upperHas(path.Join(dir, OverlayOpaque)) {
+			lower = false
+		}
+		if o.upperHas(path.Join(dir, OverlayWhiteout+elem)) {
+			return true, false
+		}
+		dir = path.Join(dir, elem)
+	}
+	return
+}
+
+//查找路径所在的层，0 为上层
+func (o *OverlayFs) find(op, p string) (int, os.FileInfo, error) {
+	removed, lower := o.visible(p)
+	if removed {
+		return 0, nil, &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+	}
+
+	fi, err := o.Upper.Lstat(p)
+	if err == nil {
+		return 0, fi, nil
+	}
+
+	if lower {
+		for i, fs := range o.Lowers {
+			fi, err := fs.Lstat(p)
+			if err == nil {
+				return i + 1, fi, nil
+			}
+		}
+	}
+
+	return 0, nil, &os.PathError{Op: op, Path: p, Err: os.ErrNotExist}
+}
+
+func (o *OverlayFs) lowerHas(p string) bool {
+	for _, fs := range o.Lowers {
+		if _, err := fs.Lstat(p); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//合并各层的目录列表
+func (o *OverlayFs) readdir(p string) ([]os.FileInfo, error) {
+	seen := make(map[string]bool)
+	var list []os.FileInfo
+
+	_, lower := o.visible(p)
+	found := false
+
+	add := func(fs FileSystem, upper bool) error {
+		fi, err := fs.Lstat(p)
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		found = true
+
+		dir, err := fs.Open(p)
+		if err != nil {
+			return err
+		}
+		defer dir.Close()
+
+		fis, err := dir.Readdir(-1)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		for _, fi := range fis {
+			name := fi.Name()
+			if upper && strings.HasPrefix(name, OverlayWhiteout) {
+				if name == OverlayOpaque {
+					lower = false
+				} else {
+					seen[name[len(OverlayWhiteout):]] = true
+				}
+				continue
+			}
+			if !seen[name] {
+				seen[name] = true
+				list = append(list, fi)
+			}
+		}
+		return nil
+	}
+
+	if err := add(o.Upper, true); err != nil {
+		return nil, err
+	}
+
+	if lower {
+		for _, fs := range o.Lowers {
+			if err := add(fs, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if !found {
+		return nil, &os.PathError{Op: "readdirent", Path: p, Err: syscall.ENOTDIR}
+	}
+	return list, nil
+}
+
+//复制到上层
+func (o *OverlayFs) copyUp(p string) error {
+	if o.upperHas(p) {
+		return nil
+	}
+
+	i, fi, err := o.find("copyup", p)
+	if err != nil {
+		return err
+	}
+
+	if p != "/" {
+		if err := o.copyUp(path.Dir(p)); err != nil {
+			return err
+		}
+	}
+
+	if fi.IsDir() {
+		err = o.Upper.Mkdir(p, fi.Mode().Perm())
+	} else {
+		err = o.copyFile(o.layer(i), p, fi)
+	}
+	if err != nil {
+		return err
+	}
+
+	return o.Upper.Chtimes(p, fi.ModTime(), fi.ModTime())
+}
+
+func (o *OverlayFs) copyFile(fs FileSystem, p string, fi os.FileInfo) error {
+	src, err := fs.Open(p)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := o.Upper.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+//递归复制整个目录到上层
+func (o *OverlayFs) copyUpTree(p string) error {
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+
+	fi, err := o.Upper.Lstat(p)
+	if err != nil || !fi.IsDir() {
+		return err
+	}
+
+	list, err := o.readdir(p)
+	if err != nil {
+		return err
+	}
+
+	for _, fi := range list {
+		if err := o.copyUpTree(path.Join(p, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//准备上层的父目录
+func (o *OverlayFs) copyUpParent(op, p string) error {
+	dir := path.Dir(p)
+
+	_, fi, err := o.find(op, dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: op, Path: p, Err: syscall.ENOTDIR}
+	}
+	return o.copyUp(dir)
+}
+
+func (o *OverlayFs) whiteout(p string) error {
+	if err := o.copyUp(path.Dir(p)); err != nil {
+		return err
+	}
+
+	f, err := o.Upper.Create(overlayWhiteout(p))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (o *OverlayFs) unwhiteout(p string) {
+	o.Upper.Remove(overlayWhiteout(p))
+}
+
+func (o *OverlayFs) opaque(p string) error {
+	f, err := o.Upper.Create(path.Join(p, OverlayOpaque))
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (o *OverlayFs) Chmod(name string, mode os.FileMode) error {
+	p := overlayClean(name)
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	return o.Upper.Chmod(p, mode)
+}
+
+func (o *OverlayFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	p := overlayClean(name)
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	return o.Upper.Chtimes(p, atime, mtime)
+}
+
+func (o *OverlayFs) Mkdir(name string, perm os.FileMode) error {
+	p := overlayClean(name)
+
+	if _, _, err := o.find("mkdir", p); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	}
+	if err := o.copyUpParent("mkdir", p); err != nil {
+		return err
+	}
+
+	o.unwhiteout(p)
+
+	if err := o.Upper.Mkdir(p, perm); err != nil {
+		return err
+	}
+
+	//下层同名目录已被删除，新目录不应显示其内容
+	if o.lowerHas(p) {
+		return o.opaque(p)
+	}
+	return nil
+}
+
+func (o *OverlayFs) MkdirAll(pathName string, perm os.FileMode) error {
+	p := overlayClean(pathName)
+	if p == "/" {
+		return nil
+	}
+
+	dir := "/"
+	for _, elem := range strings.Split(p[1:], "/") {
+		dir = path.Join(dir, elem)
+
+		_, fi, err := o.find("mkdir", dir)
+		if err == nil {
+			if !fi.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			continue
+		}
+
+		if err := o.Mkdir(dir, perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OverlayFs) Remove(name string) error {
+	p := overlayClean(name)
+
+	_, fi, err := o.find("remove", p)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		list, err := o.readdir(p)
+		if err != nil {
+			return err
+		}
+		if len(list) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+	}
+
+	return o.remove(p)
+}
+
+func (o *OverlayFs) RemoveAll(pathName string) error {
+	p := overlayClean(pathName)
+
+	if _, _, err := o.find("removeall", p); err != nil {
+		return nil
+	}
+	return o.remove(p)
+}
+
+func (o *OverlayFs) remove(p string) error {
+	if o.upperHas(p) {
+		if err := o.Upper.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+
+	if o.lowerHas(p) {
+		return o.whiteout(p)
+	}
+	return nil
+}
+
+func (o *OverlayFs) Rename(oldpath, newpath string) error {
+	op := overlayClean(oldpath)
+	np := overlayClean(newpath)
+
+	linkErr := func(err error) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+
+	_, ofi, err := o.find("rename", op)
+	if err != nil {
+		return linkErr(os.ErrNotExist)
+	}
+	if op == np {
+		return nil
+	}
+	if ofi.IsDir() && strings.HasPrefix(np, op+"/") {
+		return linkErr(syscall.EINVAL)
+	}
+
+	if _, nfi, err := o.find("rename", np); err == nil {
+		switch {
+		case nfi.IsDir() && !ofi.IsDir():
+			return linkErr(syscall.EISDIR)
+		case !nfi.IsDir() && ofi.IsDir():
+			return linkErr(syscall.ENOTDIR)
+		}
+
+		if nfi.IsDir() {
+			list, err := o.readdir(np)
+			if err != nil {
+				return err
+			}
+			if len(list) > 0 {
+				return linkErr(syscall.ENOTEMPTY)
+			}
+		}
+
+		if err := o.remove(np); err != nil {
+			return err
+		}
+	}
+
+	if err := o.copyUpTree(op); err != nil {
+		return err
+	}
+	if err := o.copyUpParent("rename", np); err != nil {
+		return err
+	}
+
+	o.unwhiteout(np)
+
+	if err := o.Upper.Rename(op, np); err != nil {
+		return err
+	}
+
+	if ofi.IsDir() && o.lowerHas(np) && !o.upperHas(path.Join(np, OverlayOpaque)) {
+		if err := o.opaque(np); err != nil {
+			return err
+		}
+	}
+
+	if o.lowerHas(op) {
+		return o.whiteout(op)
+	}
+	return nil
+}
+
+func (o *OverlayFs) Truncate(name string, size int64) error {
+	p := overlayClean(name)
+	if err := o.copyUp(p); err != nil {
+		return err
+	}
+	return o.Upper.Truncate(p, size)
+}
+
+func (o *OverlayFs) Create(name string) (file File, err error) {
+	return o.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (o *OverlayFs) Open(name string) (file File, err error) {
+	return o.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (o *OverlayFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	p := overlayClean(name)
+
+	i, fi, err := o.find("open", p)
+
+	if !isWriteFlag(flag) {
+		if err != nil {
+			return nil, err
+		}
+		if fi.IsDir() {
+			return &overlayDir{fs: o, name: name, path: p}, nil
+		}
+		return o.layer(i).OpenFile(p, flag, perm)
+	}
+
+	if err != nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		if err := o.copyUpParent("open", p); err != nil {
+			return nil, err
+		}
+		o.unwhiteout(p)
+		return o.Upper.OpenFile(p, flag, perm)
+	}
+
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if fi.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if err := o.copyUp(p); err != nil {
+		return nil, err
+	}
+	return o.Upper.OpenFile(p, flag, perm)
+}
+
+func (o *OverlayFs) Stat(name string) (fi os.FileInfo, err error) {
+	p := overlayClean(name)
+
+	i, _, err := o.find("stat", p)
+	if err != nil {
+		return nil, err
+	}
+	return o.layer(i).Stat(p)
+}
+
+func (o *OverlayFs) Lstat(name string) (fi os.FileInfo, err error) {
+	p := overlayClean(name)
+
+	_, fi, err = o.find("lstat", p)
+	return
+}
+
+//合并后的目录对象
+type overlayDir struct {
+	fs   *OverlayFs
+	name string
+	path string
+	list []os.FileInfo
+	read bool
+}
+
+func (d *overlayDir) err(op string, err error) error {
+	return &os.PathError{Op: op, Path: d.name, Err: err}
+}
+
+func (d *overlayDir) Chmod(mode os.FileMode) error {
+	return d.fs.Chmod(d.path, mode)
+}
+
+func (d *overlayDir) Close() error {
+	d.list = nil
+	return nil
+}
+
+func (d *overlayDir) Name() string {
+	return d.name
+}
+
+func (d *overlayDir) Read(b []byte) (n int, err error) {
+	return 0, d.err("read", syscall.EISDIR)
+}
+
+func (d *overlayDir) ReadAt(b []byte, off int64) (n int, err error) {
+	return 0, d.err("read", syscall.EISDIR)
+}
+
+func (d *overlayDir) Readdir(n int) (fi []os.FileInfo, err error) {
+	if !d.read {
+		d.list, err = d.fs.readdir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+
+	if n > 0 && len(d.list) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(d.list) {
+		n = len(d.list)
+	}
+
+	fi = d.list[:n]
+	d.list = d.list[n:]
+	return
+}
+
+func (d *overlayDir) Readdirnames(n int) (names []string, err error) {
+	fis, err := d.Readdir(n)
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return
+}
+
+func (d *overlayDir) Seek(offset int64, whence int) (ret int64, err error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, d.err("seek", syscall.EINVAL)
+	}
+	d.list = nil
+	d.read = false
+	return 0, nil
+}
+
+func (d *overlayDir) Stat() (fi os.FileInfo, err error) {
+	return d.fs.Stat(d.path)
+}
+
+func (d *overlayDir) Sync() (err error) {
+	return nil
+}
+
+func (d *overlayDir) Truncate(size int64) error {
+	return d.err("truncate", syscall.EISDIR)
+}
+
+func (d *overlayDir) Write(b []byte) (n int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
+
+func (d *overlayDir) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
+
+func (d *overlayDir) WriteString(s string) (ret int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
@@ -0,0 +1,160 @@
+package netfs
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func test_mem_fs(t *testing.T, files ...string) *MemFs {
+	fs := new(MemFs).Init()
+
+	for _, name := range files {
+		if strings.HasSuffix(name, "/") {
+			if err := fs.MkdirAll(name, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
+		f, err := fs.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(name)
+		f.Close()
+	}
+
+	return fs
+}
+
+func test_read_file(fs FileSystem, name string) string {
+	f, err := fs.Open(name)
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	b, _ := ioutil.ReadAll(f)
+	return string(b)
+}
+
+func test_list_dir(fs FileSystem, name string) string {
+	f, err := fs.Open(name)
+	if err != nil {
+		return err.Error()
+	}
+	defer f.Close()
+
+	names, _ := f.Readdirnames(-1)
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func Test_MemFs(t *testing.T) {
+	fs := test_mem_fs(t, "a/", "a/b.txt")
+
+	if s := test_read_file(fs, "a/b.txt"); s != "a/b.txt" {
+		t.Errorf("Read expect:a/b.txt, get:%s", s)
+	}
+
+	if err := fs.Remove("a"); err == nil {
+		t.Error("Remove non-empty dir expect:error, get:nil")
+	}
+
+	if err := fs.Rename("a/b.txt", "c.txt"); err != nil {
+		t.Errorf("Rename expect:nil, get:%v", err)
+	}
+
+	if s := test_list_dir(fs, "/"); s != "a,c.txt" {
+		t.Errorf("Readdirnames expect:a,c.txt, get:%s", s)
+	}
+
+	f, err := fs.OpenFile("c.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("!")
+	f.Close()
+
+	fi, err := fs.Stat("c.txt")
+	if err != nil || fi.Size() != 8 {
+		t.Errorf("Stat size expect:8, get:%v %v", fi, err)
+	}
+
+	if _, err := fs.Stat("a/b.txt"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+}
+
+func Test_OverlayFs(t *testing.T) {
+	lower := test_mem_fs(t, "etc/", "etc/hosts", "etc/passwd", "bin/", "bin/sh")
+	upper := test_mem_fs(t, "etc/", "etc/local")
+
+	fs := new(OverlayFs).Init(upper, lower)
+
+	if s := test_list_dir(fs, "etc"); s != "hosts,local,passwd" {
+		t.Errorf("Readdirnames expect:hosts,local,passwd, get:%s", s)
+	}
+
+	//写入时复制到上层
+	f, err := fs.OpenFile("etc/hosts", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("+")
+	f.Close()
+
+	if s := test_read_file(fs, "etc/hosts"); s != "etc/hosts+" {
+		t.Errorf("Read expect:etc/hosts+, get:%s", s)
+	}
+	if s := test_read_file(lower, "etc/hosts"); s != "etc/hosts" {
+		t.Errorf("Lower expect:etc/hosts, get:%s", s)
+	}
+
+	//删除下层文件
+	if err := fs.Remove("etc/passwd"); err != nil {
+		t.Errorf("Remove expect:nil, get:%v", err)
+	}
+	if _, err := fs.Stat("etc/passwd"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+	if s := test_list_dir(fs, "etc"); s != "hosts,local" {
+		t.Errorf("Readdirnames expect:hosts,local, get:%s", s)
+	}
+
+	//删除后重建的目录不显示下层内容
+	if err := fs.RemoveAll("bin"); err != nil {
+		t.Errorf("RemoveAll expect:nil, get:%v", err)
+	}
+	if err := fs.Mkdir("bin", 0755); err != nil {
+		t.Errorf("Mkdir expect:nil, get:%v", err)
+	}
+	if s := test_list_dir(fs, "bin"); s != "" {
+		t.Errorf("Readdirnames expect:empty, get:%s", s)
+	}
+
+	//新建文件需要复制上级目录
+	lower.MkdirAll("usr/lib", 0700)
+	f, err = fs.Create("usr/lib/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if fi, err := upper.Stat("usr/lib"); err != nil || fi.Mode().Perm() != 0700 {
+		t.Errorf("Upper usr/lib expect:0700, get:%v %v", fi, err)
+	}
+
+	if err := fs.Rename("etc", "conf"); err != nil {
+		t.Errorf("Rename expect:nil, get:%v", err)
+	}
+	if s := test_list_dir(fs, "conf"); s != "hosts,local" {
+		t.Errorf("Readdirnames expect:hosts,local, get:%s", s)
+	}
+	if s := test_list_dir(fs, "/"); s != "bin,conf,usr" {
+		t.Errorf("Readdirnames expect:bin,conf,usr, get:%s", s)
+	}
+}
@@ -0,0 +1,933 @@
+package netfs
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//9P2000.L 消息类型，应答为请求类型加一
+const (
+	p9Tlerror      uint8 = 6
+	p9Tstatfs      uint8 = 8
+	p9Tlopen       uint8 = 12
+	p9Tlcreate     uint8 = 14
+	p9Tsymlink     uint8 = 16
+	p9Tmknod       uint8 = 18
+	p9Trename      uint8 = 20
+	p9Treadlink    uint8 = 22
+	p9Tgetattr     uint8 = 24
+	p9Tsetattr     uint8 = 26
+	p9Txattrwalk   uint8 = 30
+	p9Txattrcreate uint8 = 32
+	p9Treaddir     uint8 = 40
+	p9Tfsync       uint8 = 50
+	p9Tlock        uint8 = 52
+	p9Tgetlock     uint8 = 54
+	p9Tlink        uint8 = 70
+	p9Tmkdir       uint8 = 72
+	p9Trenameat    uint8 = 74
+	p9Tunlinkat    uint8 = 76
+	p9Tversion     uint8 = 100
+	p9Tauth        uint8 = 102
+	p9Tattach      uint8 = 104
+	p9Tflush       uint8 = 108
+	p9Twalk        uint8 = 110
+	p9Tread        uint8 = 116
+	p9Twrite       uint8 = 118
+	p9Tclunk       uint8 = 120
+	p9Tremove      uint8 = 122
+)
+
+const (
+	p9Version  = "9P2000.L"
+	p9NoFid    = ^uint32(0)
+	p9IOHeader = 24
+
+	//qid 类型
+	p9QTDIR     uint8 = 0x80
+	p9QTSYMLINK uint8 = 0x02
+	p9QTFILE    uint8 = 0x00
+
+	//Tgetattr/Tsetattr 的字段掩码
+	p9GetattrBasic    uint64 = 0x7ff
+	p9SetattrMode     uint32 = 0x1
+	p9SetattrSize     uint32 = 0x8
+	p9SetattrAtime    uint32 = 0x10
+	p9SetattrMtime    uint32 = 0x20
+	p9SetattrAtimeSet uint32 = 0x80
+	p9SetattrMtimeSet uint32 = 0x100
+
+	//Tlock
+	p9LockRead    uint8 = 0
+	p9LockWrite   uint8 = 1
+	p9LockUnlock  uint8 = 2
+	p9LockSuccess uint8 = 0
+	p9LockBlocked uint8 = 1
+	p9LockError   uint8 = 2
+
+	p9AtRemoveDir uint32 = 0x200
+
+	//文件类型，与平台无关
+	p9IFDIR uint32 = 0040000
+	p9IFREG uint32 = 0100000
+	p9IFLNK uint32 = 0120000
+	p9DTDIR uint8  = 4
+	p9DTREG uint8  = 8
+	p9DTLNK uint8  = 10
+)
+
+//Linux 的错误码，下标与 errnoTable 一致
+var p9Errno = []uint32{
+	0,
+	2,   //ENOENT
+	17,  //EEXIST
+	13,  //EACCES
+	1,   //EPERM
+	20,  //ENOTDIR
+	21,  //EISDIR
+	39,  //ENOTEMPTY
+	30,  //EROFS
+	18,  //EXDEV
+	22,  //EINVAL
+	9,   //EBADF
+	28,  //ENOSPC
+	36,  //ENAMETOOLONG
+	40,  //ELOOP
+	11,  //EAGAIN
+	122, //EDQUOT
+}
+
+const (
+	p9EIO        uint32 = 5
+	p9EBADF      uint32 = 9
+	p9EINVAL     uint32 = 22
+	p9ENOSYS     uint32 = 38
+	p9ENODATA    uint32 = 61
+	p9EOPNOTSUPP uint32 = 95
+)
+
+//直接返回给客户端的 Linux 错误码
+type p9Error uint32
+
+func (e p9Error) Error() string {
+	return "9p errno " + strconv.Itoa(int(e))
+}
+
+func p9ErrnoOf(err error) uint32 {
+	switch e := err.(type) {
+	case p9Error:
+		return uint32(e)
+	case *os.PathError:
+		err = e.Err
+	case *os.LinkError:
+		err = e.Err
+	}
+	if code := errnoCode(err); code != 0 {
+		return p9Errno[code]
+	}
+	return p9EIO
+}
+
+func p9Errnum(errno syscall.Errno) p9Error {
+	return p9Error(p9Errno[errnoCode(errno)])
+}
+
+//9P2000.L 网关，把任意 FileSystem 提供给 Linux v9fs 及 QEMU virtio-9p 挂载
+//每个连接的请求按顺序处理，FS 为 Client 时同一时间只应服务一个连接
+type P9Server struct {
+	FS    FileSystem
+	Msize uint32
+
+	//报告给客户端的文件属主
+	Uid uint32
+	Gid uint32
+
+	//挂载检查，9P 不认证用户，uname 与 aname 均由客户端提供
+	//为 nil 时只允许挂载根目录
+	Allow func(uname, aname string, addr net.Addr) bool
+}
+
+func (s *P9Server) Init(fs FileSystem) *P9Server {
+	s.FS = fs
+	s.Msize = 128*1024 + p9IOHeader
+	return s
+}
+
+func (s *P9Server) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.Serve(conn)
+	}
+}
+
+//处理一个连接直到断开
+func (s *P9Server) Serve(conn net.Conn) {
+	c := &p9Conn{s: s, conn: conn, msize: s.Msize, fids: make(map[uint32]*p9Fid)}
+	defer c.close()
+
+	for {
+		typ, tag, m, err := c.read()
+		if err != nil {
+			if err != io.EOF {
+				getLog().Debug("9p closed", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+			return
+		}
+
+		if err := c.write(c.handle(typ, tag, m)); err != nil {
+			return
+		}
+	}
+}
+
+type p9Qid struct {
+	typ     uint8
+	version uint32
+	path    uint64
+}
+
+type p9Fid struct {
+	path    string
+	root    string //attach 的目录，".." 不能超出
+	file    File
+	append  bool
+	dirents []os.FileInfo
+}
+
+type p9Conn struct {
+	s     *P9Server
+	conn  net.Conn
+	msize uint32
+	fids  map[uint32]*p9Fid
+}
+
+func (c *p9Conn) read() (uint8, uint16, *p9Msg, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(c.conn, head[:]); err != nil {
+		return 0, 0, nil, err
+	}
+
+	size := binary.LittleEndian.Uint32(head[:])
+	if size < 7 || size > c.msize {
+		return 0, 0, nil, Data_Error("9P message size")
+	}
+
+	b := make([]byte, size-4)
+	if _, err := io.ReadFull(c.conn, b); err != nil {
+		return 0, 0, nil, err
+	}
+
+	m := &p9Msg{b: b}
+	return m.u8(), m.u16(), m, nil
+}
+
+func (c *p9Conn) write(r *p9Msg) error {
+	binary.LittleEndian.PutUint32(r.b, uint32(len(r.b)))
+	_, err := c.conn.Write(r.b)
+	return err
+}
+
+func (c *p9Conn) close() {
+	c.clunkAll()
+	c.conn.Close()
+}
+
+func (c *p9Conn) clunkAll() {
+	for id, f := range c.fids {
+		if f.file != nil {
+			f.file.Close()
+		}
+		delete(c.fids, id)
+	}
+}
+
+func (c *p9Conn) fid(id uint32) *p9Fid {
+	f, ok := c.fids[id]
+	if !ok {
+		panic(p9Error(p9EBADF))
+	}
+	return f
+}
+
+func (c *p9Conn) newFid(id uint32, name, root string) *p9Fid {
+	if _, ok := c.fids[id]; ok || id == p9NoFid {
+		panic(p9Error(p9EBADF))
+	}
+	f := &p9Fid{path: name, root: root}
+	c.fids[id] = f
+	return f
+}
+
+func (c *p9Conn) handle(typ uint8, tag uint16, m *p9Msg) (r *p9Msg) {
+	r = newP9Msg(typ+1, tag)
+
+	defer func() {
+		if x := recover(); x != nil {
+			var errno uint32
+			switch v := x.(type) {
+			case p9Error:
+				errno = uint32(v)
+			case Data_Error:
+				errno = p9EINVAL
+			default:
+				//单个请求出错不应使整个服务退出
+				getLog().Error("9p panic", "remote", c.conn.RemoteAddr().String(), "type", typ, "error", x)
+				errno = p9EIO
+			}
+			r = newP9Msg(p9Tlerror+1, tag)
+			r.pu32(errno)
+		}
+	}()
+
+	switch typ {
+	case p9Tversion:
+		c.version(m, r)
+	case p9Tattach:
+		c.attach(m, r)
+	case p9Twalk:
+		c.walk(m, r)
+	case p9Tclunk:
+		c.clunk(m)
+	case p9Tgetattr:
+		c.getattr(m, r)
+	case p9Tsetattr:
+		c.setattr(m)
+	case p9Tstatfs:
+		c.fid(m.u32())
+		c.statfs(r)
+	case p9Tlopen:
+		c.lopen(m, r)
+	case p9Tlcreate:
+		c.lcreate(m, r)
+	case p9Tread:
+		c.read9(m, r)
+	case p9Twrite:
+		c.write9(m, r)
+	case p9Tfsync:
+		if f := c.fid(m.u32()); f.file != nil {
+			p9Check(f.file.Sync())
+		}
+	case p9Treaddir:
+		c.readdir(m, r)
+	case p9Tmkdir:
+		c.mkdir(m, r)
+	case p9Trename:
+		c.rename(m)
+	case p9Trenameat:
+		c.renameat(m)
+	case p9Tunlinkat:
+		c.unlinkat(m)
+	case p9Tremove:
+		c.remove(m)
+	case p9Tlock:
+		c.lock(m, r)
+	case p9Tgetlock:
+		c.getlock(m, r)
+	case p9Tflush:
+		//请求按顺序处理，被取消的请求都已应答
+	case p9Txattrwalk:
+		panic(p9Error(p9ENODATA))
+	case p9Tauth, p9Txattrcreate, p9Tsymlink, p9Tmknod, p9Treadlink, p9Tlink:
+		panic(p9Error(p9EOPNOTSUPP))
+	default:
+		panic(p9Error(p9ENOSYS))
+	}
+	return r
+}
+
+func p9Check(err error) {
+	if err != nil {
+		panic(p9Error(p9ErrnoOf(err)))
+	}
+}
+
+func p9Join(dir, name string) string {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		panic(p9Errnum(syscall.EINVAL))
+	}
+	return path.Join(dir, name)
+}
+
+func (c *p9Conn) stat(name string) (os.FileInfo, p9Qid) {
+	fi, err := c.s.FS.Lstat(name)
+	p9Check(err)
+	return fi, p9QidOf(name, fi)
+}
+
+//FileSystem 没有 inode，以路径的哈希作为 qid.path
+func p9QidOf(name string, fi os.FileInfo) p9Qid {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	q := p9Qid{typ: p9QTFILE, version: uint32(fi.ModTime().UnixNano()), path: h.Sum64()}
+	switch {
+	case fi.IsDir():
+		q.typ = p9QTDIR
+	case fi.Mode()&os.ModeSymlink != 0:
+		q.typ = p9QTSYMLINK
+	}
+	return q
+}
+
+// ----- 会话 -----
+
+func (c *p9Conn) version(m, r *p9Msg) {
+	msize := m.u32()
+	version := m.str()
+
+	c.clunkAll()
+	if msize < c.msize {
+		c.msize = msize
+	}
+	if strings.HasPrefix(version, p9Version) {
+		version = p9Version
+	} else {
+		version = "unknown"
+	}
+
+	r.pu32(c.msize)
+	r.pstr(version)
+}
+
+//aname 为挂载的子目录，由此 walk 的 ".." 不会超出它
+func (c *p9Conn) attach(m, r *p9Msg) {
+	fid := m.u32()
+	m.u32() //afid
+	uname := m.str()
+	aname := m.str()
+
+	root := path.Clean("/" + aname)
+	if !c.allowed(uname, root) {
+		panic(p9Errnum(syscall.EACCES))
+	}
+	fi, q := c.stat(root)
+	if !fi.IsDir() {
+		panic(p9Errnum(syscall.ENOTDIR))
+	}
+
+	c.newFid(fid, root, root)
+	r.pqid(q)
+}
+
+func (c *p9Conn) allowed(uname, root string) bool {
+	if c.s.Allow == nil {
+		return root == "/"
+	}
+	return c.s.Allow(uname, root, c.conn.RemoteAddr())
+}
+
+func (c *p9Conn) walk(m, r *p9Msg) {
+	fid := m.u32()
+	f := c.fid(fid)
+	newfid := m.u32()
+	n := int(m.u16())
+
+	//newfid 与 fid 相同时在原 fid 上移动，已打开的 fid 不能移动
+	if newfid == fid && f.file != nil {
+		panic(p9Error(p9EBADF))
+	}
+
+	name := f.path
+	var qids []p9Qid
+	for i := 0; i < n; i++ {
+		elem := m.str()
+		next := name
+		if elem != ".." {
+			next = p9Join(name, elem)
+		} else if name != f.root {
+			next = path.Dir(name)
+		}
+
+		fi, err := c.s.FS.Lstat(next)
+		if err != nil {
+			//第一个就失败时返回错误，否则返回已成功的部分
+			if i == 0 {
+				p9Check(err)
+			}
+			break
+		}
+		name = next
+		qids = append(qids, p9QidOf(name, fi))
+	}
+
+	if len(qids) == n {
+		if newfid == fid {
+			f.path = name
+		} else {
+			c.newFid(newfid, name, f.root)
+		}
+	}
+
+	r.pu16(uint16(len(qids)))
+	for _, q := range qids {
+		r.pqid(q)
+	}
+}
+
+func (c *p9Conn) clunk(m *p9Msg) {
+	id := m.u32()
+	f := c.fid(id)
+	delete(c.fids, id)
+
+	if f.file != nil {
+		p9Check(f.file.Close())
+	}
+}
+
+// ----- 属性 -----
+
+func (c *p9Conn) getattr(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	m.u64() //request_mask
+
+	fi, q := c.stat(f.path)
+
+	mode := uint32(fi.Mode().Perm())
+	nlink := uint64(1)
+	switch q.typ {
+	case p9QTDIR:
+		mode |= p9IFDIR
+		nlink = 2
+	case p9QTSYMLINK:
+		mode |= p9IFLNK
+	default:
+		mode |= p9IFREG
+	}
+
+	size := uint64(fi.Size())
+	mtime := fi.ModTime()
+
+	r.pu64(p9GetattrBasic)
+	r.pqid(q)
+	r.pu32(mode)
+	r.pu32(c.s.Uid)
+	r.pu32(c.s.Gid)
+	r.pu64(nlink)
+	r.pu64(0) //rdev
+	r.pu64(size)
+	r.pu64(4096)
+	r.pu64((size + 511) / 512)
+	for i := 0; i < 3; i++ { //atime mtime ctime
+		r.pu64(uint64(mtime.Unix()))
+		r.pu64(uint64(mtime.Nanosecond()))
+	}
+	for i := 0; i < 4; i++ { //btime gen data_version
+		r.pu64(0)
+	}
+}
+
+//不支持修改属主，uid 与 gid 直接忽略
+func (c *p9Conn) setattr(m *p9Msg) {
+	f := c.fid(m.u32())
+	valid := m.u32()
+	mode := m.u32()
+	m.u32() //uid
+	m.u32() //gid
+	size := m.u64()
+	atime := time.Unix(int64(m.u64()), int64(m.u64()))
+	mtime := time.Unix(int64(m.u64()), int64(m.u64()))
+
+	if valid&p9SetattrMode != 0 {
+		p9Check(c.s.FS.Chmod(f.path, os.FileMode(mode&0777)))
+	}
+	if valid&p9SetattrSize != 0 {
+		p9Check(c.s.FS.Truncate(f.path, int64(size)))
+	}
+	if valid&(p9SetattrAtime|p9SetattrMtime) != 0 {
+		fi, _ := c.stat(f.path)
+		now := time.Now()
+
+		//FileInfo 中没有访问时间，未指定的一项沿用修改时间
+		a, t := fi.ModTime(), fi.ModTime()
+		if valid&p9SetattrAtime != 0 {
+			a = now
+			if valid&p9SetattrAtimeSet != 0 {
+				a = atime
+			}
+		}
+		if valid&p9SetattrMtime != 0 {
+			t = now
+			if valid&p9SetattrMtimeSet != 0 {
+				t = mtime
+			}
+		}
+		p9Check(c.s.FS.Chtimes(f.path, a, t))
+	}
+}
+
+//FileSystem 不提供容量信息，全部报告为 0
+func (c *p9Conn) statfs(r *p9Msg) {
+	r.pu32(0x01021997) //V9FS_MAGIC
+	r.pu32(4096)
+	for i := 0; i < 6; i++ { //blocks bfree bavail files ffree fsid
+		r.pu64(0)
+	}
+	r.pu32(255)
+}
+
+// ----- 打开与读写 -----
+
+//Linux 的 open 标志
+func p9OpenFlag(flags uint32) int {
+	var flag int
+	switch flags & 3 {
+	case 0:
+		flag = os.O_RDONLY
+	case 1:
+		flag = os.O_WRONLY
+	default:
+		flag = os.O_RDWR
+	}
+	if flags&0100 != 0 {
+		flag |= os.O_CREATE
+	}
+	if flags&0200 != 0 {
+		flag |= os.O_EXCL
+	}
+	if flags&01000 != 0 {
+		flag |= os.O_TRUNC
+	}
+	if flags&02000 != 0 {
+		flag |= os.O_APPEND
+	}
+	return flag
+}
+
+func (c *p9Conn) iounit() uint32 {
+	return c.msize - p9IOHeader
+}
+
+//目录不打开，读取目录时再按路径打开
+func (c *p9Conn) lopen(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	flags := m.u32()
+
+	if f.file != nil {
+		panic(p9Error(p9EBADF))
+	}
+
+	fi, q := c.stat(f.path)
+	if !fi.IsDir() {
+		flag := p9OpenFlag(flags)
+		file, err := c.s.FS.OpenFile(f.path, flag, 0)
+		p9Check(err)
+		f.file, f.append = file, flag&os.O_APPEND != 0
+	}
+
+	r.pqid(q)
+	r.pu32(c.iounit())
+}
+
+func (c *p9Conn) lcreate(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	name := p9Join(f.path, m.str())
+	flags := m.u32()
+	mode := m.u32()
+	m.u32() //gid
+
+	if f.file != nil {
+		panic(p9Error(p9EBADF))
+	}
+
+	flag := p9OpenFlag(flags) | os.O_CREATE
+	file, err := c.s.FS.OpenFile(name, flag, os.FileMode(mode&0777))
+	p9Check(err)
+
+	f.path, f.file, f.append = name, file, flag&os.O_APPEND != 0
+
+	_, q := c.stat(name)
+	r.pqid(q)
+	r.pu32(c.iounit())
+}
+
+func (c *p9Conn) read9(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	off := int64(m.u64())
+	count := m.u32()
+
+	if f.file == nil {
+		panic(p9Error(p9EBADF))
+	}
+	if count > c.iounit() {
+		count = c.iounit()
+	}
+
+	b := make([]byte, count)
+	n, err := f.file.ReadAt(b, off)
+	if err != nil && err != io.EOF {
+		p9Check(err)
+	}
+
+	r.pu32(uint32(n))
+	r.b = append(r.b, b[:n]...)
+}
+
+//以 O_APPEND 打开时忽略偏移
+func (c *p9Conn) write9(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	off := int64(m.u64())
+	data := m.bytes(int(m.u32()))
+
+	if f.file == nil {
+		panic(p9Error(p9EBADF))
+	}
+
+	var n int
+	var err error
+	if f.append {
+		n, err = f.file.Write(data)
+	} else {
+		n, err = f.file.WriteAt(data, off)
+	}
+	p9Check(err)
+
+	r.pu32(uint32(n))
+}
+
+//目录项的偏移为其序号，偏移为 0 时重新读取目录
+func (c *p9Conn) readdir(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	off := m.u64()
+	count := int(m.u32())
+
+	if off == 0 {
+		dir, err := c.s.FS.Open(f.path)
+		p9Check(err)
+		fis, err := dir.Readdir(-1)
+		dir.Close()
+		p9Check(err)
+		f.dirents = fis
+	}
+	if count > int(c.iounit()) {
+		count = int(c.iounit())
+	}
+
+	body := &p9Msg{}
+	for i := off; i < uint64(len(f.dirents)); i++ {
+		fi := f.dirents[i]
+		name := fi.Name()
+		if len(body.b)+24+len(name) > count {
+			break
+		}
+
+		q := p9QidOf(path.Join(f.path, name), fi)
+		dt := p9DTREG
+		switch q.typ {
+		case p9QTDIR:
+			dt = p9DTDIR
+		case p9QTSYMLINK:
+			dt = p9DTLNK
+		}
+
+		body.pqid(q)
+		body.pu64(i + 1)
+		body.pu8(dt)
+		body.pstr(name)
+	}
+
+	r.pu32(uint32(len(body.b)))
+	r.b = append(r.b, body.b...)
+}
+
+// ----- 目录操作 -----
+
+func (c *p9Conn) mkdir(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	name := p9Join(f.path, m.str())
+	mode := m.u32()
+	m.u32() //gid
+
+	p9Check(c.s.FS.Mkdir(name, os.FileMode(mode&0777)))
+
+	_, q := c.stat(name)
+	r.pqid(q)
+}
+
+func (c *p9Conn) rename(m *p9Msg) {
+	f := c.fid(m.u32())
+	dir := c.fid(m.u32())
+	name := p9Join(dir.path, m.str())
+
+	p9Check(c.s.FS.Rename(f.path, name))
+	f.path = name
+}
+
+func (c *p9Conn) renameat(m *p9Msg) {
+	olddir := c.fid(m.u32())
+	oldname := p9Join(olddir.path, m.str())
+	newdir := c.fid(m.u32())
+	newname := p9Join(newdir.path, m.str())
+
+	p9Check(c.s.FS.Rename(oldname, newname))
+}
+
+func (c *p9Conn) unlinkat(m *p9Msg) {
+	dir := c.fid(m.u32())
+	name := p9Join(dir.path, m.str())
+	flags := m.u32()
+
+	fi, _ := c.stat(name)
+	if flags&p9AtRemoveDir != 0 && !fi.IsDir() {
+		panic(p9Errnum(syscall.ENOTDIR))
+	}
+	if flags&p9AtRemoveDir == 0 && fi.IsDir() {
+		panic(p9Errnum(syscall.EISDIR))
+	}
+
+	p9Check(c.s.FS.Remove(name))
+}
+
+//Tremove 无论成功与否都释放 fid
+func (c *p9Conn) remove(m *p9Msg) {
+	id := m.u32()
+	f := c.fid(id)
+	delete(c.fids, id)
+
+	if f.file != nil {
+		f.file.Close()
+	}
+	p9Check(c.s.FS.Remove(f.path))
+}
+
+// ----- 锁 -----
+
+//只做非阻塞尝试，冲突时返回 BLOCKED 由客户端重试
+func (c *p9Conn) lock(m, r *p9Msg) {
+	f := c.fid(m.u32())
+	typ := m.u8()
+	m.u32() //flags
+	start := int64(m.u64())
+	length := int64(m.u64())
+
+	if f.file == nil {
+		panic(p9Error(p9EBADF))
+	}
+
+	var err error
+	switch typ {
+	case p9LockRead:
+		err = fileTryLock(f.file, LOCK_SH, start, length)
+	case p9LockWrite:
+		err = fileTryLock(f.file, LOCK_EX, start, length)
+	case p9LockUnlock:
+		err = fileUnlock(f.file, start, length)
+	default:
+		err = syscall.EINVAL
+	}
+
+	//文件不支持锁时不能报告加锁成功，否则客户端会以为持有并不存在的锁
+	if err == errNoLock && typ == p9LockUnlock {
+		err = nil
+	}
+
+	status := p9LockSuccess
+	if isLocked(err) {
+		status = p9LockBlocked
+	} else if err != nil {
+		status = p9LockError
+	}
+	r.pu8(status)
+}
+
+//无法查询锁的持有者，总是报告没有冲突
+func (c *p9Conn) getlock(m, r *p9Msg) {
+	c.fid(m.u32())
+	m.u8()
+	start := m.u64()
+	length := m.u64()
+	procID := m.u32()
+	clientID := m.str()
+
+	r.pu8(p9LockUnlock)
+	r.pu64(start)
+	r.pu64(length)
+	r.pu32(procID)
+	r.pstr(clientID)
+}
+
+// ----- 消息编解码，小端序 -----
+
+type p9Msg struct {
+	b   []byte
+	off int
+}
+
+//消息开头 4 字节的长度在发送时填写
+func newP9Msg(typ uint8, tag uint16) *p9Msg {
+	m := &p9Msg{b: make([]byte, 4, 64)}
+	m.pu8(typ)
+	m.pu16(tag)
+	return m
+}
+
+func (m *p9Msg) bytes(n int) []byte {
+	if n < 0 || m.off+n > len(m.b) {
+		panic(Data_Error("9P message too short"))
+	}
+	b := m.b[m.off : m.off+n]
+	m.off += n
+	return b
+}
+
+func (m *p9Msg) u8() uint8 {
+	return m.bytes(1)[0]
+}
+
+func (m *p9Msg) u16() uint16 {
+	return binary.LittleEndian.Uint16(m.bytes(2))
+}
+
+func (m *p9Msg) u32() uint32 {
+	return binary.LittleEndian.Uint32(m.bytes(4))
+}
+
+func (m *p9Msg) u64() uint64 {
+	return binary.LittleEndian.Uint64(m.bytes(8))
+}
+
+func (m *p9Msg) str() string {
+	return string(m.bytes(int(m.u16())))
+}
+
+func (m *p9Msg) qid() p9Qid {
+	return p9Qid{typ: m.u8(), version: m.u32(), path: m.u64()}
+}
+
+func (m *p9Msg) pu8(v uint8) {
+	m.b = append(m.b, v)
+}
+
+func (m *p9Msg) pu16(v uint16) {
+	m.b = append(m.b, byte(v), byte(v>>8))
+}
+
+func (m *p9Msg) pu32(v uint32) {
+	m.b = append(m.b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func (m *p9Msg) pu64(v uint64) {
+	m.pu32(uint32(v))
+	m.pu32(uint32(v >> 32))
+}
+
+func (m *p9Msg) pstr(s string) {
+	m.pu16(uint16(len(s)))
+	m.b = append(m.b, s...)
+}
+
+func (m *p9Msg) pqid(q p9Qid) {
+	m.pu8(q.typ)
+	m.pu32(q.version)
+	m.pu64(q.path)
+}
@@ -0,0 +1,525 @@
+package netfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+//进程内的 9P2000.L 客户端
+type test_p9_client struct {
+	t    *testing.T
+	conn net.Conn
+	tag  uint16
+}
+
+func test_p9_dial(t *testing.T, fs FileSystem) *test_p9_client {
+	return test_p9_serve(t, new(P9Server).Init(fs))
+}
+
+//建立连接并挂载根目录
+func test_p9_serve(t *testing.T, s *P9Server) *test_p9_client {
+	c1, c2 := net.Pipe()
+	go s.Serve(c2)
+
+	c := &test_p9_client{t: t, conn: c1}
+
+	r, errno := c.rpc(p9Tversion, func(m *p9Msg) {
+		m.pu32(8192)
+		m.pstr("9P2000.L")
+	})
+	if errno != 0 {
+		t.Fatalf("Tversion errno:%d", errno)
+	}
+	if msize, version := r.u32(), r.str(); msize != 8192 || version != "9P2000.L" {
+		t.Fatalf("Rversion expect:8192 9P2000.L, get:%d %s", msize, version)
+	}
+
+	if _, errno := c.rpc(p9Tattach, func(m *p9Msg) {
+		m.pu32(0)
+		m.pu32(p9NoFid)
+		m.pstr("root")
+		m.pstr("")
+		m.pu32(0)
+	}); errno != 0 {
+		t.Fatalf("Tattach errno:%d", errno)
+	}
+	return c
+}
+
+//返回应答的消息体，出错时返回 Linux 错误码
+func (c *test_p9_client) rpc(typ uint8, body func(m *p9Msg)) (*p9Msg, uint32) {
+	c.tag++
+	m := newP9Msg(typ, c.tag)
+	body(m)
+	binary.LittleEndian.PutUint32(m.b, uint32(len(m.b)))
+	if _, err := c.conn.Write(m.b); err != nil {
+		c.t.Fatal(err)
+	}
+
+	var head [4]byte
+	if _, err := io.ReadFull(c.conn, head[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	b := make([]byte, binary.LittleEndian.Uint32(head[:])-4)
+	if _, err := io.ReadFull(c.conn, b); err != nil {
+		c.t.Fatal(err)
+	}
+
+	r := &p9Msg{b: b}
+	rtyp, tag := r.u8(), r.u16()
+	if tag != c.tag {
+		c.t.Fatalf("tag expect:%d, get:%d", c.tag, tag)
+	}
+	if rtyp == p9Tlerror+1 {
+		return nil, r.u32()
+	}
+	if rtyp != typ+1 {
+		c.t.Fatalf("type expect:%d, get:%d", typ+1, rtyp)
+	}
+	return r, 0
+}
+
+func (c *test_p9_client) walk(fid, newfid uint32, names ...string) uint32 {
+	_, errno := c.rpc(p9Twalk, func(m *p9Msg) {
+		m.pu32(fid)
+		m.pu32(newfid)
+		m.pu16(uint16(len(names)))
+		for _, name := range names {
+			m.pstr(name)
+		}
+	})
+	return errno
+}
+
+func (c *test_p9_client) clunk(fid uint32) {
+	if _, errno := c.rpc(p9Tclunk, func(m *p9Msg) { m.pu32(fid) }); errno != 0 {
+		c.t.Errorf("Tclunk expect:0, get:%d", errno)
+	}
+}
+
+//读取整个文件
+func (c *test_p9_client) read(names ...string) string {
+	if errno := c.walk(0, 1, names...); errno != 0 {
+		return fmt.Sprintf("errno %d", errno)
+	}
+	defer c.clunk(1)
+
+	c.rpc(p9Tlopen, func(m *p9Msg) {
+		m.pu32(1)
+		m.pu32(0)
+	})
+
+	var data []byte
+	for {
+		r, errno := c.rpc(p9Tread, func(m *p9Msg) {
+			m.pu32(1)
+			m.pu64(uint64(len(data)))
+			m.pu32(4)
+		})
+		if errno != 0 {
+			c.t.Fatalf("Tread errno:%d", errno)
+		}
+		n := int(r.u32())
+		if n == 0 {
+			return string(data)
+		}
+		data = append(data, r.bytes(n)...)
+	}
+}
+
+func (c *test_p9_client) readdir(names ...string) string {
+	c.walk(0, 1, names...)
+	defer c.clunk(1)
+
+	c.rpc(p9Tlopen, func(m *p9Msg) {
+		m.pu32(1)
+		m.pu32(0)
+	})
+
+	var list []string
+	var off uint64
+	for {
+		r, errno := c.rpc(p9Treaddir, func(m *p9Msg) {
+			m.pu32(1)
+			m.pu64(off)
+			m.pu32(40)
+		})
+		if errno != 0 {
+			c.t.Fatalf("Treaddir errno:%d", errno)
+		}
+
+		n := int(r.u32())
+		if n == 0 {
+			break
+		}
+		entries := &p9Msg{b: r.bytes(n)}
+		for entries.off < n {
+			q := entries.qid()
+			off = entries.u64()
+			typ := entries.u8()
+			name := entries.str()
+			if (q.typ == p9QTDIR) != (typ == p9DTDIR) {
+				c.t.Errorf("Dirent %s qid:%d type:%d", name, q.typ, typ)
+			}
+			if q.typ == p9QTDIR {
+				name += "/"
+			}
+			list = append(list, name)
+		}
+	}
+
+	sort.Strings(list)
+	return strings.Join(list, ",")
+}
+
+func Test_P9Server(t *testing.T) {
+	if len(p9Errno) != len(errnoTable) {
+		t.Fatalf("p9Errno expect:%d, get:%d", len(errnoTable), len(p9Errno))
+	}
+
+	fs := test_mem_fs(t, "a/", "a/b.txt", "c.txt")
+	c := test_p9_dial(t, fs)
+	defer c.conn.Close()
+
+	if s := c.read("a", "b.txt"); s != "a/b.txt" {
+		t.Errorf("Read expect:a/b.txt, get:%s", s)
+	}
+	if s := c.readdir(); s != "a/,c.txt" {
+		t.Errorf("Readdir expect:a/,c.txt, get:%s", s)
+	}
+
+	//不存在的路径
+	if errno := c.walk(0, 1, "none"); errno != 2 {
+		t.Errorf("Walk expect:2, get:%d", errno)
+	}
+	//部分成功时不建立 newfid
+	r, errno := c.rpc(p9Twalk, func(m *p9Msg) {
+		m.pu32(0)
+		m.pu32(1)
+		m.pu16(2)
+		m.pstr("a")
+		m.pstr("none")
+	})
+	if errno != 0 || r.u16() != 1 {
+		t.Errorf("Walk expect:1 qid, get:%d", errno)
+	}
+	if _, errno := c.rpc(p9Tclunk, func(m *p9Msg) { m.pu32(1) }); errno != 9 {
+		t.Errorf("Clunk expect:9, get:%d", errno)
+	}
+
+	//创建并写入
+	c.walk(0, 1, "a")
+	if _, errno := c.rpc(p9Tlcreate, func(m *p9Msg) {
+		m.pu32(1)
+		m.pstr("new.txt")
+		m.pu32(1) //O_WRONLY
+		m.pu32(0644)
+		m.pu32(0)
+	}); errno != 0 {
+		t.Fatalf("Tlcreate errno:%d", errno)
+	}
+	r, errno = c.rpc(p9Twrite, func(m *p9Msg) {
+		m.pu32(1)
+		m.pu64(0)
+		m.pu32(5)
+		m.b = append(m.b, "hello"...)
+	})
+	if errno != 0 || r.u32() != 5 {
+		t.Errorf("Write expect:5, get:%d", errno)
+	}
+	c.clunk(1)
+
+	if s := test_read_file(fs, "a/new.txt"); s != "hello" {
+		t.Errorf("Read expect:hello, get:%s", s)
+	}
+
+	//截断并读取属性
+	c.walk(0, 1, "a", "new.txt")
+	c.rpc(p9Tsetattr, func(m *p9Msg) {
+		m.pu32(1)
+		m.pu32(p9SetattrSize)
+		m.pu32(0)
+		m.pu32(0)
+		m.pu32(0)
+		m.pu64(2)
+		for i := 0; i < 4; i++ {
+			m.pu64(0)
+		}
+	})
+	r, errno = c.rpc(p9Tgetattr, func(m *p9Msg) {
+		m.pu32(1)
+		m.pu64(p9GetattrBasic)
+	})
+	if errno != 0 {
+		t.Fatalf("Tgetattr errno:%d", errno)
+	}
+	r.u64()
+	r.qid()
+	mode := r.u32()
+	r.bytes(4 + 4 + 8 + 8)
+	if size := r.u64(); size != 2 || mode != p9IFREG|0644 {
+		t.Errorf("Getattr expect:2 %o, get:%d %o", p9IFREG|0644, size, mode)
+	}
+	c.clunk(1)
+
+	//目录操作
+	c.rpc(p9Tmkdir, func(m *p9Msg) {
+		m.pu32(0)
+		m.pstr("d")
+		m.pu32(0755)
+		m.pu32(0)
+	})
+	c.walk(0, 1, "a")
+	c.walk(0, 2, "d")
+	if _, errno := c.rpc(p9Trenameat, func(m *p9Msg) {
+		m.pu32(1)
+		m.pstr("new.txt")
+		m.pu32(2)
+		m.pstr("new.txt")
+	}); errno != 0 {
+		t.Errorf("Renameat expect:0, get:%d", errno)
+	}
+	c.clunk(1)
+	c.clunk(2)
+
+	if s := c.readdir("d"); s != "new.txt" {
+		t.Errorf("Readdir expect:new.txt, get:%s", s)
+	}
+
+	unlink := func(name string, flags uint32) uint32 {
+		_, errno := c.rpc(p9Tunlinkat, func(m *p9Msg) {
+			m.pu32(0)
+			m.pstr(name)
+			m.pu32(flags)
+		})
+		return errno
+	}
+	if errno := unlink("d", 0); errno != 21 {
+		t.Errorf("Unlinkat expect:21, get:%d", errno)
+	}
+	if errno := unlink("d", p9AtRemoveDir); errno != 39 {
+		t.Errorf("Unlinkat expect:39, get:%d", errno)
+	}
+	if errno := unlink("c.txt", 0); errno != 0 {
+		t.Errorf("Unlinkat expect:0, get:%d", errno)
+	}
+	if s := c.readdir(); s != "a/,d/" {
+		t.Errorf("Readdir expect:a/,d/, get:%s", s)
+	}
+
+	//不支持的操作
+	if _, errno := c.rpc(p9Tsymlink, func(m *p9Msg) {}); errno != 95 {
+		t.Errorf("Symlink expect:95, get:%d", errno)
+	}
+
+	//".." 不能超出 attach 的子目录
+	s := new(P9Server).Init(fs)
+	s.Allow = func(uname, aname string, addr net.Addr) bool {
+		return uname == "root"
+	}
+	c = test_p9_serve(t, s)
+	defer c.conn.Close()
+
+	if _, errno := c.rpc(p9Tattach, func(m *p9Msg) {
+		m.pu32(10)
+		m.pu32(p9NoFid)
+		m.pstr("root")
+		m.pstr("a")
+		m.pu32(0)
+	}); errno != 0 {
+		t.Fatalf("Tattach errno:%d", errno)
+	}
+	for _, test := range []struct {
+		names []string
+		n     uint16
+	}{
+		{[]string{"..", "..", "b.txt"}, 3},
+		{[]string{"..", "c.txt"}, 1},
+	} {
+		r, errno := c.rpc(p9Twalk, func(m *p9Msg) {
+			m.pu32(10)
+			m.pu32(11)
+			m.pu16(uint16(len(test.names)))
+			for _, name := range test.names {
+				m.pstr(name)
+			}
+		})
+		if errno != 0 || r.u16() != test.n {
+			t.Errorf("Walk %v expect:%d, get:%d", test.names, test.n, errno)
+		}
+		if test.n == uint16(len(test.names)) {
+			c.clunk(11)
+		}
+	}
+}
+
+//Lstat 指定文件时 panic
+type test_panic_fs struct {
+	FileSystem
+	name string
+}
+
+func (fs test_panic_fs) Lstat(name string) (os.FileInfo, error) {
+	if name == fs.name {
+		panic("test panic")
+	}
+	return fs.FileSystem.Lstat(name)
+}
+
+func Test_P9Server_Attach(t *testing.T) {
+	fs := test_mem_fs(t, "a/", "a/b.txt", "c.txt")
+	s := new(P9Server).Init(test_panic_fs{fs, "/a/b.txt"})
+	c := test_p9_serve(t, s)
+	defer c.conn.Close()
+
+	attach := func(fid uint32, uname, aname string) uint32 {
+		_, errno := c.rpc(p9Tattach, func(m *p9Msg) {
+			m.pu32(fid)
+			m.pu32(p9NoFid)
+			m.pstr(uname)
+			m.pstr(aname)
+			m.pu32(0)
+		})
+		return errno
+	}
+
+	//默认只允许挂载根目录
+	if errno := attach(10, "root", "a"); errno != 13 {
+		t.Errorf("Attach expect:13, get:%d", errno)
+	}
+	if errno := attach(10, "root", "/"); errno != 0 {
+		t.Errorf("Attach expect:0, get:%d", errno)
+	}
+
+	var unames []string
+	s.Allow = func(uname, aname string, addr net.Addr) bool {
+		unames = append(unames, uname+":"+aname)
+		return uname == "bob" && aname == "/a"
+	}
+	if errno := attach(11, "alice", "a"); errno != 13 {
+		t.Errorf("Attach expect:13, get:%d", errno)
+	}
+	if errno := attach(11, "bob", "a/../a"); errno != 0 {
+		t.Errorf("Attach expect:0, get:%d", errno)
+	}
+	if s := strings.Join(unames, ","); s != "alice:/a,bob:/a" {
+		t.Errorf("Allow expect:alice:/a,bob:/a, get:%s", s)
+	}
+
+	//文件系统 panic 时返回 EIO，连接仍可用
+	if errno := c.walk(0, 1, "a", "b.txt"); errno != 5 {
+		t.Errorf("Walk expect:5, get:%d", errno)
+	}
+	if s := c.readdir("a"); s != "b.txt" {
+		t.Errorf("Readdir expect:b.txt, get:%s", s)
+	}
+}
+
+func (c *test_p9_client) lock(fid uint32, typ uint8) (uint8, uint32) {
+	r, errno := c.rpc(p9Tlock, func(m *p9Msg) {
+		m.pu32(fid)
+		m.pu8(typ)
+		m.pu32(0)
+		m.pu64(0)
+		m.pu64(0)
+		m.pu32(1)
+		m.pstr("test")
+	})
+	if errno != 0 {
+		return 0, errno
+	}
+	return r.u8(), 0
+}
+
+func (c *test_p9_client) open(fid uint32, names ...string) {
+	if errno := c.walk(0, fid, names...); errno != 0 {
+		c.t.Fatalf("Twalk errno:%d", errno)
+	}
+	if _, errno := c.rpc(p9Tlopen, func(m *p9Msg) {
+		m.pu32(fid)
+		m.pu32(2) //O_RDWR
+	}); errno != 0 {
+		c.t.Fatalf("Tlopen errno:%d", errno)
+	}
+}
+
+func Test_P9Server_Lock(t *testing.T) {
+	//不支持锁的文件
+	c := test_p9_dial(t, test_mem_fs(t, "a.txt"))
+	defer c.conn.Close()
+
+	c.walk(0, 1, "a.txt")
+	if _, errno := c.lock(1, p9LockWrite); errno != 9 {
+		t.Errorf("Lock unopened expect:9, get:%d", errno)
+	}
+	c.clunk(1)
+
+	c.open(1, "a.txt")
+	if status, _ := c.lock(1, p9LockWrite); status != p9LockError {
+		t.Errorf("Lock unsupported expect:%d, get:%d", p9LockError, status)
+	}
+	if status, _ := c.lock(1, p9LockUnlock); status != p9LockSuccess {
+		t.Errorf("Unlock unsupported expect:%d, get:%d", p9LockSuccess, status)
+	}
+
+	fs, clean := test_local_fs(t, "a.txt")
+	defer clean()
+	f, err := fs.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok := f.(FileLocker)
+	f.Close()
+	if !ok {
+		t.Skip("LocalFs has no locks on this platform")
+	}
+
+	c2 := test_p9_dial(t, fs)
+	defer c2.conn.Close()
+	c2.open(1, "a.txt")
+	c2.open(2, "a.txt")
+
+	if status, _ := c2.lock(1, p9LockWrite); status != p9LockSuccess {
+		t.Errorf("Lock expect:%d, get:%d", p9LockSuccess, status)
+	}
+	if status, _ := c2.lock(2, p9LockRead); status != p9LockBlocked {
+		t.Errorf("Lock conflict expect:%d, get:%d", p9LockBlocked, status)
+	}
+	if status, _ := c2.lock(1, p9LockUnlock); status != p9LockSuccess {
+		t.Errorf("Unlock expect:%d, get:%d", p9LockSuccess, status)
+	}
+	if status, _ := c2.lock(2, p9LockRead); status != p9LockSuccess {
+		t.Errorf("Lock after unlock expect:%d, get:%d", p9LockSuccess, status)
+	}
+}
+
+func Test_P9Server_Client(t *testing.T) {
+	exports := new(Exports).Init()
+	exports.Add(&Share{Fs: test_mem_fs(t, "a.txt")})
+
+	go exports.Listen("127.0.0.1:11131")
+	time.Sleep(100 * time.Millisecond)
+
+	client, err := Dial("127.0.0.1:11131")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	c := test_p9_dial(t, client)
+	defer c.conn.Close()
+
+	if s := c.read("a.txt"); s != "a.txt" {
+		t.Errorf("Read expect:a.txt, get:%s", s)
+	}
+	if errno := c.walk(0, 1, "none"); errno != 2 {
+		t.Errorf("Walk expect:2, get:%d", errno)
+	}
+}
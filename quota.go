@@ -0,0 +1,637 @@
+package netfs
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+//配额限制，值为 0 时不限制
+type QuotaLimit struct {
+	Bytes  int64
+	Inodes int64
+}
+
+type QuotaUsage struct {
+	Bytes  int64
+	Inodes int64
+}
+
+//共享目录的存储配额
+//Export 限制整个共享目录，Principal 为每个已认证用户的默认限制，Principals 可单独指定。
+//用户用量按文件的所有者统计：创建者为所有者，所有者未知的文件由第一个写入它的已认证用户接管，
+//未认证用户创建的文件只计入共享目录的用量。
+//所有者记录在 Index 文件中，Scan 据此重新计算每个用户的用量；Index 为空时只保存在内存中，重启后用户用量从零开始。
+//超出配额时返回 syscall.EDQUOT，客户端可据此识别。
+type Quota struct {
+	Export     QuotaLimit
+	Principal  QuotaLimit
+	Principals map[string]QuotaLimit
+	Index      string //所有者索引的本地路径，应放在共享目录之外
+
+	mu     sync.Mutex
+	fs     FileSystem
+	usage  QuotaUsage
+	users  map[string]*QuotaUsage
+	owners map[string]string
+}
+
+func (q *Quota) init(fs FileSystem) error {
+	q.mu.Lock()
+	q.fs = fs
+	q.users = make(map[string]*QuotaUsage)
+	q.owners = make(map[string]string)
+	q.mu.Unlock()
+
+	if err := q.load(); err != nil {
+		return err
+	}
+	return q.Scan()
+}
+
+//读取所有者索引
+func (q *Quota) load() error {
+	if q.Index == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(q.Index)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	owners := make(map[string]string)
+	if err := json.Unmarshal(b, &owners); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.owners = owners
+	q.mu.Unlock()
+	return nil
+}
+
+//保存所有者索引，先写临时文件再改名，调用方需持有锁
+func (q *Quota) save() {
+	if q.Index == "" {
+		return
+	}
+
+	b, err := json.Marshal(q.owners)
+	if err == nil {
+		tmp := q.Index + ".tmp"
+		if err = ioutil.WriteFile(tmp, b, 0600); err == nil {
+			err = os.Rename(tmp, q.Index)
+		}
+	}
+	if err != nil {
+		getLog().Warn("quota index save failed", "index", q.Index, "error", err)
+	}
+}
+
+//修改限制，已有的用量不变，可在使用中调用
+func (q *Quota) SetLimits(export, principal QuotaLimit, principals map[string]QuotaLimit) {
+	q.mu.Lock()
+	q.Export, q.Principal, q.Principals = export, principal, principals
+	q.mu.Unlock()
+}
+
+func (q *Quota) Usage() QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.usage
+}
+
+func (q *Quota) PrincipalUsage(principal string) QuotaUsage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if u, ok := q.users[principal]; ok {
+		return *u
+	}
+	return QuotaUsage{}
+}
+
+func (q *Quota) limit(principal string) QuotaLimit {
+	if l, ok := q.Principals[principal]; ok {
+		return l
+	}
+	return q.Principal
+}
+
+//重新扫描整个共享目录计算用量
+func (q *Quota) Scan() error {
+	sizes := make(map[string]int64)
+	var usage QuotaUsage
+
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		f, err := q.fs.Open(dir)
+		if err != nil {
+			return err
+		}
+		fis, err := f.Readdir(-1)
+		f.Close()
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		for _, fi := range fis {
+			p := path.Join(dir, fi.Name())
+			usage.Inodes++
+			sizes[p] = 0
+
+			if fi.Mode().IsRegular() {
+				usage.Bytes += fi.Size()
+				sizes[p] = fi.Size()
+			} else if fi.IsDir() {
+				if err := walk(p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	if err := walk("/"); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	users := make(map[string]*QuotaUsage)
+	pruned := false
+	for p, principal := range q.owners {
+		size, ok := sizes[p]
+		if !ok {
+			delete(q.owners, p)
+			pruned = true
+			continue
+		}
+
+		u, ok := users[principal]
+		if !ok {
+			u = new(QuotaUsage)
+			users[principal] = u
+		}
+		u.Bytes += size
+		u.Inodes++
+	}
+
+	q.usage = usage
+	q.users = users
+	if pruned {
+		q.save()
+	}
+	return nil
+}
+
+func quotaExceeded(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EDQUOT}
+}
+
+//预占用量，超出任一限制时返回错误，调用方需持有锁
+func (q *Quota) reserve(op, name, owner string, bytes, inodes int64) error {
+	if bytes > 0 && q.Export.Bytes > 0 && q.usage.Bytes+bytes > q.Export.Bytes {
+		return quotaExceeded(op, name)
+	}
+	if inodes > 0 && q.Export.Inodes > 0 && q.usage.Inodes+inodes > q.Export.Inodes {
+		return quotaExceeded(op, name)
+	}
+
+	if owner != "" {
+		l := q.limit(owner)
+		u := q.users[owner]
+		if u == nil {
+			u = new(QuotaUsage)
+			q.users[owner] = u
+		}
+
+		if bytes > 0 && l.Bytes > 0 && u.Bytes+bytes > l.Bytes {
+			return quotaExceeded(op, name)
+		}
+		if inodes > 0 && l.Inodes > 0 && u.Inodes+inodes > l.Inodes {
+			return quotaExceeded(op, name)
+		}
+	}
+
+	q.add(owner, bytes, inodes)
+	return nil
+}
+
+func (q *Quota) add(owner string, bytes, inodes int64) {
+	q.usage.Bytes += bytes
+	q.usage.Inodes += inodes
+
+	if owner != "" {
+		u := q.users[owner]
+		if u == nil {
+			u = new(QuotaUsage)
+			q.users[owner] = u
+		}
+		u.Bytes += bytes
+		u.Inodes += inodes
+	}
+}
+
+func (q *Quota) owner(p string) string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.owners[p]
+}
+
+//所有者未知的已有文件由写入的用户接管，用量转入该用户，返回文件的所有者
+func (f *quotaFs) adopt(p string, size int64) string {
+	f.q.mu.Lock()
+	defer f.q.mu.Unlock()
+
+	owner, ok := f.q.owners[p]
+	if ok || f.principal == "" {
+		return owner
+	}
+
+	f.q.owners[p] = f.principal
+	f.q.save()
+
+	u := f.q.users[f.principal]
+	if u == nil {
+		u = new(QuotaUsage)
+		f.q.users[f.principal] = u
+	}
+	u.Bytes += size
+	u.Inodes++
+	return f.principal
+}
+
+//为已认证的用户生成带配额检查的文件系统
+func (q *Quota) view(principal string, fs FileSystem) FileSystem {
+	return &quotaFs{FileSystem: fs, q: q, principal: principal}
+}
+
+type quotaFs struct {
+	FileSystem
+	q         *Quota
+	principal string
+}
+
+func (f *quotaFs) Watch(name string, recursive bool) (*Watcher, error) {
+	if fs, ok := f.FileSystem.(WatchFs); ok {
+		return fs.Watch(name, recursive)
+	}
+	return nil, errors.New("Watch Not Supported")
+}
+
+func (f *quotaFs) size(name string) (int64, bool) {
+	fi, err := f.FileSystem.Lstat(name)
+	if err != nil {
+		return 0, false
+	}
+	if fi.Mode().IsRegular() {
+		return fi.Size(), true
+	}
+	return 0, true
+}
+
+//新建节点，成功后记录创建者
+func (f *quotaFs) create(op, name string, do func() error) error {
+	p := path.Clean("/" + name)
+
+	f.q.mu.Lock()
+	err := f.q.reserve(op, name, f.principal, 0, 1)
+	f.q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = do()
+
+	f.q.mu.Lock()
+	defer f.q.mu.Unlock()
+
+	if err != nil {
+		f.q.add(f.principal, 0, -1)
+		return err
+	}
+	if f.principal != "" {
+		f.q.owners[p] = f.principal
+		f.q.save()
+	}
+	return nil
+}
+
+//释放节点及其下所有节点的用量
+func (f *quotaFs) release(p string) {
+	owners := make(map[string]QuotaUsage)
+
+	var walk func(p string, fi os.FileInfo)
+	walk = func(p string, fi os.FileInfo) {
+		var size int64
+		if fi.Mode().IsRegular() {
+			size = fi.Size()
+		}
+
+		owner := f.q.owner(p)
+		u := owners[owner]
+		u.Bytes += size
+		u.Inodes++
+		owners[owner] = u
+
+		if !fi.IsDir() {
+			return
+		}
+
+		dir, err := f.FileSystem.Open(p)
+		if err != nil {
+			return
+		}
+		fis, _ := dir.Readdir(-1)
+		dir.Close()
+
+		for _, fi := range fis {
+			walk(path.Join(p, fi.Name()), fi)
+		}
+	}
+
+	if fi, err := f.FileSystem.Lstat(p); err == nil {
+		walk(p, fi)
+	}
+
+	f.q.mu.Lock()
+	defer f.q.mu.Unlock()
+
+	for owner, u := range owners {
+		f.q.add(owner, -u.Bytes, -u.Inodes)
+	}
+
+	for k := range f.q.owners {
+		if k == p || strings.HasPrefix(k, p+"/") {
+			delete(f.q.owners, k)
+		}
+	}
+	f.q.save()
+}
+
+func (f *quotaFs) Mkdir(name string, perm os.FileMode) error {
+	return f.create("mkdir", name, func() error {
+		return f.FileSystem.Mkdir(name, perm)
+	})
+}
+
+func (f *quotaFs) MkdirAll(pathName string, perm os.FileMode) error {
+	var missing []string
+	for dir := path.Clean("/" + pathName); dir != "/"; dir = path.Dir(dir) {
+		if _, err := f.FileSystem.Lstat(dir); err == nil {
+			break
+		}
+		missing = append([]string{dir}, missing...)
+	}
+
+	for _, dir := range missing {
+		err := f.create("mkdir", dir, func() error {
+			return f.FileSystem.Mkdir(dir, perm)
+		})
+		if err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *quotaFs) Remove(name string) error {
+	p := path.Clean("/" + name)
+	size, ok := f.size(p)
+
+	err := f.FileSystem.Remove(name)
+	if err == nil && ok {
+		f.q.mu.Lock()
+		if owner, ok := f.q.owners[p]; ok {
+			delete(f.q.owners, p)
+			f.q.save()
+			f.q.add(owner, -size, -1)
+		} else {
+			f.q.add("", -size, -1)
+		}
+		f.q.mu.Unlock()
+	}
+	return err
+}
+
+func (f *quotaFs) RemoveAll(pathName string) error {
+	p := path.Clean("/" + pathName)
+	if p == "/" {
+		return f.FileSystem.RemoveAll(pathName)
+	}
+
+	f.release(p)
+	return f.FileSystem.RemoveAll(pathName)
+}
+
+func (f *quotaFs) Rename(oldpath, newpath string) error {
+	op := path.Clean("/" + oldpath)
+	np := path.Clean("/" + newpath)
+
+	//被覆盖的目标
+	size, replaced := f.size(np)
+	owner := f.q.owner(np)
+
+	err := f.FileSystem.Rename(oldpath, newpath)
+	if err != nil || op == np {
+		return err
+	}
+
+	f.q.mu.Lock()
+	defer f.q.mu.Unlock()
+
+	if replaced {
+		f.q.add(owner, -size, -1)
+		delete(f.q.owners, np)
+	}
+
+	for k, v := range f.q.owners {
+		if k == op || strings.HasPrefix(k, op+"/") {
+			delete(f.q.owners, k)
+			f.q.owners[np+k[len(op):]] = v
+		}
+	}
+	f.q.save()
+	return nil
+}
+
+func (f *quotaFs) Truncate(name string, size int64) error {
+	p := path.Clean("/" + name)
+	old, ok := f.size(p)
+	owner := ""
+	if ok {
+		owner = f.adopt(p, old)
+	}
+
+	return f.q.resize("truncate", name, owner, old, size, func() (int64, error) {
+		if err := f.FileSystem.Truncate(name, size); err != nil {
+			return old, err
+		}
+		size, _ := f.size(p)
+		return size, nil
+	})
+}
+
+func (f *quotaFs) Create(name string) (file File, err error) {
+	return f.open(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, func() (File, error) {
+		return f.FileSystem.Create(name)
+	})
+}
+
+func (f *quotaFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if !isWriteFlag(flag) {
+		return f.FileSystem.OpenFile(name, flag, perm)
+	}
+	return f.open(name, flag, func() (File, error) {
+		return f.FileSystem.OpenFile(name, flag, perm)
+	})
+}
+
+func (f *quotaFs) open(name string, flag int, open func() (File, error)) (file File, err error) {
+	p := path.Clean("/" + name)
+	size, exists := f.size(p)
+
+	if !exists && flag&os.O_CREATE != 0 {
+		err = f.create("open", name, func() error {
+			file, err = open()
+			return err
+		})
+	} else {
+		file, err = open()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	owner := f.q.owner(p)
+	if exists {
+		owner = f.adopt(p, size)
+	}
+
+	if exists && flag&os.O_TRUNC != 0 && size > 0 {
+		f.q.mu.Lock()
+		f.q.add(owner, -size, 0)
+		f.q.mu.Unlock()
+	}
+
+	return &quotaFile{File: file, q: f.q, name: name, owner: owner, append: flag&os.O_APPEND != 0}, nil
+}
+
+//修改文件大小，先按目标大小预占，完成后按实际大小修正
+func (q *Quota) resize(op, name, owner string, old, size int64, do func() (int64, error)) error {
+	grow := size - old
+
+	q.mu.Lock()
+	var err error
+	if grow > 0 {
+		err = q.reserve(op, name, owner, grow, 0)
+	}
+	q.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	now, err := do()
+
+	q.mu.Lock()
+	if grow > 0 {
+		q.add(owner, now-old-grow, 0)
+	} else {
+		q.add(owner, now-old, 0)
+	}
+	q.mu.Unlock()
+	return err
+}
+
+type quotaFile struct {
+	File
+	q      *Quota
+	name   string
+	owner  string
+	append bool
+}
+
+func (f *quotaFile) size() int64 {
+	fi, err := f.File.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+func (f *quotaFile) Truncate(size int64) error {
+	old := f.size()
+	return f.q.resize("truncate", f.name, f.owner, old, size, func() (int64, error) {
+		if err := f.File.Truncate(size); err != nil {
+			return old, err
+		}
+		return f.size(), nil
+	})
+}
+
+func (f *quotaFile) Write(b []byte) (n int, err error) {
+	old := f.size()
+
+	//追加模式下总是写到文件末尾
+	pos := old
+	if !f.append {
+		if off, err := f.File.Seek(0, io.SeekCurrent); err == nil {
+			pos = off
+		}
+	}
+
+	end := pos + int64(len(b))
+	if end < old {
+		end = old
+	}
+
+	err = f.q.resize("write", f.name, f.owner, old, end, func() (int64, error) {
+		n, err = f.File.Write(b)
+		return f.size(), err
+	})
+	return
+}
+
+func (f *quotaFile) WriteAt(b []byte, off int64) (n int, err error) {
+	old := f.size()
+
+	end := off + int64(len(b))
+	if end < old {
+		end = old
+	}
+
+	err = f.q.resize("write", f.name, f.owner, old, end, func() (int64, error) {
+		n, err = f.File.WriteAt(b, off)
+		return f.size(), err
+	})
+	return
+}
+
+func (f *quotaFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *quotaFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *quotaFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *quotaFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
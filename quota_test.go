@@ -0,0 +1,161 @@
+package netfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func test_is_dquot(err error) bool {
+	e, ok := err.(*os.PathError)
+	return ok && e.Err == syscall.EDQUOT
+}
+
+func Test_Quota(t *testing.T) {
+	mem := test_mem_fs(t, "old.txt")
+	quota := &Quota{
+		Export:    QuotaLimit{Bytes: 20},
+		Principal: QuotaLimit{Inodes: 2},
+	}
+
+	exports := new(Exports).Init()
+	exports.Auth = func(principal, secret string) bool {
+		return true
+	}
+	exports.Add(&Share{Fs: mem, Quota: quota})
+
+	if u := quota.Usage(); u.Bytes != 7 || u.Inodes != 1 {
+		t.Errorf("Usage expect:{7 1}, get:%v", u)
+	}
+
+	go exports.Listen("127.0.0.1:11124")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11124")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Auth("bob", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := c.Create("a.txt")
+	if err != nil {
+		t.Fatalf("Create expect:nil, get:%v", err)
+	}
+
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Errorf("Write expect:nil, get:%v", err)
+	}
+	if _, err := f.Write([]byte("0123456789")); !test_is_dquot(err) {
+		t.Errorf("Write expect:EDQUOT, get:%v", err)
+	}
+	if err := f.Truncate(100); !test_is_dquot(err) {
+		t.Errorf("Truncate expect:EDQUOT, get:%v", err)
+	}
+	//覆盖已有内容不增加用量
+	if _, err := f.WriteAt([]byte("abc"), 0); err != nil {
+		t.Errorf("WriteAt expect:nil, get:%v", err)
+	}
+	f.Close()
+
+	if u := quota.PrincipalUsage("bob"); u.Bytes != 10 || u.Inodes != 1 {
+		t.Errorf("PrincipalUsage expect:{10 1}, get:%v", u)
+	}
+
+	if err := c.Mkdir("dir", 0755); err != nil {
+		t.Errorf("Mkdir expect:nil, get:%v", err)
+	}
+	if err := c.Mkdir("dir2", 0755); !test_is_dquot(err) {
+		t.Errorf("Mkdir expect:EDQUOT, get:%v", err)
+	}
+
+	if err := c.Rename("a.txt", "dir/a.txt"); err != nil {
+		t.Errorf("Rename expect:nil, get:%v", err)
+	}
+	if err := c.RemoveAll("dir"); err != nil {
+		t.Errorf("RemoveAll expect:nil, get:%v", err)
+	}
+
+	if u := quota.PrincipalUsage("bob"); u.Bytes != 0 || u.Inodes != 0 {
+		t.Errorf("PrincipalUsage expect:{0 0}, get:%v", u)
+	}
+	if u := quota.Usage(); u.Bytes != 7 || u.Inodes != 1 {
+		t.Errorf("Usage expect:{7 1}, get:%v", u)
+	}
+
+	//绕过服务端修改后重新扫描
+	if f, err := mem.Create("b.txt"); err == nil {
+		f.WriteString("12345")
+		f.Close()
+	}
+	if err := quota.Scan(); err != nil {
+		t.Errorf("Scan expect:nil, get:%v", err)
+	}
+	if u := quota.Usage(); u.Bytes != 12 || u.Inodes != 2 {
+		t.Errorf("Usage expect:{12 2}, get:%v", u)
+	}
+}
+
+func Test_Quota_Index(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netfs_quota")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	index := filepath.Join(dir, "owners.json")
+
+	mem := test_mem_fs(t, "old.txt")
+	quota := &Quota{Index: index}
+
+	exports := new(Exports).Init()
+	exports.Auth = func(principal, secret string) bool {
+		return true
+	}
+	exports.Add(&Share{Fs: mem, Quota: quota})
+
+	go exports.Listen("127.0.0.1:11144")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11144")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Auth("bob", "")
+	c.Mkdir("dir", 0755)
+	test_write_file(t, c, "dir/a.txt", "hello")
+
+	//所有者未知的文件由写入的用户接管
+	c.Auth("alice", "")
+	f, err := c.OpenFile("old.txt", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("!")
+	f.Close()
+
+	if u := quota.PrincipalUsage("alice"); u.Bytes != 8 || u.Inodes != 1 {
+		t.Errorf("PrincipalUsage expect:{8 1}, get:%v", u)
+	}
+
+	//重启后按索引重新计算
+	c.Rename("dir", "dir2")
+	restart := &Quota{Index: index}
+	new(Exports).Init().Add(&Share{Fs: mem, Quota: restart})
+
+	for principal, want := range map[string]QuotaUsage{"bob": {5, 2}, "alice": {8, 1}} {
+		if u := restart.PrincipalUsage(principal); u != want {
+			t.Errorf("PrincipalUsage %s expect:%v, get:%v", principal, want, u)
+		}
+	}
+	if u := restart.Usage(); u.Bytes != 13 || u.Inodes != 3 {
+		t.Errorf("Usage expect:{13 3}, get:%v", u)
+	}
+}
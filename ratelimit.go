@@ -0,0 +1,226 @@
+package netfs
+
+import (
+	"sync"
+	"time"
+)
+
+//令牌桶，允许透支：取走令牌后不足的部分通过等待补齐，
+//因此单次超过容量的请求也不会永远等待
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+//rate 为每秒补充的令牌数，burst 为桶的容量
+func (b *TokenBucket) Init(rate, burst float64) *TokenBucket {
+	b.rate = rate
+	b.burst = burst
+	b.tokens = burst
+	b.last = time.Now()
+	return b
+}
+
+//取走 n 个令牌，返回需要等待的时间
+func (b *TokenBucket) Reserve(n float64) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+//经过 now 之后令牌是否已补满
+func (b *TokenBucket) full(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+//取走 n 个令牌，不足时等待
+func (b *TokenBucket) Wait(n float64) {
+	if d := b.Reserve(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+//每秒的请求数与字节数，为 0 时不限制，容量为一秒的量
+type RateLimit struct {
+	Requests float64
+	Bytes    float64
+}
+
+//服务端限速，Global 由所有会话共用，Session 为每个会话单独计算，
+//Principal 为每个已认证用户的默认限制(该用户的所有会话共用)，Principals 可单独指定。
+//超出限制的请求被延迟处理而不会断开连接，大的读写按块计量。
+type RateLimits struct {
+	Global     RateLimit
+	Session    RateLimit
+	Principal  RateLimit
+	Principals map[string]RateLimit
+
+	//单个请求最长的延迟，超出的部分由之后的请求补足，避免触发客户端的 ActionTimeout
+	//为 0 时为 ActionTimeout 的一半
+	MaxDelay time.Duration
+
+	once       sync.Once
+	mu         sync.Mutex
+	global     rateBuckets
+	principals map[string]*principalBuckets
+	swept      time.Time
+}
+
+//按块计量的大小
+const rateChunk = 64 * 1024
+
+//用户的令牌桶闲置超过该时间且已补满时释放
+var rateIdle = 10 * time.Minute
+
+type principalBuckets struct {
+	rateBuckets
+	last time.Time
+}
+
+type rateBuckets struct {
+	requests *TokenBucket
+	bytes    *TokenBucket
+}
+
+func newRateBuckets(l RateLimit) rateBuckets {
+	var b rateBuckets
+	if l.Requests > 0 {
+		b.requests = new(TokenBucket).Init(l.Requests, l.Requests)
+	}
+	if l.Bytes > 0 {
+		b.bytes = new(TokenBucket).Init(l.Bytes, l.Bytes)
+	}
+	return b
+}
+
+func (b rateBuckets) reserve(requests, bytes int) time.Duration {
+	var d time.Duration
+	if requests > 0 && b.requests != nil {
+		d = b.requests.Reserve(float64(requests))
+	}
+	if bytes > 0 && b.bytes != nil {
+		if w := b.bytes.Reserve(float64(bytes)); w > d {
+			d = w
+		}
+	}
+	return d
+}
+
+//令牌已补满，释放后重新创建不会改变限速
+func (b rateBuckets) full(now time.Time) bool {
+	return (b.requests == nil || b.requests.full(now)) && (b.bytes == nil || b.bytes.full(now))
+}
+
+func (r *RateLimits) init() {
+	r.once.Do(func() {
+		r.global = newRateBuckets(r.Global)
+		r.principals = make(map[string]*principalBuckets)
+		r.swept = time.Now()
+	})
+}
+
+func (r *RateLimits) maxDelay() time.Duration {
+	if r.MaxDelay > 0 {
+		return r.MaxDelay
+	}
+	return ActionTimeout / 2
+}
+
+func (r *RateLimits) principal(name string) rateBuckets {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.swept) > rateIdle {
+		r.sweep(now)
+	}
+
+	b, ok := r.principals[name]
+	if !ok {
+		l, ok := r.Principals[name]
+		if !ok {
+			l = r.Principal
+		}
+		b = &principalBuckets{rateBuckets: newRateBuckets(l)}
+		r.principals[name] = b
+	}
+	b.last = now
+	return b.rateBuckets
+}
+
+//释放闲置的用户令牌桶，调用时需持有 r.mu
+func (r *RateLimits) sweep(now time.Time) {
+	r.swept = now
+	for name, b := range r.principals {
+		if now.Sub(b.last) > rateIdle && b.full(now) {
+			delete(r.principals, name)
+		}
+	}
+}
+
+// ----- 会话 -----
+
+//取得各级令牌，按等待最久的一级延迟
+//数据按块计量，累计延迟达到 MaxDelay 后剩余部分只记账不再等待
+func (c *Server) throttle(requests, bytes int) {
+	r := c.limits
+	if r == nil {
+		return
+	}
+
+	limit := r.maxDelay()
+	var slept time.Duration
+	wait := func(d time.Duration) {
+		if d > limit-slept {
+			d = limit - slept
+		}
+		if d > 0 {
+			time.Sleep(d)
+			slept += d
+		}
+	}
+
+	if requests > 0 {
+		wait(c.reserve(requests, 0))
+	}
+	for bytes > 0 {
+		n := bytes
+		if n > rateChunk && slept < limit {
+			n = rateChunk
+		}
+		bytes -= n
+		wait(c.reserve(0, n))
+	}
+}
+
+func (c *Server) reserve(requests, bytes int) time.Duration {
+	r := c.limits
+	d := r.global.reserve(requests, bytes)
+
+	if w := c.buckets.reserve(requests, bytes); w > d {
+		d = w
+	}
+	if c.principal != "" {
+		if w := r.principal(c.principal).reserve(requests, bytes); w > d {
+			d = w
+		}
+	}
+	return d
+}
@@ -0,0 +1,125 @@
+package netfs
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TokenBucket(t *testing.T) {
+	b := new(TokenBucket).Init(10, 5)
+
+	if d := b.Reserve(5); d != 0 {
+		t.Errorf("Reserve expect:0, get:%v", d)
+	}
+	//透支 5 个，10 个每秒需等待 0.5 秒
+	if d := b.Reserve(5); d < 450*time.Millisecond || d > 500*time.Millisecond {
+		t.Errorf("Reserve expect:500ms, get:%v", d)
+	}
+}
+
+func Test_RateLimits(t *testing.T) {
+	exports := new(Exports).Init()
+	exports.RateLimits = &RateLimits{
+		Session: RateLimit{Requests: 50},
+		Global:  RateLimit{Bytes: 20000},
+	}
+	exports.Add(&Share{Fs: new(MemFs).Init()})
+
+	go exports.Listen("127.0.0.1:11129")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11129")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	start := time.Now()
+	for i := 0; i < 75; i++ {
+		c.Stat("a.txt")
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("Requests expect:>=500ms, get:%v", d)
+	}
+
+	f, err := c.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	start = time.Now()
+	if _, err := f.Write(make([]byte, 30000)); err != nil {
+		t.Errorf("Write expect:nil, get:%v", err)
+	}
+	if d := time.Since(start); d < 400*time.Millisecond {
+		t.Errorf("Bytes expect:>=500ms, get:%v", d)
+	}
+}
+
+func Test_RateLimits_MaxDelay(t *testing.T) {
+	exports := new(Exports).Init()
+	exports.RateLimits = &RateLimits{
+		Session:  RateLimit{Bytes: 10000},
+		MaxDelay: 200 * time.Millisecond,
+	}
+	exports.Add(&Share{Fs: new(MemFs).Init()})
+
+	go exports.Listen("127.0.0.1:11145")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11145")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	f, err := c.Create("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	//10 秒的量只等待 MaxDelay
+	start := time.Now()
+	if _, err := f.Write(make([]byte, 100000)); err != nil {
+		t.Errorf("Write expect:nil, get:%v", err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond || d > time.Second {
+		t.Errorf("Write expect:200ms, get:%v", d)
+	}
+
+	//未补足的部分由之后的请求等待
+	start = time.Now()
+	if _, err := f.Write([]byte("a")); err != nil {
+		t.Errorf("Write expect:nil, get:%v", err)
+	}
+	if d := time.Since(start); d < 150*time.Millisecond {
+		t.Errorf("Write expect:200ms, get:%v", d)
+	}
+}
+
+func Test_RateLimits_Sweep(t *testing.T) {
+	old := rateIdle
+	rateIdle = 10 * time.Millisecond
+	defer func() { rateIdle = old }()
+
+	r := &RateLimits{Principal: RateLimit{Bytes: 1000}}
+	r.init()
+
+	r.principal("a")
+	r.principal("b").reserve(0, 5000)
+	time.Sleep(20 * time.Millisecond)
+	r.principal("c")
+
+	//a 已补满被释放，b 仍欠令牌需保留
+	if _, ok := r.principals["a"]; ok {
+		t.Errorf("Sweep a expect:false, get:true")
+	}
+	if _, ok := r.principals["b"]; !ok {
+		t.Errorf("Sweep b expect:true, get:false")
+	}
+	if n := len(r.principals); n != 2 {
+		t.Errorf("Principals expect:2, get:%d", n)
+	}
+}
@@ -0,0 +1,133 @@
+package netfs
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+//只读包装，拒绝所有修改操作
+func ReadOnly(fs FileSystem) FileSystem {
+	return &readOnlyFs{fs: fs}
+}
+
+type readOnlyFs struct {
+	fs FileSystem
+}
+
+func erofs(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: syscall.EROFS}
+}
+
+//带写标志的打开方式
+func isWriteFlag(flag int) bool {
+	return flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0
+}
+
+func (r *readOnlyFs) Watch(name string, recursive bool) (*Watcher, error) {
+	if fs, ok := r.fs.(WatchFs); ok {
+		return fs.Watch(name, recursive)
+	}
+	return nil, errors.New("Watch Not Supported")
+}
+
+func (r *readOnlyFs) Chmod(name string, mode os.FileMode) error {
+	return erofs("chmod", name)
+}
+
+func (r *readOnlyFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return erofs("chtimes", name)
+}
+
+func (r *readOnlyFs) Mkdir(name string, perm os.FileMode) error {
+	return erofs("mkdir", name)
+}
+
+func (r *readOnlyFs) MkdirAll(path string, perm os.FileMode) error {
+	return erofs("mkdir", path)
+}
+
+func (r *readOnlyFs) Remove(name string) error {
+	return erofs("remove", name)
+}
+
+func (r *readOnlyFs) RemoveAll(path string) error {
+	return erofs("removeall", path)
+}
+
+func (r *readOnlyFs) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EROFS}
+}
+
+func (r *readOnlyFs) Truncate(name string, size int64) error {
+	return erofs("truncate", name)
+}
+
+func (r *readOnlyFs) Create(name string) (file File, err error) {
+	return nil, erofs("open", name)
+}
+
+func (r *readOnlyFs) Open(name string) (file File, err error) {
+	f, err := r.fs.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{f}, nil
+}
+
+func (r *readOnlyFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if isWriteFlag(flag) {
+		return nil, erofs("open", name)
+	}
+
+	f, err := r.fs.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyFile{f}, nil
+}
+
+func (r *readOnlyFs) Stat(name string) (fi os.FileInfo, err error) {
+	return r.fs.Stat(name)
+}
+
+func (r *readOnlyFs) Lstat(name string) (fi os.FileInfo, err error) {
+	return r.fs.Lstat(name)
+}
+
+type readOnlyFile struct {
+	File
+}
+
+func (f *readOnlyFile) Chmod(mode os.FileMode) error {
+	return erofs("chmod", f.Name())
+}
+
+func (f *readOnlyFile) Truncate(size int64) error {
+	return erofs("truncate", f.Name())
+}
+
+func (f *readOnlyFile) Write(b []byte) (n int, err error) {
+	return 0, erofs("write", f.Name())
+}
+
+func (f *readOnlyFile) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, erofs("write", f.Name())
+}
+
+func (f *readOnlyFile) WriteString(s string) (ret int, err error) {
+	return 0, erofs("write", f.Name())
+}
+
+func (f *readOnlyFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *readOnlyFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *readOnlyFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
@@ -0,0 +1,456 @@
+package netfs
+
+import (
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//只读的多副本客户端，读操作轮流分散到各服务端
+//
+//连接出错的服务端标记为不可用，操作换下一个副本重试，已打开的文件在其它副本上重新打开并 Seek 到原位置。
+//每隔 Interval 用 LINK_PING 检查可用的服务端，并重新连接不可用的服务端。所有修改操作返回 EROFS。
+type ReplicaClient struct {
+	Addrs    []string
+	Dial     func(addr string) (*Client, error) //默认为 Dial，需要 TLS 或认证时在 Init 前设置
+	Interval time.Duration
+
+	mu     sync.Mutex
+	conns  []*replicaConn //nil 表示不可用
+	next   int
+	closed bool
+	done   chan struct{}
+}
+
+//到一个服务端的连接，Client 不能并发使用，操作与 Ping 依次进行
+type replicaConn struct {
+	mu     sync.Mutex
+	client *Client
+	fs     FileSystem
+}
+
+func newReplicaConn(client *Client) *replicaConn {
+	c := &replicaConn{client: client}
+	c.fs = Intercept(client, new(Session), func(call *Call, next Handler) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		next(call)
+	})
+	return c
+}
+
+//连接所有服务端，全部不可用时返回 ErrNoReplica
+func (r *ReplicaClient) Init(addrs ...string) (*ReplicaClient, error) {
+	r.Addrs = addrs
+	if r.Dial == nil {
+		r.Dial = Dial
+	}
+	if r.Interval == 0 {
+		r.Interval = 5 * time.Second
+	}
+	r.conns = make([]*replicaConn, len(addrs))
+	r.done = make(chan struct{})
+
+	r.Check()
+	if len(r.Healthy()) == 0 {
+		return nil, ErrNoReplica
+	}
+
+	go r.monitor()
+	return r, nil
+}
+
+func (r *ReplicaClient) monitor() {
+	t := time.NewTicker(r.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-t.C:
+			r.Check()
+		}
+	}
+}
+
+//检查一次所有服务端：可用的发送 LINK_PING，不可用的重新连接
+func (r *ReplicaClient) Check() {
+	all := make([]int, len(r.Addrs))
+	for i := range all {
+		all[i] = i
+	}
+
+	mirrorFanout(all, func(k, i int) error {
+		r.mu.Lock()
+		c := r.conns[i]
+		r.mu.Unlock()
+
+		if c != nil {
+			c.mu.Lock()
+			err := c.client.Ping()
+			c.mu.Unlock()
+			if err != nil {
+				r.down(c)
+			}
+			return err
+		}
+
+		client, err := r.Dial(r.Addrs[i])
+		if err != nil {
+			return err
+		}
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.closed || r.conns[i] != nil {
+			client.Close()
+			return nil
+		}
+		r.conns[i] = newReplicaConn(client)
+		return nil
+	})
+}
+
+//当前可用的服务端地址
+func (r *ReplicaClient) Healthy() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var addrs []string
+	for i, c := range r.conns {
+		if c != nil {
+			addrs = append(addrs, r.Addrs[i])
+		}
+	}
+	return addrs
+}
+
+//标记连接不可用并断开，正在使用它的操作会出错并切换副本
+func (r *ReplicaClient) down(c *replicaConn) {
+	r.mu.Lock()
+	for i := range r.conns {
+		if r.conns[i] == c {
+			r.conns[i] = nil
+		}
+	}
+	r.mu.Unlock()
+
+	c.client.conn.conn.Close()
+}
+
+//轮流选择一个可用且未尝试过的连接
+func (r *ReplicaClient) pick(tried map[*replicaConn]bool) *replicaConn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for k := 0; k < len(r.conns); k++ {
+		i := (r.next + k) % len(r.conns)
+		if c := r.conns[i]; c != nil && !tried[c] {
+			r.next = i + 1
+			return c
+		}
+	}
+	return nil
+}
+
+//在一个副本上执行，连接出错时换下一个副本
+func (r *ReplicaClient) do(fn func(c *replicaConn) error) error {
+	tried := make(map[*replicaConn]bool)
+	err := ErrNoReplica
+	for c := r.pick(tried); c != nil; c = r.pick(tried) {
+		tried[c] = true
+		if err = fn(c); err == nil || !mirrorRetry(err) {
+			return err
+		}
+		r.down(c)
+	}
+	return err
+}
+
+//停止健康检查并断开所有连接
+func (r *ReplicaClient) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	conns := r.conns
+	r.conns = make([]*replicaConn, len(conns))
+	r.mu.Unlock()
+
+	for _, c := range conns {
+		if c != nil {
+			c.mu.Lock()
+			c.client.Close()
+			c.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+func (r *ReplicaClient) Chmod(name string, mode os.FileMode) error {
+	return erofs("chmod", name)
+}
+
+func (r *ReplicaClient) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return erofs("chtimes", name)
+}
+
+func (r *ReplicaClient) Mkdir(name string, perm os.FileMode) error {
+	return erofs("mkdir", name)
+}
+
+func (r *ReplicaClient) MkdirAll(pathName string, perm os.FileMode) error {
+	return erofs("mkdir", pathName)
+}
+
+func (r *ReplicaClient) Remove(name string) error {
+	return erofs("remove", name)
+}
+
+func (r *ReplicaClient) RemoveAll(pathName string) error {
+	return erofs("removeall", pathName)
+}
+
+func (r *ReplicaClient) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EROFS}
+}
+
+func (r *ReplicaClient) Truncate(name string, size int64) error {
+	return erofs("truncate", name)
+}
+
+func (r *ReplicaClient) Create(name string) (file File, err error) {
+	return nil, erofs("open", name)
+}
+
+func (r *ReplicaClient) Open(name string) (file File, err error) {
+	return r.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (r *ReplicaClient) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if isWriteFlag(flag) {
+		return nil, erofs("open", name)
+	}
+
+	f := &replicaFile{r: r, name: name, seen: make(map[string]bool)}
+	err = r.do(func(c *replicaConn) (err error) {
+		f.c = c
+		f.f, err = c.fs.Open(name)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (r *ReplicaClient) Stat(name string) (fi os.FileInfo, err error) {
+	err = r.do(func(c *replicaConn) (err error) {
+		fi, err = c.fs.Stat(name)
+		return
+	})
+	return
+}
+
+func (r *ReplicaClient) Lstat(name string) (fi os.FileInfo, err error) {
+	err = r.do(func(c *replicaConn) (err error) {
+		fi, err = c.fs.Lstat(name)
+		return
+	})
+	return
+}
+
+//可切换副本的只读文件
+type replicaFile struct {
+	mu     sync.Mutex
+	r      *ReplicaClient
+	name   string
+	c      *replicaConn
+	f      File
+	off    int64
+	seen   map[string]bool //已返回的目录项，切换副本后跳过
+	closed bool
+}
+
+//在当前副本上执行，连接出错时在其它副本上重新打开并 Seek 到原位置
+func (f *replicaFile) do(op string, fn func(file File) error) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+
+	tried := map[*replicaConn]bool{f.c: true}
+	err := fn(f.f)
+	for mirrorRetry(err) {
+		f.r.down(f.c)
+		f.f.Close()
+
+		c := f.r.pick(tried)
+		if c == nil {
+			return err
+		}
+		tried[c] = true
+
+		nf, e := c.fs.Open(f.name)
+		if e == nil && f.off > 0 {
+			if _, e = nf.Seek(f.off, io.SeekStart); e != nil {
+				nf.Close()
+			}
+		}
+		if e != nil {
+			if !mirrorRetry(e) {
+				return e
+			}
+			f.r.down(c)
+			continue
+		}
+
+		f.c, f.f = c, nf
+		err = fn(nf)
+	}
+	return err
+}
+
+func (f *replicaFile) Chmod(mode os.FileMode) error {
+	return erofs("chmod", f.name)
+}
+
+func (f *replicaFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return f.f.Close()
+}
+
+func (f *replicaFile) Name() string {
+	return f.name
+}
+
+func (f *replicaFile) Read(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.do("read", func(file File) (err error) {
+		n, err = file.Read(b)
+		return
+	})
+	f.off += int64(n)
+	return
+}
+
+func (f *replicaFile) ReadAt(b []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.do("read", func(file File) (err error) {
+		n, err = file.ReadAt(b, off)
+		return
+	})
+	return
+}
+
+func (f *replicaFile) Readdir(n int) (fi []os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.readdir(n, false)
+}
+
+func (f *replicaFile) Readdirnames(n int) (names []string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := f.readdir(n, true)
+	for _, x := range fi {
+		names = append(names, x.Name())
+	}
+	return
+}
+
+//读取目录项并去掉已返回过的，onlyNames 时只取名称
+func (f *replicaFile) readdir(n int, onlyNames bool) (fi []os.FileInfo, err error) {
+	for {
+		var list []os.FileInfo
+		err = f.do("readdirent", func(file File) (err error) {
+			if !onlyNames {
+				list, err = file.Readdir(n)
+				return
+			}
+			var names []string
+			names, err = file.Readdirnames(n)
+			for _, name := range names {
+				list = append(list, &FileInfo{name: name})
+			}
+			return
+		})
+
+		for _, x := range list {
+			if !f.seen[x.Name()] {
+				f.seen[x.Name()] = true
+				fi = append(fi, x)
+			}
+		}
+
+		//切换副本后读到的可能全是已返回过的
+		if len(fi) > 0 || err != nil || n <= 0 {
+			return
+		}
+	}
+}
+
+func (f *replicaFile) Seek(offset int64, whence int) (ret int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.do("seek", func(file File) (err error) {
+		ret, err = file.Seek(offset, whence)
+		return
+	})
+	if err == nil {
+		f.off = ret
+		if ret == 0 {
+			f.seen = make(map[string]bool)
+		}
+	}
+	return
+}
+
+func (f *replicaFile) Stat() (fi os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	err = f.do("stat", func(file File) (err error) {
+		fi, err = file.Stat()
+		return
+	})
+	return
+}
+
+func (f *replicaFile) Sync() (err error) {
+	return nil
+}
+
+func (f *replicaFile) Truncate(size int64) error {
+	return erofs("truncate", f.name)
+}
+
+func (f *replicaFile) Write(b []byte) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *replicaFile) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EBADF}
+}
+
+func (f *replicaFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
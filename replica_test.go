@@ -0,0 +1,120 @@
+package netfs
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func test_replica_server(t *testing.T, addr string, stats *int32) *Exports {
+	fs := test_mem_fs(t, "a.txt", "d/", "d/x", "d/y", "d/z")
+	var body []string
+	for i := 0; i < 200; i++ {
+		body = append(body, fmt.Sprint(i))
+	}
+	test_write_file(t, fs, "big.txt", strings.Join(body, ","))
+
+	exports := new(Exports).Init()
+	exports.Add(&Share{Fs: Intercept(fs, new(Session), func(call *Call, next Handler) {
+		if call.Op == FS_STAT {
+			atomic.AddInt32(stats, 1)
+		}
+		next(call)
+	})})
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go exports.ServeListener(ln)
+	return exports
+}
+
+func Test_ReplicaClient(t *testing.T) {
+	var s1, s2 int32
+	e1 := test_replica_server(t, "127.0.0.1:11134", &s1)
+	e2 := test_replica_server(t, "127.0.0.1:11135", &s2)
+	defer e2.Shutdown(time.Second)
+
+	rc, err := new(ReplicaClient).Init("127.0.0.1:11134", "127.0.0.1:11135")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+
+	//读操作轮流分散
+	for i := 0; i < 4; i++ {
+		if _, err := rc.Stat("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if atomic.LoadInt32(&s1) != 2 || atomic.LoadInt32(&s2) != 2 {
+		t.Errorf("Stat expect:2 2, get:%d %d", s1, s2)
+	}
+
+	//文件与目录都在第一个服务端上打开
+	f, err := rc.Open("big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rc.Stat("a.txt")
+	d, err := rc.Open("d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if f.(*replicaFile).c != d.(*replicaFile).c {
+		t.Fatal("Open expect:same replica")
+	}
+
+	b := make([]byte, 10)
+	if n, err := f.Read(b); n != 10 || err != nil || string(b) != "0,1,2,3,4," {
+		t.Errorf("Read expect:0,1,2,3,4, get:%d %v %s", n, err, b)
+	}
+	first, err := d.Readdirnames(1)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Readdirnames expect:1, get:%v %v", first, err)
+	}
+
+	//第一个服务端停止后打开的文件切换到另一个副本
+	e1.Shutdown(time.Second)
+	if n, err := f.Read(b); n != 10 || err != nil || string(b) != "5,6,7,8,9," {
+		t.Errorf("Read expect:5,6,7,8,9, get:%d %v %s", n, err, b)
+	}
+	rest, err := d.Readdirnames(-1)
+	names := append(first, rest...)
+	sort.Strings(names)
+	if s := strings.Join(names, ","); err != nil || s != "x,y,z" {
+		t.Errorf("Readdirnames expect:x,y,z, get:%s %v", s, err)
+	}
+	if n, err := f.ReadAt(b[:3], 20); n != 3 || err != nil || string(b[:3]) != "10," {
+		t.Errorf("ReadAt expect:10, get:%d %v %s", n, err, b[:3])
+	}
+	if s := fmt.Sprint(rc.Healthy()); s != "[127.0.0.1:11135]" {
+		t.Errorf("Healthy expect:[127.0.0.1:11135], get:%s", s)
+	}
+	if s := test_read_file(rc, "a.txt"); s != "a.txt" {
+		t.Errorf("Read expect:a.txt, get:%s", s)
+	}
+
+	//只读
+	if _, err := rc.Create("new.txt"); !test_is_erofs(err) {
+		t.Errorf("Create expect:EROFS, get:%v", err)
+	}
+	if err := rc.Remove("a.txt"); !test_is_erofs(err) {
+		t.Errorf("Remove expect:EROFS, get:%v", err)
+	}
+
+	//服务端恢复后重新连接
+	e1 = test_replica_server(t, "127.0.0.1:11134", &s1)
+	defer e1.Shutdown(time.Second)
+	rc.Check()
+	if n := len(rc.Healthy()); n != 2 {
+		t.Errorf("Healthy expect:2, get:%d", n)
+	}
+}
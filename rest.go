@@ -0,0 +1,297 @@
+package netfs
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//以 JSON/REST 方式提供文件系统
+//
+//	GET    /path         读取文件(支持 Range)，目录返回 JSON 列表
+//	GET    /path?stat    文件信息
+//	PUT    /path         写入整个文件，路径以 / 结尾时创建目录
+//	POST   /path         追加到文件末尾
+//	DELETE /path         删除，?recursive 时删除整个目录
+//
+//响应带 ETag 与 Last-Modified，修改操作检查 If-Match、If-None-Match 与 If-Unmodified-Since
+type RestHandler struct {
+	FS FileSystem
+}
+
+//HTTP 请求是并发的，Client 需依次使用
+func (h *RestHandler) Init(fs FileSystem) *RestHandler {
+	if c, ok := fs.(*Client); ok {
+		fs = Serialize(c)
+	}
+	h.FS = fs
+	return h
+}
+
+//JSON 格式的文件信息
+type RestFileInfo struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	Perm    uint32    `json:"perm"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+func restInfo(fi os.FileInfo) *RestFileInfo {
+	return &RestFileInfo{
+		Name:    fi.Name(),
+		Size:    fi.Size(),
+		Mode:    fi.Mode().String(),
+		Perm:    uint32(fi.Mode().Perm()),
+		ModTime: fi.ModTime(),
+		IsDir:   fi.IsDir(),
+	}
+}
+
+func restETag(fi os.FileInfo) string {
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size())
+}
+
+func (h *RestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+
+	switch r.Method {
+	case "GET", "HEAD":
+		h.get(w, r, name)
+	case "PUT":
+		if name != "/" && strings.HasSuffix(r.URL.Path, "/") {
+			h.mkdir(w, r, name)
+		} else {
+			h.put(w, r, name, os.O_TRUNC)
+		}
+	case "POST":
+		h.put(w, r, name, os.O_APPEND)
+	case "DELETE":
+		h.delete(w, r, name)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST, DELETE")
+		h.error(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (h *RestHandler) get(w http.ResponseWriter, r *http.Request, name string) {
+	fi, err := h.FS.Stat(name)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	etag := restETag(fi)
+	w.Header().Set("ETag", etag)
+
+	_, stat := r.URL.Query()["stat"]
+	if stat || fi.IsDir() {
+		w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+		if restMatch(r.Header.Get("If-None-Match"), etag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if stat {
+			h.json(w, http.StatusOK, restInfo(fi))
+		} else {
+			h.list(w, r, name)
+		}
+		return
+	}
+
+	f, err := h.FS.Open(name)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	defer f.Close()
+
+	//Range 与其余条件请求由 ServeContent 处理，内容经 ReadAt 读取
+	http.ServeContent(w, r, name, fi.ModTime(), io.NewSectionReader(f, 0, fi.Size()))
+}
+
+func (h *RestHandler) list(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := h.FS.Open(name)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	fis, err := f.Readdir(-1)
+	f.Close()
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+
+	list := make([]*RestFileInfo, 0, len(fis))
+	for _, fi := range fis {
+		list = append(list, restInfo(fi))
+	}
+	h.json(w, http.StatusOK, list)
+}
+
+//flag 为 os.O_TRUNC 时覆盖，os.O_APPEND 时追加
+func (h *RestHandler) put(w http.ResponseWriter, r *http.Request, name string, flag int) {
+	fi, err := h.FS.Stat(name)
+	if err != nil && !os.IsNotExist(err) {
+		h.fail(w, err)
+		return
+	}
+	if fi != nil && fi.IsDir() {
+		h.fail(w, &os.PathError{Op: "open", Path: name, Err: os.ErrInvalid})
+		return
+	}
+	if !h.precondition(w, r, fi) {
+		return
+	}
+
+	f, err := h.FS.OpenFile(name, os.O_WRONLY|os.O_CREATE|flag, 0644)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	_, err = io.Copy(f, r.Body)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+
+	h.modified(w, name, fi == nil)
+}
+
+func (h *RestHandler) mkdir(w http.ResponseWriter, r *http.Request, name string) {
+	fi, err := h.FS.Stat(name)
+	if err != nil && !os.IsNotExist(err) {
+		h.fail(w, err)
+		return
+	}
+	if !h.precondition(w, r, fi) {
+		return
+	}
+
+	if err := h.FS.MkdirAll(name, 0755); err != nil {
+		h.fail(w, err)
+		return
+	}
+	h.modified(w, name, fi == nil)
+}
+
+func (h *RestHandler) delete(w http.ResponseWriter, r *http.Request, name string) {
+	fi, err := h.FS.Stat(name)
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	if !h.precondition(w, r, fi) {
+		return
+	}
+
+	if _, recursive := r.URL.Query()["recursive"]; recursive && fi.IsDir() && name != "/" {
+		err = h.FS.RemoveAll(name)
+	} else {
+		err = h.FS.Remove(name)
+	}
+	if err != nil {
+		h.fail(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//修改成功，返回新的 ETag
+func (h *RestHandler) modified(w http.ResponseWriter, name string, created bool) {
+	if fi, err := h.FS.Stat(name); err == nil {
+		w.Header().Set("ETag", restETag(fi))
+		w.Header().Set("Last-Modified", fi.ModTime().UTC().Format(http.TimeFormat))
+	}
+	if created {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+//修改前的条件检查，fi 为 nil 表示文件不存在，不满足时返回 412
+func (h *RestHandler) precondition(w http.ResponseWriter, r *http.Request, fi os.FileInfo) bool {
+	etag := ""
+	if fi != nil {
+		etag = restETag(fi)
+	}
+
+	ok := true
+	if im := r.Header.Get("If-Match"); im != "" {
+		ok = fi != nil && restMatch(im, etag)
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && fi != nil {
+		if t, err := http.ParseTime(ius); err == nil {
+			ok = !fi.ModTime().Truncate(time.Second).After(t)
+		}
+	}
+	if inm := r.Header.Get("If-None-Match"); inm != "" && fi != nil && restMatch(inm, etag) {
+		ok = false
+	}
+
+	if !ok {
+		h.error(w, http.StatusPreconditionFailed, fmt.Errorf("precondition failed"))
+	}
+	return ok
+}
+
+//header 为逗号分隔的 ETag 列表或 *，弱比较
+func restMatch(header, etag string) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, s := range strings.Split(header, ",") {
+		s = strings.TrimSpace(s)
+		if s == "*" || strings.TrimPrefix(s, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+//错误分类对应的状态码
+var restStatus = map[string]int{
+	"not_exist":  http.StatusNotFound,
+	"exist":      http.StatusConflict,
+	"permission": http.StatusForbidden,
+	"no_space":   http.StatusInsufficientStorage,
+	"locked":     http.StatusLocked,
+	"invalid":    http.StatusBadRequest,
+	"io":         http.StatusBadGateway,
+	"protocol":   http.StatusBadGateway,
+}
+
+func (h *RestHandler) fail(w http.ResponseWriter, err error) {
+	status, ok := restStatus[ErrorClass(err)]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	if e, ok := err.(*os.PathError); ok && e.Err == syscall.ENOTEMPTY {
+		status = http.StatusConflict
+	}
+	h.error(w, status, err)
+}
+
+func (h *RestHandler) error(w http.ResponseWriter, status int, err error) {
+	h.json(w, status, map[string]string{"error": err.Error()})
+}
+
+func (h *RestHandler) json(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
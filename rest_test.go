@@ -0,0 +1,113 @@
+package netfs
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func test_rest(t *testing.T, srv *httptest.Server, method, name, body string, header ...string) (*http.Response, string) {
+	req, err := http.NewRequest(method, srv.URL+name, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	b, _ := ioutil.ReadAll(resp.Body)
+	return resp, string(b)
+}
+
+func Test_RestHandler(t *testing.T) {
+	fs := test_mem_fs(t, "a/", "a/b.txt")
+	srv := httptest.NewServer(new(RestHandler).Init(fs))
+	defer srv.Close()
+
+	resp, body := test_rest(t, srv, "GET", "/a/b.txt", "")
+	if resp.StatusCode != 200 || body != "a/b.txt" {
+		t.Errorf("GET expect:200 a/b.txt, get:%d %s", resp.StatusCode, body)
+	}
+	etag := resp.Header.Get("ETag")
+	if etag == "" || resp.Header.Get("Last-Modified") == "" {
+		t.Errorf("GET expect:ETag Last-Modified, get:%v", resp.Header)
+	}
+
+	resp, body = test_rest(t, srv, "GET", "/a/b.txt", "", "Range", "bytes=2-4")
+	if resp.StatusCode != 206 || body != "b.t" {
+		t.Errorf("Range expect:206 b.t, get:%d %s", resp.StatusCode, body)
+	}
+	resp, _ = test_rest(t, srv, "GET", "/a/b.txt", "", "If-None-Match", etag)
+	if resp.StatusCode != 304 {
+		t.Errorf("If-None-Match expect:304, get:%d", resp.StatusCode)
+	}
+
+	//目录列表
+	resp, body = test_rest(t, srv, "GET", "/a", "")
+	var list []RestFileInfo
+	if err := json.Unmarshal([]byte(body), &list); err != nil || len(list) != 1 || list[0].Name != "b.txt" || list[0].Size != 7 {
+		t.Errorf("List expect:b.txt, get:%d %s", resp.StatusCode, body)
+	}
+	resp, body = test_rest(t, srv, "GET", "/a?stat", "")
+	if !strings.Contains(body, `"is_dir":true`) {
+		t.Errorf("Stat expect:is_dir, get:%d %s", resp.StatusCode, body)
+	}
+
+	//条件写入
+	resp, _ = test_rest(t, srv, "PUT", "/a/b.txt", "new", "If-Match", `"0-0"`)
+	if resp.StatusCode != 412 {
+		t.Errorf("If-Match expect:412, get:%d", resp.StatusCode)
+	}
+	resp, _ = test_rest(t, srv, "PUT", "/a/b.txt", "new", "If-None-Match", "*")
+	if resp.StatusCode != 412 {
+		t.Errorf("If-None-Match expect:412, get:%d", resp.StatusCode)
+	}
+	resp, _ = test_rest(t, srv, "PUT", "/a/b.txt", "new", "If-Match", etag)
+	if resp.StatusCode != 204 || resp.Header.Get("ETag") == etag {
+		t.Errorf("PUT expect:204 new ETag, get:%d %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	resp, _ = test_rest(t, srv, "POST", "/a/b.txt", "+1")
+	if resp.StatusCode != 204 {
+		t.Errorf("POST expect:204, get:%d", resp.StatusCode)
+	}
+	if s := test_read_file(fs, "a/b.txt"); s != "new+1" {
+		t.Errorf("Read expect:new+1, get:%s", s)
+	}
+
+	resp, _ = test_rest(t, srv, "PUT", "/c/", "")
+	if resp.StatusCode != 201 {
+		t.Errorf("Mkdir expect:201, get:%d", resp.StatusCode)
+	}
+	resp, _ = test_rest(t, srv, "PUT", "/c/d.txt", "d", "If-None-Match", "*")
+	if resp.StatusCode != 201 {
+		t.Errorf("PUT expect:201, get:%d", resp.StatusCode)
+	}
+
+	//删除
+	resp, body = test_rest(t, srv, "DELETE", "/c", "")
+	if resp.StatusCode != 409 || !strings.Contains(body, "error") {
+		t.Errorf("DELETE expect:409, get:%d %s", resp.StatusCode, body)
+	}
+	resp, _ = test_rest(t, srv, "DELETE", "/c?recursive", "")
+	if resp.StatusCode != 204 {
+		t.Errorf("DELETE expect:204, get:%d", resp.StatusCode)
+	}
+	resp, _ = test_rest(t, srv, "GET", "/c", "")
+	if resp.StatusCode != 404 {
+		t.Errorf("GET expect:404, get:%d", resp.StatusCode)
+	}
+
+	resp, _ = test_rest(t, srv, "PATCH", "/a", "")
+	if resp.StatusCode != 405 || resp.Header.Get("Allow") == "" {
+		t.Errorf("PATCH expect:405, get:%d", resp.StatusCode)
+	}
+}
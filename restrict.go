@@ -0,0 +1,227 @@
+package netfs
+
+import (
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+//路径过滤规则
+//Exclude 为 path.Match 格式的通配符，不含 "/" 的规则匹配路径中的任一级名称
+//(如 ".git"、"*.key")，含 "/" 的规则匹配从根开始的完整路径或其上级目录
+type RestrictRules struct {
+	Exclude []string
+}
+
+//隐藏匹配规则的路径，被隐藏的路径表现为不存在
+func Restrict(fs FileSystem, rules RestrictRules) FileSystem {
+	return &restrictFs{fs: fs, rules: rules}
+}
+
+type restrictFs struct {
+	fs    FileSystem
+	rules RestrictRules
+}
+
+func (r *restrictFs) hidden(name string) bool {
+	clean := strings.TrimPrefix(path.Clean("/"+name), "/")
+	if clean == "" {
+		return false
+	}
+
+	elems := strings.Split(clean, "/")
+
+	for _, pattern := range r.rules.Exclude {
+		pattern = strings.Trim(pattern, "/")
+
+		if !strings.Contains(pattern, "/") {
+			for _, elem := range elems {
+				if ok, _ := path.Match(pattern, elem); ok {
+					return true
+				}
+			}
+			continue
+		}
+
+		for i := range elems {
+			if ok, _ := path.Match(pattern, strings.Join(elems[:i+1], "/")); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (r *restrictFs) check(op, name string) error {
+	if r.hidden(name) {
+		return &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func (r *restrictFs) Chmod(name string, mode os.FileMode) error {
+	if err := r.check("chmod", name); err != nil {
+		return err
+	}
+	return r.fs.Chmod(name, mode)
+}
+
+func (r *restrictFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	if err := r.check("chtimes", name); err != nil {
+		return err
+	}
+	return r.fs.Chtimes(name, atime, mtime)
+}
+
+func (r *restrictFs) Mkdir(name string, perm os.FileMode) error {
+	if err := r.check("mkdir", name); err != nil {
+		return err
+	}
+	return r.fs.Mkdir(name, perm)
+}
+
+func (r *restrictFs) MkdirAll(path string, perm os.FileMode) error {
+	if err := r.check("mkdir", path); err != nil {
+		return err
+	}
+	return r.fs.MkdirAll(path, perm)
+}
+
+func (r *restrictFs) Remove(name string) error {
+	if err := r.check("remove", name); err != nil {
+		return err
+	}
+	return r.fs.Remove(name)
+}
+
+func (r *restrictFs) RemoveAll(path string) error {
+	if err := r.check("removeall", path); err != nil {
+		return err
+	}
+	return r.fs.RemoveAll(path)
+}
+
+func (r *restrictFs) Rename(oldpath, newpath string) error {
+	if r.hidden(oldpath) || r.hidden(newpath) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	return r.fs.Rename(oldpath, newpath)
+}
+
+func (r *restrictFs) Truncate(name string, size int64) error {
+	if err := r.check("truncate", name); err != nil {
+		return err
+	}
+	return r.fs.Truncate(name, size)
+}
+
+func (r *restrictFs) Create(name string) (file File, err error) {
+	if err := r.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err = r.fs.Create(name)
+	return r.wrap(name, file, err)
+}
+
+func (r *restrictFs) Open(name string) (file File, err error) {
+	if err := r.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err = r.fs.Open(name)
+	return r.wrap(name, file, err)
+}
+
+func (r *restrictFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if err := r.check("open", name); err != nil {
+		return nil, err
+	}
+	file, err = r.fs.OpenFile(name, flag, perm)
+	return r.wrap(name, file, err)
+}
+
+func (r *restrictFs) Stat(name string) (fi os.FileInfo, err error) {
+	if err := r.check("stat", name); err != nil {
+		return nil, err
+	}
+	return r.fs.Stat(name)
+}
+
+func (r *restrictFs) Lstat(name string) (fi os.FileInfo, err error) {
+	if err := r.check("lstat", name); err != nil {
+		return nil, err
+	}
+	return r.fs.Lstat(name)
+}
+
+func (r *restrictFs) wrap(name string, f File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &restrictFile{File: f, fs: r, dir: name}, nil
+}
+
+//目录列表中过滤掉被隐藏的项
+type restrictFile struct {
+	File
+	fs  *restrictFs
+	dir string
+}
+
+func (f *restrictFile) Readdir(n int) (fi []os.FileInfo, err error) {
+	for {
+		var list []os.FileInfo
+		list, err = f.File.Readdir(n)
+
+		for _, v := range list {
+			if !f.fs.hidden(path.Join(f.dir, v.Name())) {
+				fi = append(fi, v)
+			}
+		}
+
+		if n <= 0 || err != nil || len(fi) > 0 || len(list) == 0 {
+			break
+		}
+	}
+
+	if n > 0 && len(fi) == 0 && err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *restrictFile) Readdirnames(n int) (names []string, err error) {
+	for {
+		var list []string
+		list, err = f.File.Readdirnames(n)
+
+		for _, v := range list {
+			if !f.fs.hidden(path.Join(f.dir, v)) {
+				names = append(names, v)
+			}
+		}
+
+		if n <= 0 || err != nil || len(names) > 0 || len(list) == 0 {
+			break
+		}
+	}
+
+	if n > 0 && len(names) == 0 && err == nil {
+		err = io.EOF
+	}
+	return
+}
+
+func (f *restrictFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *restrictFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *restrictFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
@@ -0,0 +1,122 @@
+package netfs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func test_local_fs(t *testing.T, files ...string) (*LocalFs, func()) {
+	dir, err := ioutil.TempDir("", "netfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range files {
+		_name := filepath.Join(dir, name)
+
+		if strings.HasSuffix(name, "/") {
+			err = os.MkdirAll(_name, 0755)
+		} else {
+			os.MkdirAll(filepath.Dir(_name), 0755)
+			err = ioutil.WriteFile(_name, []byte(name), 0644)
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return new(LocalFs).Init(dir), func() { os.RemoveAll(dir) }
+}
+
+func Test_ReadOnly(t *testing.T) {
+	local, clean := test_local_fs(t, "a.txt", "dir/")
+	defer clean()
+
+	fs := ReadOnly(local)
+
+	if err := fs.Mkdir("b", 0755); err == nil {
+		t.Error("Mkdir expect:error, get:nil")
+	}
+
+	if err := fs.Remove("a.txt"); err == nil {
+		t.Error("Remove expect:error, get:nil")
+	}
+
+	if _, err := fs.Create("c.txt"); err == nil {
+		t.Error("Create expect:error, get:nil")
+	}
+
+	if _, err := fs.OpenFile("a.txt", os.O_RDWR, 0); err == nil {
+		t.Error("OpenFile O_RDWR expect:error, get:nil")
+	}
+
+	f, err := fs.Open("a.txt")
+	if err != nil {
+		t.Fatalf("Open expect:nil, get:%v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write([]byte("x")); err == nil {
+		t.Error("Write expect:error, get:nil")
+	}
+
+	if err := f.Chmod(0777); err == nil {
+		t.Error("Chmod expect:error, get:nil")
+	}
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil || string(b) != "a.txt" {
+		t.Errorf("Read expect:a.txt, get:%s %v", b, err)
+	}
+}
+
+func Test_Restrict(t *testing.T) {
+	local, clean := test_local_fs(t, "a.txt", "b.key", ".git/config", "sub/c.key", "sub/d.txt", "priv/e.txt")
+	defer clean()
+
+	fs := Restrict(local, RestrictRules{Exclude: []string{".git", "*.key", "/priv/*"}})
+
+	for _, name := range []string{"b.key", ".git/config", ".git", "sub/c.key", "priv/e.txt"} {
+		if _, err := fs.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("Stat %s expect:not exist, get:%v", name, err)
+		}
+		if _, err := fs.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open %s expect:not exist, get:%v", name, err)
+		}
+	}
+
+	for _, name := range []string{"a.txt", "sub/d.txt", "priv"} {
+		if _, err := fs.Stat(name); err != nil {
+			t.Errorf("Stat %s expect:nil, get:%v", name, err)
+		}
+	}
+
+	dir, err := fs.Open("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dir.Close()
+
+	names, err := dir.Readdirnames(-1)
+	sort.Strings(names)
+
+	if err != nil || strings.Join(names, ",") != "a.txt,priv,sub" {
+		t.Errorf("Readdirnames expect:a.txt,priv,sub, get:%v %v", names, err)
+	}
+
+	sub, err := fs.Open("sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	fis, err := sub.Readdir(1)
+	if err != nil || len(fis) != 1 || fis[0].Name() != "d.txt" {
+		t.Errorf("Readdir expect:d.txt, get:%v %v", fis, err)
+	}
+}
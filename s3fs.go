@@ -0,0 +1,1034 @@
+package netfs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//S3 兼容对象存储上的文件系统
+//
+//对象 Prefix/path 即文件，目录以 "path/" 前缀模拟，Mkdir 写入一个空的 "path/" 对象作为标记。
+//读取使用 Range 请求，写入缓存在内存中，Close 时上传，超过 PartSize 时分段上传。
+//对象存储没有权限与时间属性，Chmod/Chtimes 只检查文件是否存在；Rename 为复制后删除，不是原子的。
+type S3Fs struct {
+	Endpoint  string //如 https://s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string //为空时匿名访问
+	SecretKey string
+	PathStyle bool  //true 时请求 endpoint/bucket/key，否则 bucket.endpoint/key
+	PartSize  int64 //分段大小，S3 要求不小于 5M
+	Client    *http.Client
+}
+
+//顺序读取时每次请求的最小长度
+const s3ReadAhead = 1 << 20
+
+func (s *S3Fs) Init(endpoint, bucket, prefix string) *S3Fs {
+	s.Endpoint = strings.TrimRight(endpoint, "/")
+	s.Region = "us-east-1"
+	s.Bucket = bucket
+	s.Prefix = prefix
+	s.PathStyle = true
+	s.PartSize = 8 << 20
+	s.Client = http.DefaultClient
+	return s
+}
+
+func s3Clean(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+//name 对应的对象键
+func (s *S3Fs) key(name string) string {
+	p := strings.Trim(s.Prefix, "/")
+	n := s3Clean(name)
+	if p == "" || n == "" {
+		return p + n
+	}
+	return p + "/" + n
+}
+
+//目录下对象的公共前缀，根目录且无 Prefix 时为空
+func (s *S3Fs) dirKey(name string) string {
+	k := s.key(name)
+	if k != "" {
+		k += "/"
+	}
+	return k
+}
+
+// ----- 请求 -----
+
+type s3Error struct {
+	Status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("s3: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+func s3NotFound(err error) bool {
+	e, ok := err.(*s3Error)
+	return ok && e.Status == http.StatusNotFound
+}
+
+func s3PathError(op, name string, err error) error {
+	if e, ok := err.(*s3Error); ok {
+		switch e.Status {
+		case http.StatusNotFound:
+			err = os.ErrNotExist
+		case http.StatusForbidden:
+			err = os.ErrPermission
+		}
+	}
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
+
+//按 S3 的规则编码，path 为 true 时保留 /
+func s3Escape(s string, path bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' || path && c == '/' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+//按名称排序的查询串，同时也是签名用的规范形式
+func s3Query(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func s3Hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func s3Hmac(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+//AWS Signature Version 4 签名，payload 为请求体的 SHA256
+func s3Sign(req *http.Request, accessKey, secretKey, region string, t time.Time, payload string) {
+	amzDate := t.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if accessKey == "" {
+		return
+	}
+
+	names := []string{"host"}
+	for k := range req.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") || k == "range" || k == "content-type" || k == "content-md5" {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, k := range names {
+		v := req.Host
+		if k != "host" {
+			v = strings.Join(req.Header.Values(k), ",")
+		}
+		headers.WriteString(k + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signed,
+		payload,
+	}, "\n")
+
+	date := amzDate[:8]
+	scope := date + "/" + region + "/s3/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + s3Hash([]byte(canonical))
+
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date, region, "s3", "aws4_request"} {
+		key = s3Hmac(key, s)
+	}
+	sig := hex.EncodeToString(s3Hmac(key, toSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		",SignedHeaders="+signed+",Signature="+sig)
+}
+
+//发送请求，非 2xx 的应答转为 *s3Error
+func (s *S3Fs) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		u.Path = "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path = "/" + key
+	}
+	u.RawPath = s3Escape(u.Path, true)
+	u.RawQuery = s3Query(query)
+
+	var r io.Reader = http.NoBody
+	if len(body) > 0 {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s3Sign(req, s.AccessKey, s.SecretKey, s.Region, time.Now(), s3Hash(body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		e := &s3Error{Status: resp.StatusCode}
+		b, _ := ioutil.ReadAll(resp.Body)
+		xml.Unmarshal(b, e)
+		return nil, e
+	}
+	return resp, nil
+}
+
+//读完应答，复制与合并分段时错误可能在 200 应答的内容中
+func s3Done(resp *http.Response) error {
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if bytes.Contains(b, []byte("<Error>")) {
+		e := &s3Error{Status: resp.StatusCode}
+		xml.Unmarshal(b, e)
+		return e
+	}
+	return nil
+}
+
+func s3Decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
+
+// ----- 对象操作 -----
+
+//读取 [off, off+n)，n < 0 时读到末尾，超出文件时返回 io.EOF
+func (s *S3Fs) get(key string, off, n int64) ([]byte, error) {
+	h := http.Header{}
+	if n > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+	} else if off > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+
+	resp, err := s.do("GET", key, nil, h, nil)
+	if e, ok := err.(*s3Error); ok && e.Status == http.StatusRequestedRangeNotSatisfiable {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+func (s *S3Fs) head(name string) (os.FileInfo, error) {
+	resp, err := s.do("HEAD", s.key(name), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	fi := &FileInfo{name: path.Base("/" + name), size: resp.ContentLength, mode: 0644}
+	fi.modtime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return fi, nil
+}
+
+func (s *S3Fs) put(key string, data []byte) error {
+	size := s.PartSize
+	if size <= 0 {
+		size = 8 << 20
+	}
+	if int64(len(data)) > size {
+		return s.multipart(key, data, int(size))
+	}
+
+	resp, err := s.do("PUT", key, nil, nil, data)
+	if err != nil {
+		return err
+	}
+	return s3Done(resp)
+}
+
+type s3Part struct {
+	PartNumber int
+	ETag       string
+}
+
+func (s *S3Fs) multipart(key string, data []byte, size int) (err error) {
+	resp, err := s.do("POST", key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	var init struct {
+		UploadId string
+	}
+	if err = s3Decode(resp, &init); err != nil {
+		return err
+	}
+
+	id := url.Values{"uploadId": {init.UploadId}}
+	defer func() {
+		if err != nil {
+			if resp, e := s.do("DELETE", key, id, nil, nil); e == nil {
+				resp.Body.Close()
+			}
+		}
+	}()
+
+	var complete struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}
+	for i := 1; len(data) > 0; i++ {
+		n := size
+		if n > len(data) {
+			n = len(data)
+		}
+		q := url.Values{"partNumber": {strconv.Itoa(i)}, "uploadId": {init.UploadId}}
+		resp, err := s.do("PUT", key, q, nil, data[:n])
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		complete.Parts = append(complete.Parts, s3Part{PartNumber: i, ETag: resp.Header.Get("ETag")})
+		data = data[n:]
+	}
+
+	body, err := xml.Marshal(&complete)
+	if err != nil {
+		return err
+	}
+	resp, err = s.do("POST", key, id, nil, body)
+	if err != nil {
+		return err
+	}
+	return s3Done(resp)
+}
+
+func (s *S3Fs) copy(src, dst string) error {
+	h := http.Header{"X-Amz-Copy-Source": {s3Escape("/"+s.Bucket+"/"+src, true)}}
+	resp, err := s.do("PUT", dst, nil, h, nil)
+	if err != nil {
+		return err
+	}
+	return s3Done(resp)
+}
+
+func (s *S3Fs) delete(key string) error {
+	//空键会指向存储桶本身
+	if key == "" {
+		return nil
+	}
+	resp, err := s.do("DELETE", key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return s3Done(resp)
+}
+
+type s3Object struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+}
+
+type s3ListResult struct {
+	Contents       []s3Object
+	CommonPrefixes []struct {
+		Prefix string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+//列出 prefix 下的对象与子目录前缀，delimiter 为空时递归列出，max > 0 时至少返回 max 项后停止
+func (s *S3Fs) list(prefix, delimiter string, max int) (objects []s3Object, dirs []string, err error) {
+	q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	if delimiter != "" {
+		q.Set("delimiter", delimiter)
+	}
+	if max > 0 {
+		q.Set("max-keys", strconv.Itoa(max))
+	}
+
+	for {
+		resp, err := s.do("GET", "", q, nil, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		var r s3ListResult
+		if err = s3Decode(resp, &r); err != nil {
+			return nil, nil, err
+		}
+
+		objects = append(objects, r.Contents...)
+		for _, p := range r.CommonPrefixes {
+			dirs = append(dirs, p.Prefix)
+		}
+		if !r.IsTruncated || r.NextContinuationToken == "" || max > 0 && len(objects)+len(dirs) >= max {
+			return objects, dirs, nil
+		}
+		q.Set("continuation-token", r.NextContinuationToken)
+	}
+}
+
+// ----- FileSystem -----
+
+func (s *S3Fs) stat(op, name string) (os.FileInfo, error) {
+	if s3Clean(name) == "" {
+		return &FileInfo{name: "/", mode: os.ModeDir | 0755}, nil
+	}
+
+	fi, err := s.head(name)
+	if err == nil {
+		return fi, nil
+	}
+	if !s3NotFound(err) {
+		return nil, s3PathError(op, name, err)
+	}
+
+	//目录标记或以目录为前缀的对象
+	prefix := s.dirKey(name)
+	objects, dirs, err := s.list(prefix, "/", 1)
+	if err != nil {
+		return nil, s3PathError(op, name, err)
+	}
+	if len(objects)+len(dirs) == 0 {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+
+	dir := &FileInfo{name: path.Base("/" + name), mode: os.ModeDir | 0755}
+	if len(objects) > 0 && objects[0].Key == prefix {
+		dir.modtime = objects[0].LastModified
+	}
+	return dir, nil
+}
+
+//上级目录须存在
+func (s *S3Fs) checkParent(op, name string) error {
+	fi, err := s.stat(op, path.Dir("/"+s3Clean(name)))
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+	return nil
+}
+
+func (s *S3Fs) Chmod(name string, mode os.FileMode) error {
+	_, err := s.stat("chmod", name)
+	return err
+}
+
+func (s *S3Fs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	_, err := s.stat("chtimes", name)
+	return err
+}
+
+func (s *S3Fs) Mkdir(name string, perm os.FileMode) error {
+	if _, err := s.stat("mkdir", name); err == nil {
+		return &os.PathError{Op: "mkdir", Path: name, Err: os.ErrExist}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.checkParent("mkdir", name); err != nil {
+		return err
+	}
+
+	if err := s.put(s.dirKey(name), nil); err != nil {
+		return s3PathError("mkdir", name, err)
+	}
+	return nil
+}
+
+func (s *S3Fs) MkdirAll(pathName string, perm os.FileMode) error {
+	fi, err := s.stat("mkdir", pathName)
+	if err == nil {
+		if fi.IsDir() {
+			return nil
+		}
+		return &os.PathError{Op: "mkdir", Path: pathName, Err: syscall.ENOTDIR}
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := s.MkdirAll(path.Dir("/"+s3Clean(pathName)), perm); err != nil {
+		return err
+	}
+	if err := s.put(s.dirKey(pathName), nil); err != nil {
+		return s3PathError("mkdir", pathName, err)
+	}
+	return nil
+}
+
+func (s *S3Fs) Remove(name string) error {
+	fi, err := s.stat("remove", name)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		err = s.delete(s.key(name))
+	} else {
+		prefix := s.dirKey(name)
+		objects, dirs, err := s.list(prefix, "/", 2)
+		if err != nil {
+			return s3PathError("remove", name, err)
+		}
+		for _, o := range objects {
+			if o.Key != prefix {
+				dirs = append(dirs, o.Key)
+			}
+		}
+		if len(dirs) > 0 {
+			return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+		}
+		err = s.delete(prefix)
+	}
+
+	if err != nil {
+		return s3PathError("remove", name, err)
+	}
+	return nil
+}
+
+func (s *S3Fs) RemoveAll(pathName string) error {
+	fi, err := s.stat("removeall", pathName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		if err := s.delete(s.key(pathName)); err != nil {
+			return s3PathError("removeall", pathName, err)
+		}
+		return nil
+	}
+
+	objects, _, err := s.list(s.dirKey(pathName), "", 0)
+	if err != nil {
+		return s3PathError("removeall", pathName, err)
+	}
+	for _, o := range objects {
+		if err := s.delete(o.Key); err != nil {
+			return s3PathError("removeall", pathName, err)
+		}
+	}
+	return nil
+}
+
+func (s *S3Fs) Rename(oldpath, newpath string) error {
+	src, dst := s3Clean(oldpath), s3Clean(newpath)
+	if src == "" || dst == "" || strings.HasPrefix(dst+"/", src+"/") {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EINVAL}
+	}
+
+	fi, err := s.stat("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	if err := s.checkParent("rename", newpath); err != nil {
+		return err
+	}
+
+	to, err := s.stat("rename", newpath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if to != nil && (fi.IsDir() || to.IsDir()) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+
+	if !fi.IsDir() {
+		err = s.copy(s.key(oldpath), s.key(newpath))
+		if err == nil {
+			err = s.delete(s.key(oldpath))
+		}
+	} else {
+		err = s.renameDir(s.dirKey(oldpath), s.dirKey(newpath))
+	}
+
+	if err != nil {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: err}
+	}
+	return nil
+}
+
+//逐个复制目录下的对象后删除
+func (s *S3Fs) renameDir(src, dst string) error {
+	objects, _, err := s.list(src, "", 0)
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		if err := s.copy(o.Key, dst+o.Key[len(src):]); err != nil {
+			return err
+		}
+		if err := s.delete(o.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *S3Fs) Truncate(name string, size int64) error {
+	f, err := s.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(size)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func (s *S3Fs) Create(name string) (file File, err error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (s *S3Fs) Open(name string) (file File, err error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (s *S3Fs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	fi, err := s.stat("open", name)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f := &s3File{fs: s, name: name, key: s.key(name), flag: flag, info: fi}
+
+	if fi == nil {
+		if flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+		if err := s.checkParent("open", name); err != nil {
+			return nil, err
+		}
+
+		//先写入空对象，创建后即可见
+		if err := s.put(f.key, nil); err != nil {
+			return nil, s3PathError("open", name, err)
+		}
+		f.info = &FileInfo{name: path.Base("/" + name), mode: 0644, modtime: time.Now()}
+		f.loaded = true
+		return f, nil
+	}
+
+	if flag&(os.O_CREATE|os.O_EXCL) == os.O_CREATE|os.O_EXCL {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+	}
+	if fi.IsDir() && isWriteFlag(flag) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+	}
+	if flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+		f.loaded, f.dirty = true, true
+	}
+	return f, nil
+}
+
+func (s *S3Fs) Stat(name string) (fi os.FileInfo, err error) {
+	return s.stat("stat", name)
+}
+
+func (s *S3Fs) Lstat(name string) (fi os.FileInfo, err error) {
+	return s.stat("lstat", name)
+}
+
+// ----- File -----
+
+type s3File struct {
+	mu     sync.Mutex
+	fs     *S3Fs
+	name   string
+	key    string
+	flag   int
+	info   os.FileInfo
+	off    int64
+	data   []byte //loaded 后为文件的全部内容，写入在此修改
+	loaded bool
+	dirty  bool
+	rbuf   []byte //预读的内容，起始于 roff
+	roff   int64
+	dirs   []os.FileInfo
+	listed bool
+	closed bool
+}
+
+func (f *s3File) check(op string, write bool) error {
+	if f.closed {
+		return &os.PathError{Op: op, Path: f.name, Err: os.ErrClosed}
+	}
+
+	acc := f.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	if write && acc == os.O_RDONLY || !write && acc == os.O_WRONLY {
+		return &os.PathError{Op: op, Path: f.name, Err: syscall.EBADF}
+	}
+	return nil
+}
+
+func (f *s3File) size() int64 {
+	if f.loaded {
+		return int64(len(f.data))
+	}
+	return f.info.Size()
+}
+
+//写入前读取整个对象
+func (f *s3File) load() error {
+	if f.loaded {
+		return nil
+	}
+	data, err := f.fs.get(f.key, 0, -1)
+	if err != nil && err != io.EOF {
+		return s3PathError("read", f.name, err)
+	}
+	f.data, f.loaded, f.rbuf = data, true, nil
+	return nil
+}
+
+//上传修改过的内容
+func (f *s3File) sync() error {
+	if !f.dirty {
+		return nil
+	}
+	if err := f.fs.put(f.key, f.data); err != nil {
+		return s3PathError("sync", f.name, err)
+	}
+	f.dirty = false
+	f.info = &FileInfo{name: f.info.Name(), size: int64(len(f.data)), mode: f.info.Mode(), modtime: time.Now()}
+	return nil
+}
+
+func (f *s3File) Chmod(mode os.FileMode) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "chmod", Path: f.name, Err: os.ErrClosed}
+	}
+	return nil
+}
+
+func (f *s3File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "close", Path: f.name, Err: os.ErrClosed}
+	}
+	f.closed = true
+	return f.sync()
+}
+
+func (f *s3File) Name() string {
+	return f.name
+}
+
+func (f *s3File) Read(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n, err = f.readAt(b, f.off)
+	f.off += int64(n)
+	return
+}
+
+func (f *s3File) ReadAt(b []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for n < len(b) && err == nil {
+		var m int
+		m, err = f.readAt(b[n:], off+int64(n))
+		n += m
+	}
+	return
+}
+
+//从缓存或预读内容中读取，可能少于 len(b)
+func (f *s3File) readAt(b []byte, off int64) (n int, err error) {
+	if err = f.check("read", false); err != nil {
+		return 0, err
+	}
+	if f.info.IsDir() {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EISDIR}
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "read", Path: f.name, Err: syscall.EINVAL}
+	}
+	if off >= f.size() {
+		if len(b) == 0 {
+			return 0, nil
+		}
+		return 0, io.EOF
+	}
+	if f.loaded {
+		return copy(b, f.data[off:]), nil
+	}
+
+	if off < f.roff || off >= f.roff+int64(len(f.rbuf)) {
+		n := int64(len(b))
+		if n < s3ReadAhead {
+			n = s3ReadAhead
+		}
+		f.rbuf, f.roff = nil, off
+
+		data, err := f.fs.get(f.key, off, n)
+		if err == io.EOF || err == nil && len(data) == 0 {
+			return 0, io.EOF
+		}
+		if err != nil {
+			return 0, s3PathError("read", f.name, err)
+		}
+		f.rbuf = data
+	}
+	return copy(b, f.rbuf[off-f.roff:]), nil
+}
+
+func (f *s3File) Readdir(n int) (fi []os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err = f.check("readdirent", false); err != nil {
+		return nil, err
+	}
+	if !f.info.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: f.name, Err: syscall.ENOTDIR}
+	}
+
+	if !f.listed {
+		prefix := f.fs.dirKey(f.name)
+		objects, dirs, err := f.fs.list(prefix, "/", 0)
+		if err != nil {
+			return nil, s3PathError("readdirent", f.name, err)
+		}
+
+		f.dirs = f.dirs[:0]
+		for _, o := range objects {
+			if name := o.Key[len(prefix):]; name != "" {
+				f.dirs = append(f.dirs, &FileInfo{name: name, size: o.Size, mode: 0644, modtime: o.LastModified})
+			}
+		}
+		for _, d := range dirs {
+			if name := strings.TrimSuffix(d[len(prefix):], "/"); name != "" {
+				f.dirs = append(f.dirs, &FileInfo{name: name, mode: os.ModeDir | 0755})
+			}
+		}
+		sort.Slice(f.dirs, func(i, j int) bool { return f.dirs[i].Name() < f.dirs[j].Name() })
+		f.listed = true
+	}
+
+	if n > 0 && len(f.dirs) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(f.dirs) {
+		n = len(f.dirs)
+	}
+
+	fi = f.dirs[:n]
+	f.dirs = f.dirs[n:]
+	return
+}
+
+func (f *s3File) Readdirnames(n int) (names []string, err error) {
+	fis, err := f.Readdir(n)
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return
+}
+
+func (f *s3File) Seek(offset int64, whence int) (ret int64, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: os.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+		ret = offset
+	case io.SeekCurrent:
+		ret = f.off + offset
+	case io.SeekEnd:
+		ret = f.size() + offset
+	default:
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	if ret < 0 {
+		return 0, &os.PathError{Op: "seek", Path: f.name, Err: syscall.EINVAL}
+	}
+
+	f.off = ret
+	if ret == 0 {
+		f.listed = false
+	}
+	return ret, nil
+}
+
+func (f *s3File) Stat() (fi os.FileInfo, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, &os.PathError{Op: "stat", Path: f.name, Err: os.ErrClosed}
+	}
+	modtime := f.info.ModTime()
+	if f.dirty {
+		modtime = time.Now()
+	}
+	return &FileInfo{name: f.info.Name(), size: f.size(), mode: f.info.Mode(), modtime: modtime}, nil
+}
+
+func (f *s3File) Sync() (err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return &os.PathError{Op: "sync", Path: f.name, Err: os.ErrClosed}
+	}
+	return f.sync()
+}
+
+func (f *s3File) Truncate(size int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &os.PathError{Op: "truncate", Path: f.name, Err: syscall.EINVAL}
+	}
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	if size > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, size-int64(len(f.data)))...)
+	}
+	f.data = f.data[:size]
+	f.dirty = true
+	return nil
+}
+
+func (f *s3File) Write(b []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.off = f.size()
+	}
+
+	n, err = f.writeAt(b, f.off)
+	f.off += int64(n)
+	return
+}
+
+func (f *s3File) WriteAt(b []byte, off int64) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &os.PathError{Op: "writeat", Path: f.name, Err: syscall.EINVAL}
+	}
+	return f.writeAt(b, off)
+}
+
+func (f *s3File) writeAt(b []byte, off int64) (n int, err error) {
+	if err = f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &os.PathError{Op: "write", Path: f.name, Err: syscall.EINVAL}
+	}
+	if err = f.load(); err != nil {
+		return 0, err
+	}
+
+	end := off + int64(len(b))
+	if end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+
+	n = copy(f.data[off:], b)
+	f.dirty = true
+	return n, nil
+}
+
+func (f *s3File) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
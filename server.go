@@ -1,58 +1,84 @@
 package netfs
 
 import (
+	"io"
 	"net"
+	"path"
+	"strings"
 	"time"
 	"fmt"
+	"sync/atomic"
 )
 
 func Listen(addr string, fs FileSystem) {
-	if fs == nil {
-		fs = new(LocalFs).Init("./")
-	}
-
-	ln, err := net.Listen("tcp", addr)
-	if err != nil {
-		getLog().Crit(err.Error())
-	}
-
-	l := ln.(*net.TCPListener)
-
-	for {
-		conn, err := l.AcceptTCP()
-		if err != nil {
-			getLog().Crit(err.Error())
-		}
-
-		go RunRev(conn, fs)
-	}
+	new(Exports).Init().Add(&Share{Fs: fs}).Listen(addr)
 }
 
 func RunRev(conn *net.TCPConn, fs FileSystem) {
+	runRev(conn, nil, fs)
+}
+
+func runRev(conn net.Conn, exports *Exports, fs FileSystem) {
+	c := new(Server)
+
 	defer func() {
 		if x := recover(); x != nil {
 			switch v := x.(type) {
 			case IO_Error :
-				getLog().Notice("io: " + conn.RemoteAddr().String() + " " + v.Error())
+				c.observe(v)
+				c.log.Info("link io error", c.logArgs("error", v)...)
 			case Data_Error :
-				getLog().Notice("data: " + conn.RemoteAddr().String() + " " + v.Error())
+				c.observe(v)
+				c.log.Warn("link protocol error", c.logArgs("error", v)...)
 			default:
 				panic(v)
 			}
 		}
 	}()
 
-	getLog().Debug("link: from " + conn.RemoteAddr().String())
-	defer getLog().Debug("link: close " + conn.RemoteAddr().String())
+	c.session = nextSession()
+	c.remote = conn.RemoteAddr().String()
+	c.log = getLog()
+	if exports != nil && exports.Logger != nil {
+		c.log = exports.Logger
+	}
 
-	conn.SetLinger(5)
-	conn.SetKeepAlivePeriod(10 * time.Second)
-	conn.SetKeepAlive(true)
+	c.log.Debug("link open", c.logArgs()...)
+	defer c.log.Debug("link close", c.logArgs()...)
+
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(5)
+		tc.SetKeepAlivePeriod(10 * time.Second)
+		tc.SetKeepAlive(true)
+	}
 
-	c := new(Server)
 	c.init(conn, 4096, 4096)
+	if exports != nil {
+		if !exports.track(c) {
+			conn.Close()
+			return
+		}
+		defer exports.untrack(c)
+	}
+
 	c.fs = fs
 	c.fds = make(map[uint32]File)
+	c.exports = exports
+	c.metrics = DefaultMetrics
+	if exports != nil && exports.Metrics != nil {
+		c.metrics = exports.Metrics
+	}
+	if exports != nil && exports.RateLimits != nil {
+		c.limits = exports.RateLimits
+		c.limits.init()
+		c.buckets = newRateBuckets(c.limits.Session)
+	}
+	if exports != nil {
+		//默认目录不存在或无权访问时操作返回错误，认证或选择其它目录后可继续使用
+		if s := exports.Get(""); !c.setShare(s) {
+			c.fs = noShare(s)
+		}
+	}
 	c.Run()
 }
 
@@ -61,34 +87,134 @@ type Server struct {
 	fs FileSystem
 	fid uint32
 	fds map[uint32]File
+
+	exports *Exports
+	share *Share
+	principal string
+
+	log Log
+	session uint64
+	remote string
+
+	limits *RateLimits
+	buckets rateBuckets
+
+	//正在处理请求，关闭服务时等待其完成
+	busy int32
+
+	//当前请求，用于统计与日志
+	metrics Metrics
+	op uint8
+	path string
+	start time.Time
+	err error
 }
 
 func (c *Server) Run() {
 	defer c.Close()
 
 	if err := c.LinkInit(); err != nil {
-		getLog().Info("link: " + err.Error())
+		if c.metrics != nil {
+			c.metrics.HandshakeFailed("server")
+		}
+		c.log.Info("link handshake failed", c.logArgs("error", err)...)
 		return
 	}
 
+	if c.metrics != nil {
+		c.metrics.Sessions(1)
+		defer c.metrics.Sessions(-1)
+	}
+
 	for {
 		c.setDeadline(IdleTimeout)
 
 		code := c.waitRequest()
+		atomic.StoreInt32(&c.busy, 1)
+		c.op, c.path, c.start, c.err = code, "", time.Now(), nil
+
+		if code != LINK_CLOSE {
+			c.throttle(1, 0)
+		}
+
 		switch code {
 		case LINK_CLOSE :
 			return
 		case LINK_PING :
 			c.doResponse(LINK_PING)
+		case LINK_AUTH :
+			c.link_auth()
+		case LINK_SHARE :
+			c.link_share()
+		case FS_WATCH :
+			//该连接此后只用于推送事件
+			atomic.StoreInt32(&c.busy, 0)
+			c.fs_watch()
+			return
 		default:
 			c.doAction(code)
 		}
 
 		c.flush()
+		c.observe(c.err)
+		atomic.StoreInt32(&c.busy, 0)
+	}
+}
+
+//记录当前请求的统计与日志
+func (c *Server) observe(err error) {
+	if c.start.IsZero() {
+		return
+	}
+
+	d := time.Since(c.start)
+	c.start = time.Time{}
+
+	if c.metrics != nil {
+		c.metrics.Request("server", c.op, d, err)
+	}
+
+	args := c.logArgs("op", OpName(c.op), "path", c.path, "duration", d)
+	if err != nil && err != io.EOF {
+		args = append(args, "error", err)
 	}
+	c.log.Debug("request", args...)
+}
+
+//读取请求中的路径并限制在共享目录内，同时记入日志
+func (c *Server) readPath() string {
+	c.path = cleanPath(c.readString())
+	return c.path
+}
+
+//去掉越过根目录的 ..，相对路径仍保持相对
+func cleanPath(name string) string {
+	p := path.Clean("/" + name)
+	if strings.HasPrefix(name, "/") {
+		return p
+	}
+	if p == "/" {
+		return "."
+	}
+	return p[1:]
+}
+
+func (c *Server) transfer(read, written int) {
+	if c.metrics != nil {
+		c.metrics.Transfer("server", int64(read), int64(written))
+	}
+}
+
+func (c *Server) writeError(err error) {
+	c.err = err
+	c.conn.writeError(err)
 }
 
 func (c *Server) doAction(code uint8) {
+	if c.fs == nil {
+		c.fs = noShare(nil)
+	}
+
 	switch (code) {
 		//文件系统操作码
 		case FS_CHMOD     : c.fs_chmod()
@@ -118,6 +244,8 @@ func (c *Server) doAction(code uint8) {
 		case FILE_TRUNCATE : c.f_truncate()
 		case FILE_WRITE    : c.f_write()
 		case FILE_WRITEAT  : c.f_writeAt()
+		case FILE_LOCK     : c.f_lock()
+		case FILE_UNLOCK   : c.f_unlock()
 		default:
 		panic(Data_Error(fmt.Sprintf("Unexpect Target:%d", code)))
 	}
@@ -130,6 +258,9 @@ func (c *Server) addFile(f File) uint32 {
 
 	c.fid++
 	c.fds[c.fid] = f
+	if c.metrics != nil {
+		c.metrics.Fids(1)
+	}
 	return c.fid
 }
 
@@ -138,16 +269,24 @@ func (c *Server) getFile(fid uint32) File {
 	if !ok {
 		panic(Data_Error(fmt.Sprintf("Undefined Fid:%d", fid)))
 	}
+	c.path = f.Name()
 	return f
 }
 
 func (c *Server) delFile(fid uint32) {
+	if _, ok := c.fds[fid]; ok && c.metrics != nil {
+		c.metrics.Fids(-1)
+	}
 	delete(c.fds, fid)
 }
 
 func (c *Server) Close() {
 	for _, f := range c.fds {
 		f.Close()
+		fileLocks.release(f)
+	}
+	if c.metrics != nil {
+		c.metrics.Fids(-int64(len(c.fds)))
 	}
 
 	c.conn.Close()
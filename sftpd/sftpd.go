@@ -0,0 +1,310 @@
+// SFTP 服务，把任意 netfs.FileSystem 通过 SSH 提供给 SFTP 客户端
+//
+//	s := new(sftpd.Server).Init(hostKey, func(principal string) (netfs.FileSystem, error) {
+//		return fs, nil
+//	})
+//	s.AddKey("bob", authorizedKey)
+//	s.ServeListener(l)
+package sftpd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	netfs "github.com/bybzmt/golang-netfs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+//公钥认证，公钥对应 netfs 的 principal
+type Server struct {
+	Config *ssh.ServerConfig
+
+	//认证后为每个会话取得文件系统
+	FS func(principal string) (netfs.FileSystem, error)
+
+	mu   sync.RWMutex
+	keys map[string]string
+}
+
+func (s *Server) Init(hostKey ssh.Signer, fs func(principal string) (netfs.FileSystem, error)) *Server {
+	s.FS = fs
+	s.keys = make(map[string]string)
+	s.Config = &ssh.ServerConfig{PublicKeyCallback: s.auth}
+	s.Config.AddHostKey(hostKey)
+	return s
+}
+
+//添加 authorized_keys 格式的公钥，可以有多行
+func (s *Server) AddKey(principal string, authorizedKeys []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for len(authorizedKeys) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(authorizedKeys)
+		if err != nil {
+			break
+		}
+		s.keys[string(key.Marshal())] = principal
+		authorizedKeys = rest
+		n++
+	}
+	if n == 0 {
+		return errors.New("sftpd: no public key found")
+	}
+	return nil
+}
+
+//删除 principal 的所有公钥
+func (s *Server) RemoveKeys(principal string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, p := range s.keys {
+		if p == principal {
+			delete(s.keys, k)
+		}
+	}
+}
+
+func (s *Server) auth(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	s.mu.RLock()
+	principal, ok := s.keys[string(key.Marshal())]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("sftpd: unknown public key for %s", meta.User())
+	}
+	return &ssh.Permissions{Extensions: map[string]string{"principal": principal}}, nil
+}
+
+func (s *Server) ServeListener(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.Serve(conn)
+	}
+}
+
+//处理一个 SSH 连接，只接受 sftp 子系统
+func (s *Server) Serve(conn net.Conn) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, s.Config)
+	if err != nil {
+		logger().Warn("sftp handshake failed", "remote", conn.RemoteAddr().String(), "error", err)
+		conn.Close()
+		return
+	}
+	defer sconn.Close()
+	go ssh.DiscardRequests(reqs)
+
+	principal := sconn.Permissions.Extensions["principal"]
+	logger().Info("sftp login", "remote", conn.RemoteAddr().String(), "principal", principal)
+
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go s.session(ch, reqs, principal)
+	}
+}
+
+func (s *Server) session(ch ssh.Channel, reqs <-chan *ssh.Request, principal string) {
+	defer ch.Close()
+
+	for req := range reqs {
+		//subsystem 请求的负载为长度前缀的名称
+		ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+		req.Reply(ok, nil)
+		if !ok {
+			continue
+		}
+
+		fs, err := s.FS(principal)
+		if err != nil {
+			logger().Warn("sftp filesystem", "principal", principal, "error", err)
+			return
+		}
+		if c, ok := fs.(*netfs.Client); ok {
+			fs = netfs.Serialize(c)
+		}
+
+		go ssh.DiscardRequests(reqs)
+
+		srv := sftp.NewRequestServer(ch, Handlers(fs))
+		if err := srv.Serve(); err != nil && err != io.EOF {
+			logger().Debug("sftp closed", "principal", principal, "error", err)
+		}
+		srv.Close()
+		return
+	}
+}
+
+//netfs.Logger 为 nil 时不输出
+func logger() netfs.Log {
+	if netfs.Logger != nil {
+		return netfs.Logger
+	}
+	return netfs.NopLog{}
+}
+
+// ----- 请求处理 -----
+
+//SFTP 请求处理，fs 需并发安全
+func Handlers(fs netfs.FileSystem) sftp.Handlers {
+	h := &handler{fs: fs}
+	return sftp.Handlers{FileGet: h, FilePut: h, FileCmd: h, FileList: h}
+}
+
+type handler struct {
+	fs netfs.FileSystem
+}
+
+func (h *handler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	return h.fs.OpenFile(r.Filepath, os.O_RDONLY, 0)
+}
+
+func (h *handler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return h.fs.OpenFile(r.Filepath, openFlag(r.Pflags()), 0644)
+}
+
+func (h *handler) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	return h.fs.OpenFile(r.Filepath, openFlag(r.Pflags()), 0644)
+}
+
+//写入总是带偏移，忽略 Append
+func openFlag(p sftp.FileOpenFlags) int {
+	flag := os.O_RDONLY
+	switch {
+	case p.Read && p.Write:
+		flag = os.O_RDWR
+	case p.Write:
+		flag = os.O_WRONLY
+	}
+	if p.Creat {
+		flag |= os.O_CREATE
+	}
+	if p.Trunc {
+		flag |= os.O_TRUNC
+	}
+	if p.Excl {
+		flag |= os.O_EXCL
+	}
+	return flag
+}
+
+func (h *handler) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		return h.setstat(r)
+	case "Rename":
+		//SFTP 的 rename 不覆盖已有文件
+		if _, err := h.fs.Lstat(r.Target); err == nil {
+			return &os.LinkError{Op: "rename", Old: r.Filepath, New: r.Target, Err: os.ErrExist}
+		}
+		return h.fs.Rename(r.Filepath, r.Target)
+	case "Rmdir":
+		fi, err := h.fs.Lstat(r.Filepath)
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return &os.PathError{Op: "rmdir", Path: r.Filepath, Err: syscall.ENOTDIR}
+		}
+		return h.fs.Remove(r.Filepath)
+	case "Remove":
+		return h.fs.Remove(r.Filepath)
+	case "Mkdir":
+		return h.fs.Mkdir(r.Filepath, 0755)
+	}
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handler) PosixRename(r *sftp.Request) error {
+	return h.fs.Rename(r.Filepath, r.Target)
+}
+
+//不支持修改属主
+func (h *handler) setstat(r *sftp.Request) error {
+	flags := r.AttrFlags()
+	attrs := r.Attributes()
+
+	if flags.Size {
+		if err := h.fs.Truncate(r.Filepath, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := h.fs.Chmod(r.Filepath, os.FileMode(attrs.Mode&0777)); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		atime := time.Unix(int64(attrs.Atime), 0)
+		mtime := time.Unix(int64(attrs.Mtime), 0)
+		if err := h.fs.Chtimes(r.Filepath, atime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	switch r.Method {
+	case "List":
+		f, err := h.fs.Open(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		fis, err := f.Readdir(-1)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+		return listerAt(fis), nil
+	case "Stat":
+		fi, err := h.fs.Stat(r.Filepath)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{fi}, nil
+	}
+	return nil, sftp.ErrSSHFxOpUnsupported
+}
+
+func (h *handler) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	fi, err := h.fs.Lstat(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{fi}, nil
+}
+
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(ls []os.FileInfo, off int64) (int, error) {
+	if off >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[off:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
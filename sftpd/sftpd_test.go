@@ -0,0 +1,141 @@
+package sftpd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	netfs "github.com/bybzmt/golang-netfs"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+func test_signer(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func test_dial(addr string, key ssh.Signer) (*sftp.Client, error) {
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "anyone",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(key)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sftp.NewClient(conn)
+}
+
+func Test_Sftp(t *testing.T) {
+	fs := new(netfs.MemFs).Init()
+	fs.Mkdir("/bob", 0755)
+
+	var principals []string
+	s := new(Server).Init(test_signer(t), func(principal string) (netfs.FileSystem, error) {
+		principals = append(principals, principal)
+		return fs, nil
+	})
+
+	bob, stranger := test_signer(t), test_signer(t)
+	if err := s.AddKey("bob", ssh.MarshalAuthorizedKey(bob.PublicKey())); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:11133")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go s.ServeListener(l)
+
+	if _, err := test_dial("127.0.0.1:11133", stranger); err == nil {
+		t.Errorf("Dial expect:auth error, get:nil")
+	}
+
+	c, err := test_dial("127.0.0.1:11133", bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	f, err := c.Create("/bob/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("hello"))
+	f.Close()
+
+	f, err = c.Open("/bob/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(f)
+	f.Close()
+	if string(b) != "hello" {
+		t.Errorf("Read expect:hello, get:%s", b)
+	}
+
+	if err := c.Mkdir("/bob/d"); err != nil {
+		t.Errorf("Mkdir expect:nil, get:%v", err)
+	}
+	if err := c.Chmod("/bob/a.txt", 0600); err != nil {
+		t.Errorf("Chmod expect:nil, get:%v", err)
+	}
+	if err := c.Truncate("/bob/a.txt", 2); err != nil {
+		t.Errorf("Truncate expect:nil, get:%v", err)
+	}
+	if fi, err := c.Stat("/bob/a.txt"); err != nil || fi.Size() != 2 || fi.Mode().Perm() != 0600 {
+		t.Errorf("Stat expect:2 -rw-------, get:%v %v", fi, err)
+	}
+
+	fis, err := c.ReadDir("/bob")
+	var names []string
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+	if s := strings.Join(names, ","); err != nil || s != "a.txt,d" {
+		t.Errorf("ReadDir expect:a.txt,d, get:%s %v", s, err)
+	}
+
+	//rename 不覆盖已有文件，PosixRename 覆盖
+	if err := c.Rename("/bob/a.txt", "/bob/d"); err == nil {
+		t.Errorf("Rename expect:error, get:nil")
+	}
+	if err := c.Rename("/bob/a.txt", "/bob/d/b.txt"); err != nil {
+		t.Errorf("Rename expect:nil, get:%v", err)
+	}
+	if _, err := fs.Stat("/bob/d/b.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+
+	if err := c.RemoveDirectory("/bob/d"); err == nil {
+		t.Errorf("RemoveDirectory expect:not empty, get:nil")
+	}
+	if err := c.Remove("/bob/d/b.txt"); err != nil {
+		t.Errorf("Remove expect:nil, get:%v", err)
+	}
+	if err := c.RemoveDirectory("/bob/d"); err != nil {
+		t.Errorf("RemoveDirectory expect:nil, get:%v", err)
+	}
+	if _, err := c.Stat("/bob/none"); !os.IsNotExist(err) {
+		t.Errorf("Stat expect:not exist, get:%v", err)
+	}
+
+	if len(principals) != 1 || principals[0] != "bob" {
+		t.Errorf("Principal expect:bob, get:%v", principals)
+	}
+}
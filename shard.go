@@ -0,0 +1,559 @@
+package netfs
+
+import (
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//按一致性哈希把内容分布到多个文件系统
+//
+//默认以第一级名称为键，其下的全部内容在同一个分片上；WholePath 时以完整路径为键，
+//文件分散到各分片，目录则在每个分片上都存在。根目录(WholePath 时为所有目录)的列表合并各分片的内容。
+//不同分片之间的 Rename 返回 EXDEV。Add 新分片后，归属改变的内容需 Rebalance 移到新的分片上才能访问。
+type ShardFs struct {
+	WholePath    bool
+	VirtualNodes int //每个分片在哈希环上的点数，Add 前设置，至少为 1
+
+	rw     sync.RWMutex //普通操作共享，Add 与 Rebalance 独占
+	shards []shard
+	ring   []shardPoint
+}
+
+type shard struct {
+	name string
+	fs   FileSystem
+}
+
+type shardPoint struct {
+	hash  uint32
+	index int
+}
+
+//Rebalance 中移动的一项
+type ShardMove struct {
+	Path string
+	From string
+	To   string
+}
+
+var ErrNoShard = errors.New("netfs: no shard")
+
+func (s *ShardFs) Init() *ShardFs {
+	s.VirtualNodes = 64
+	return s
+}
+
+//加入一个分片，name 决定它在哈希环上的位置，需保持不变
+func (s *ShardFs) Add(name string, fs FileSystem) *ShardFs {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	s.shards = append(s.shards, shard{name: name, fs: fs})
+	index := len(s.shards) - 1
+	n := s.VirtualNodes
+	if n < 1 {
+		n = 1
+	}
+	for v := 0; v < n; v++ {
+		h := crc32.ChecksumIEEE([]byte(name + "#" + strconv.Itoa(v)))
+		s.ring = append(s.ring, shardPoint{hash: h, index: index})
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	return s
+}
+
+//路径的哈希键
+func (s *ShardFs) key(p string) string {
+	if s.WholePath {
+		return p
+	}
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		p = p[:i]
+	}
+	return p
+}
+
+//负责 p 的分片序号
+func (s *ShardFs) owner(p string) int {
+	h := crc32.ChecksumIEEE([]byte(s.key(p)))
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].index
+}
+
+//找到负责 name 的文件系统，调用者需持有读锁
+func (s *ShardFs) route(op, name string) (FileSystem, string, error) {
+	p := path.Clean("/" + name)
+	if len(s.ring) == 0 {
+		return nil, p, &os.PathError{Op: op, Path: name, Err: ErrNoShard}
+	}
+	return s.shards[s.owner(p)].fs, p, nil
+}
+
+//p 是否在每个分片上都存在：根目录，WholePath 时还有所有目录
+func (s *ShardFs) spread(fs FileSystem, p string) bool {
+	if p == "/" {
+		return true
+	}
+	if !s.WholePath {
+		return false
+	}
+	fi, err := fs.Lstat(p)
+	return err == nil && fi.IsDir()
+}
+
+//在所有分片上执行，fs 最后执行，它的结果决定成败；其它分片上的错误由 ignore 过滤，为 nil 时不过滤
+func (s *ShardFs) all(fs FileSystem, fn func(fs FileSystem) error, ignore func(err error) bool) error {
+	for _, sh := range s.shards {
+		if sh.fs == fs {
+			continue
+		}
+		if err := fn(sh.fs); err != nil && (ignore == nil || !ignore(err)) {
+			return err
+		}
+	}
+	return fn(fs)
+}
+
+//在负责 name 的分片上执行，spread 的路径在所有分片上执行
+func (s *ShardFs) apply(op, name string, fn func(fs FileSystem, p string) error) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route(op, name)
+	if err != nil {
+		return err
+	}
+	if s.spread(fs, p) {
+		return s.all(fs, func(fs FileSystem) error {
+			return fn(fs, p)
+		}, os.IsNotExist)
+	}
+	return fn(fs, p)
+}
+
+func (s *ShardFs) Chmod(name string, mode os.FileMode) error {
+	return s.apply("chmod", name, func(fs FileSystem, p string) error {
+		return fs.Chmod(p, mode)
+	})
+}
+
+func (s *ShardFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return s.apply("chtimes", name, func(fs FileSystem, p string) error {
+		return fs.Chtimes(p, atime, mtime)
+	})
+}
+
+func (s *ShardFs) Mkdir(name string, perm os.FileMode) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("mkdir", name)
+	if err != nil {
+		return err
+	}
+	if err := fs.Mkdir(p, perm); err != nil || !s.WholePath {
+		return err
+	}
+
+	//其它分片上补全目录
+	for _, sh := range s.shards {
+		if sh.fs != fs {
+			if err := sh.fs.MkdirAll(p, perm); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *ShardFs) MkdirAll(pathName string, perm os.FileMode) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("mkdir", pathName)
+	if err != nil {
+		return err
+	}
+	if !s.WholePath {
+		return fs.MkdirAll(p, perm)
+	}
+	return s.all(fs, func(fs FileSystem) error {
+		return fs.MkdirAll(p, perm)
+	}, nil)
+}
+
+func (s *ShardFs) Remove(name string) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("remove", name)
+	if err != nil {
+		return err
+	}
+	if s.spread(fs, p) {
+		return s.removeSpread(fs, p, false)
+	}
+	return fs.Remove(p)
+}
+
+func (s *ShardFs) RemoveAll(pathName string) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("removeall", pathName)
+	if err != nil {
+		return err
+	}
+	if s.spread(fs, p) {
+		return s.removeSpread(fs, p, true)
+	}
+	if s.WholePath {
+		return s.all(fs, func(fs FileSystem) error {
+			return fs.RemoveAll(p)
+		}, nil)
+	}
+	return fs.RemoveAll(p)
+}
+
+//删除在所有分片上都存在的目录，先检查(all 时先清空)每个分片上的内容，
+//全部为空后才删除目录本身，失败时目录仍在所有分片上
+func (s *ShardFs) removeSpread(fs FileSystem, p string, all bool) error {
+	for _, sh := range s.shards {
+		names, err := readdirnames(sh.fs, p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(names) > 0 && !all {
+			return &os.PathError{Op: "remove", Path: p, Err: syscall.ENOTEMPTY}
+		}
+		for _, name := range names {
+			if err := sh.fs.RemoveAll(path.Join(p, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return s.all(fs, func(fs FileSystem) error {
+		return fs.Remove(p)
+	}, os.IsNotExist)
+}
+
+func (s *ShardFs) Rename(oldpath, newpath string) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	src, op, err := s.route("rename", oldpath)
+	if err != nil {
+		return err
+	}
+	dst, np, _ := s.route("rename", newpath)
+
+	//WholePath 时目录下的文件按路径分布，改名后归属会变化
+	if src != dst || s.spread(src, op) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	return src.Rename(op, np)
+}
+
+func (s *ShardFs) Truncate(name string, size int64) error {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("truncate", name)
+	if err != nil {
+		return err
+	}
+	return fs.Truncate(p, size)
+}
+
+func (s *ShardFs) Create(name string) (file File, err error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+func (s *ShardFs) Open(name string) (file File, err error) {
+	return s.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (s *ShardFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !isWriteFlag(flag) && s.spread(fs, p) {
+		if _, err := fs.Stat(p); err != nil {
+			return nil, err
+		}
+		return &shardDir{fs: s, name: name, path: p}, nil
+	}
+	return fs.OpenFile(p, flag, perm)
+}
+
+func (s *ShardFs) Stat(name string) (fi os.FileInfo, err error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(p)
+}
+
+func (s *ShardFs) Lstat(name string) (fi os.FileInfo, err error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	fs, p, err := s.route("lstat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Lstat(p)
+}
+
+//合并各分片上的目录列表，缺少该目录的分片跳过
+//同名的项在多个分片上时(如未 Rebalance)，取负责该路径的分片上的
+func (s *ShardFs) readdir(p string) ([]os.FileInfo, error) {
+	s.rw.RLock()
+	defer s.rw.RUnlock()
+
+	seen := make(map[string]int)
+	var list []os.FileInfo
+
+	for i, sh := range s.shards {
+		f, err := sh.fs.Open(p)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fis, err := f.Readdir(-1)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, fi := range fis {
+			if k, ok := seen[fi.Name()]; !ok {
+				seen[fi.Name()] = len(list)
+				list = append(list, fi)
+			} else if s.owner(path.Join(p, fi.Name())) == i {
+				list[k] = fi
+			}
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// ----- 重新分布 -----
+
+//把归属与所在分片不符的内容移到负责的分片上，dryRun 时只返回需要移动的项
+//执行期间其它操作等待
+func (s *ShardFs) Rebalance(dryRun bool) ([]ShardMove, error) {
+	s.rw.Lock()
+	defer s.rw.Unlock()
+
+	var moves []ShardMove
+	for i := range s.shards {
+		if err := s.rebalance(i, "/", dryRun, &moves); err != nil {
+			return moves, err
+		}
+	}
+	return moves, nil
+}
+
+func (s *ShardFs) rebalance(i int, dir string, dryRun bool, moves *[]ShardMove) error {
+	src := s.shards[i].fs
+	names, err := readdirnames(src, dir)
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		p := path.Join(dir, name)
+
+		if s.WholePath {
+			fi, err := src.Lstat(p)
+			if err != nil {
+				return err
+			}
+			//目录在所有分片上补全后继续检查其中的文件
+			if fi.IsDir() {
+				if !dryRun {
+					for _, sh := range s.shards {
+						if err := sh.fs.MkdirAll(p, fi.Mode().Perm()); err != nil {
+							return err
+						}
+					}
+				}
+				if err := s.rebalance(i, p, dryRun, moves); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		j := s.owner(p)
+		if j == i {
+			continue
+		}
+		*moves = append(*moves, ShardMove{Path: p, From: s.shards[i].name, To: s.shards[j].name})
+		if dryRun {
+			continue
+		}
+		if err := shardMove(src, s.shards[j].fs, p); err != nil {
+			return err
+		}
+		if err := src.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//把 p 复制到 dst，dst 上已有的文件是 Add 之后写入的，较新，不覆盖
+func shardMove(src, dst FileSystem, p string) error {
+	dfi, err := dst.Lstat(p)
+	if os.IsNotExist(err) {
+		return copyTree(src, dst, p)
+	}
+	if err != nil {
+		return err
+	}
+
+	sfi, err := src.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if !sfi.IsDir() || !dfi.IsDir() {
+		return nil
+	}
+
+	names, err := readdirnames(src, p)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := shardMove(src, dst, path.Join(p, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ----- 合并的目录 -----
+
+type shardDir struct {
+	fs   *ShardFs
+	name string
+	path string
+	list []os.FileInfo
+	read bool
+}
+
+func (d *shardDir) err(op string, err error) error {
+	return &os.PathError{Op: op, Path: d.name, Err: err}
+}
+
+func (d *shardDir) Chmod(mode os.FileMode) error {
+	return d.fs.Chmod(d.path, mode)
+}
+
+func (d *shardDir) Close() error {
+	d.list = nil
+	return nil
+}
+
+func (d *shardDir) Name() string {
+	return d.name
+}
+
+func (d *shardDir) Read(b []byte) (n int, err error) {
+	return 0, d.err("read", syscall.EISDIR)
+}
+
+func (d *shardDir) ReadAt(b []byte, off int64) (n int, err error) {
+	return 0, d.err("read", syscall.EISDIR)
+}
+
+func (d *shardDir) Readdir(n int) (fi []os.FileInfo, err error) {
+	if !d.read {
+		d.list, err = d.fs.readdir(d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.read = true
+	}
+
+	if n > 0 && len(d.list) == 0 {
+		return nil, io.EOF
+	}
+	if n <= 0 || n > len(d.list) {
+		n = len(d.list)
+	}
+
+	fi = d.list[:n]
+	d.list = d.list[n:]
+	return
+}
+
+func (d *shardDir) Readdirnames(n int) (names []string, err error) {
+	fis, err := d.Readdir(n)
+	for _, fi := range fis {
+		names = append(names, fi.Name())
+	}
+	return
+}
+
+func (d *shardDir) Seek(offset int64, whence int) (ret int64, err error) {
+	if offset != 0 || whence != io.SeekStart {
+		return 0, d.err("seek", syscall.EINVAL)
+	}
+	d.list = nil
+	d.read = false
+	return 0, nil
+}
+
+func (d *shardDir) Stat() (fi os.FileInfo, err error) {
+	return d.fs.Stat(d.path)
+}
+
+func (d *shardDir) Sync() (err error) {
+	return nil
+}
+
+func (d *shardDir) Truncate(size int64) error {
+	return d.err("truncate", syscall.EISDIR)
+}
+
+func (d *shardDir) Write(b []byte) (n int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
+
+func (d *shardDir) WriteAt(b []byte, off int64) (n int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
+
+func (d *shardDir) WriteString(s string) (ret int, err error) {
+	return 0, d.err("write", syscall.EISDIR)
+}
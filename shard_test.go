@@ -0,0 +1,238 @@
+package netfs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+//含有 name 的分片
+func test_shard_of(fs *ShardFs, name string) []string {
+	var names []string
+	for _, sh := range fs.shards {
+		if _, err := sh.fs.Lstat(name); err == nil {
+			names = append(names, sh.name)
+		}
+	}
+	return names
+}
+
+func Test_ShardFs(t *testing.T) {
+	fs := new(ShardFs).Init().
+		Add("s0", new(MemFs).Init()).
+		Add("s1", new(MemFs).Init()).
+		Add("s2", new(MemFs).Init())
+
+	var keys []string
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("k%02d", i)
+		keys = append(keys, key)
+		if err := fs.Mkdir(key, 0755); err != nil {
+			t.Fatal(err)
+		}
+		test_write_file(t, fs, key+"/f", key)
+	}
+
+	//第一级名称下的内容在同一个分片上
+	used := make(map[string]bool)
+	for _, key := range keys {
+		a, b := test_shard_of(fs, key), test_shard_of(fs, key+"/f")
+		if len(a) != 1 || fmt.Sprint(a) != fmt.Sprint(b) {
+			t.Errorf("Shard %s expect:one, get:%v %v", key, a, b)
+		}
+		used[fmt.Sprint(a)] = true
+	}
+	if len(used) != 3 {
+		t.Errorf("Shards used expect:3, get:%d", len(used))
+	}
+	if s := test_list_dir(fs, "/"); s != strings.Join(keys, ",") {
+		t.Errorf("List expect:%s, get:%s", strings.Join(keys, ","), s)
+	}
+
+	if err := fs.Rename("k00/f", "k00/g"); err != nil || test_read_file(fs, "k00/g") != "k00" {
+		t.Errorf("Rename expect:nil, get:%v", err)
+	}
+	for _, key := range keys[1:] {
+		if fs.owner("/"+key+"x") != fs.owner("/k00") {
+			err := fs.Rename("k00", key+"x")
+			if e, ok := err.(*os.LinkError); !ok || e.Err != syscall.EXDEV {
+				t.Errorf("Rename expect:EXDEV, get:%v", err)
+			}
+			break
+		}
+	}
+
+	//加入分片后只有移到新分片的内容
+	fs.Add("s3", new(MemFs).Init())
+	moves, err := fs.Rebalance(true)
+	if err != nil || len(moves) == 0 {
+		t.Fatalf("Rebalance expect:moves, get:%v %v", moves, err)
+	}
+	var moved []string
+	for _, m := range moves {
+		if m.To != "s3" {
+			t.Errorf("Move expect:s3, get:%v", m)
+		}
+		moved = append(moved, strings.TrimPrefix(m.Path, "/"))
+	}
+	if s := test_list_dir(fs.shards[3].fs, "/"); s != "" {
+		t.Errorf("Dry run expect:empty, get:%s", s)
+	}
+
+	if again, err := fs.Rebalance(false); err != nil || fmt.Sprint(again) != fmt.Sprint(moves) {
+		t.Errorf("Rebalance expect:%v, get:%v %v", moves, again, err)
+	}
+	if s := test_list_dir(fs.shards[3].fs, "/"); s != strings.Join(moved, ",") {
+		t.Errorf("List s3 expect:%s, get:%s", strings.Join(moved, ","), s)
+	}
+	for _, key := range keys[1:] {
+		if s := test_read_file(fs, key+"/f"); s != key {
+			t.Errorf("Read %s expect:%s, get:%s", key, key, s)
+		}
+		if a := test_shard_of(fs, key); len(a) != 1 {
+			t.Errorf("Shard %s expect:one, get:%v", key, a)
+		}
+	}
+	if moves, _ := fs.Rebalance(true); len(moves) != 0 {
+		t.Errorf("Rebalance expect:none, get:%v", moves)
+	}
+}
+
+func Test_ShardFs_WholePath(t *testing.T) {
+	fs := new(ShardFs).Init()
+	fs.WholePath = true
+	fs.Add("s0", new(MemFs).Init()).Add("s1", new(MemFs).Init())
+
+	if err := fs.MkdirAll("a/b", 0755); err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("f%d", i)
+		files = append(files, name)
+		test_write_file(t, fs, "a/b/"+name, name)
+	}
+
+	//目录在每个分片上，文件只在一个分片上
+	if a := test_shard_of(fs, "a/b"); len(a) != 2 {
+		t.Errorf("Dir expect:all shards, get:%v", a)
+	}
+	used := make(map[string]bool)
+	for _, name := range files {
+		a := test_shard_of(fs, "a/b/"+name)
+		if len(a) != 1 {
+			t.Errorf("File %s expect:one, get:%v", name, a)
+		}
+		used[fmt.Sprint(a)] = true
+	}
+	if len(used) != 2 {
+		t.Errorf("Shards used expect:2, get:%d", len(used))
+	}
+	if s := test_list_dir(fs, "a/b"); s != strings.Join(files, ",") {
+		t.Errorf("List expect:%s, get:%s", strings.Join(files, ","), s)
+	}
+	if err := fs.Rename("a/b", "a/c"); err == nil {
+		t.Error("Rename dir expect:EXDEV, get:nil")
+	}
+	if err := fs.Remove("a/b"); err == nil {
+		t.Error("Remove expect:not empty, get:nil")
+	}
+	//失败时不能已在其它分片上删除
+	if a := test_shard_of(fs, "a/b"); len(a) != 2 {
+		t.Errorf("Remove failed expect:all shards, get:%v", a)
+	}
+
+	fs.Add("s2", new(MemFs).Init())
+	if _, err := fs.Rebalance(false); err != nil {
+		t.Fatal(err)
+	}
+	if a := test_shard_of(fs, "a/b"); len(a) != 3 {
+		t.Errorf("Dir expect:all shards, get:%v", a)
+	}
+	for _, name := range files {
+		if s := test_read_file(fs, "a/b/"+name); s != name {
+			t.Errorf("Read expect:%s, get:%s", name, s)
+		}
+	}
+
+	if err := fs.RemoveAll("a"); err != nil {
+		t.Fatal(err)
+	}
+	if a := test_shard_of(fs, "a"); len(a) != 0 {
+		t.Errorf("RemoveAll expect:none, get:%v", a)
+	}
+}
+
+func Test_ShardFs_Edge(t *testing.T) {
+	if _, err := new(ShardFs).Init().Stat("a"); err == nil || !strings.Contains(err.Error(), ErrNoShard.Error()) {
+		t.Errorf("Stat expect:%v, get:%v", ErrNoShard, err)
+	}
+
+	//VirtualNodes 为 0 时每个分片仍有一个点
+	fs := new(ShardFs)
+	fs.Add("s0", test_mem_fs(t, "a.txt"))
+	if _, err := fs.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+
+	//同名文件在两个分片上时，列表取负责它的分片上的
+	s0 := test_mem_fs(t, "x.txt")
+	s1 := new(MemFs).Init()
+	test_write_file(t, s1, "x.txt", "longer x.txt")
+
+	//两种加入顺序，总有一种需要替换先读到的项
+	for _, order := range [][]string{{"s0", "s1"}, {"s1", "s0"}} {
+		mems := map[string]*MemFs{"s0": s0, "s1": s1}
+		fs = new(ShardFs).Init().Add(order[0], mems[order[0]]).Add(order[1], mems[order[1]])
+		size := map[string]int64{"s0": 5, "s1": 12}[fs.shards[fs.owner("/x.txt")].name]
+
+		f, err := fs.Open("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fis, err := f.Readdir(-1)
+		f.Close()
+		if err != nil || len(fis) != 1 || fis[0].Size() != size {
+			t.Errorf("Readdir expect:x.txt %d, get:%v %v", size, fis, err)
+		}
+	}
+}
+
+//RemoveAll 指定路径时失败
+type test_noremove_fs struct {
+	FileSystem
+	name string
+}
+
+func (fs test_noremove_fs) RemoveAll(p string) error {
+	if p == fs.name {
+		return &os.PathError{Op: "removeall", Path: p, Err: syscall.EACCES}
+	}
+	return fs.FileSystem.RemoveAll(p)
+}
+
+func Test_ShardFs_RemoveAll(t *testing.T) {
+	fs := new(ShardFs).Init()
+	fs.WholePath = true
+	for i := 0; i < 3; i++ {
+		fs.Add(fmt.Sprintf("s%d", i), test_noremove_fs{new(MemFs).Init(), "/a/f1"})
+	}
+
+	fs.MkdirAll("a", 0755)
+	for i := 0; i < 5; i++ {
+		test_write_file(t, fs, fmt.Sprintf("a/f%d", i), "x")
+	}
+
+	//任一分片失败时目录仍在所有分片上
+	if err := fs.RemoveAll("a"); !os.IsPermission(err) {
+		t.Errorf("RemoveAll expect:permission, get:%v", err)
+	}
+	if a := test_shard_of(fs, "a"); len(a) != 3 {
+		t.Errorf("RemoveAll failed expect:all shards, get:%v", a)
+	}
+	if s := test_list_dir(fs, "a"); !strings.Contains(s, "f1") {
+		t.Errorf("List expect:f1, get:%s", s)
+	}
+}
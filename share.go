@@ -0,0 +1,414 @@
+package netfs
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//共享目录
+type Share struct {
+	Name     string
+	Fs       FileSystem
+	ReadOnly bool
+
+	//访问控制，principal 为认证后的用户名(未认证时为空)，为 nil 时允许所有连接
+	Allow func(principal string, addr net.Addr) bool
+
+	//存储配额，为 nil 时不限制
+	Quota *Quota
+
+	fs FileSystem
+}
+
+func (s *Share) allowed(principal string, addr net.Addr) bool {
+	return s.Allow == nil || s.Allow(principal, addr)
+}
+
+//同时提供多个共享目录的服务端
+//名称为空的共享目录是连接后的默认目录，客户端可通过 DialShare 或 Client.Share 选择其它目录
+type Exports struct {
+	//用户认证，为 nil 时不支持认证
+	Auth func(principal, secret string) bool
+
+	//运行指标，为 nil 时使用 DefaultMetrics
+	Metrics Metrics
+
+	//日志，为 nil 时使用 Logger
+	Logger Log
+
+	//审计所有修改操作，为 nil 时不记录
+	Audit Auditor
+
+	//限速，为 nil 时不限制
+	RateLimits *RateLimits
+
+	mu           sync.RWMutex
+	shares       map[string]*Share
+	interceptors []Interceptor
+
+	listeners map[net.Listener]bool
+	sessions  map[*Server]bool
+	closing   bool
+}
+
+func (e *Exports) Init() *Exports {
+	e.shares = make(map[string]*Share)
+	e.listeners = make(map[net.Listener]bool)
+	e.sessions = make(map[*Server]bool)
+	return e
+}
+
+func (e *Exports) Add(s *Share) *Exports {
+	fs := s.Fs
+	if fs == nil {
+		fs = new(LocalFs).Init("./")
+	}
+	//同一共享目录的所有连接共享同一个事件源
+	if _, ok := fs.(WatchFs); !ok {
+		fs = new(NotifyFs).Init(fs)
+	}
+	if s.ReadOnly {
+		fs = ReadOnly(fs)
+	}
+	s.fs = fs
+
+	if s.Quota != nil {
+		if err := s.Quota.init(fs); err != nil {
+			e.log().Warn("quota scan failed", "share", s.Name, "error", err)
+		}
+	}
+
+	e.mu.Lock()
+	e.shares[s.Name] = s
+	e.mu.Unlock()
+	return e
+}
+
+func (e *Exports) Remove(name string) {
+	e.mu.Lock()
+	delete(e.shares, name)
+	e.mu.Unlock()
+}
+
+func (e *Exports) Get(name string) *Share {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.shares[name]
+}
+
+func (e *Exports) Listen(addr string) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		e.log().Error("listen failed", "addr", addr, "error", err)
+		return
+	}
+
+	if err := e.ServeListener(ln); err != nil {
+		e.log().Error("accept failed", "addr", addr, "error", err)
+	}
+}
+
+//在 l 上接受连接，直到 l 被关闭或调用 Shutdown，此时返回 nil
+func (e *Exports) ServeListener(l net.Listener) error {
+	e.mu.Lock()
+	if e.closing {
+		e.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	e.listeners[l] = true
+	e.mu.Unlock()
+
+	defer func() {
+		e.mu.Lock()
+		delete(e.listeners, l)
+		e.mu.Unlock()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			e.mu.RLock()
+			closing := e.closing
+			e.mu.RUnlock()
+
+			if closing || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+
+		go e.Serve(conn)
+	}
+}
+
+//停止接受新连接，等待进行中的请求完成后关闭所有会话，超过 timeout 时强制关闭
+func (e *Exports) Shutdown(timeout time.Duration) error {
+	e.mu.Lock()
+	e.closing = true
+	for l := range e.listeners {
+		l.Close()
+	}
+	e.mu.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	var err error
+
+	for {
+		expired := time.Now().After(deadline)
+
+		e.mu.RLock()
+		n := len(e.sessions)
+		for c := range e.sessions {
+			if expired || atomic.LoadInt32(&c.busy) == 0 {
+				c.conn.conn.Close()
+			}
+		}
+		e.mu.RUnlock()
+
+		if n == 0 {
+			return err
+		}
+		if expired {
+			err = errors.New("Shutdown Timeout")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (e *Exports) track(c *Server) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.closing {
+		return false
+	}
+	e.sessions[c] = true
+	return true
+}
+
+func (e *Exports) untrack(c *Server) {
+	e.mu.Lock()
+	delete(e.sessions, c)
+	e.mu.Unlock()
+}
+
+func (e *Exports) log() Log {
+	if e.Logger != nil {
+		return e.Logger
+	}
+	return getLog()
+}
+
+func (e *Exports) Serve(conn net.Conn) {
+	runRev(conn, e, nil)
+}
+
+// ----- 认证 -----
+
+func (c *Client) Auth(principal, secret string) (err error) {
+	defer onPanic(&err)
+
+	c.doRequest(LINK_AUTH)
+	c.writeString(principal)
+	c.writeString(secret)
+
+	c.waitResponse(LINK_AUTH)
+	if err = c.readError(); err == nil {
+		c.principal = principal
+		c.secret = secret
+	}
+	return
+}
+
+func (c *Server) link_auth() {
+	principal := c.readString()
+	secret := c.readString()
+
+	call := c.intercept(LINK_AUTH, principal, []interface{}{principal, secret}, func(call *Call) {
+		if c.exports == nil || c.exports.Auth == nil {
+			call.Err = errors.New("Auth Not Supported")
+		} else if !c.exports.Auth(principal, secret) {
+			call.Err = &os.PathError{Op: "auth", Path: principal, Err: os.ErrPermission}
+		} else {
+			c.principal = principal
+			//按新用户重新选择当前目录(未选择时为默认目录)，以重新计算权限与配额
+			s := c.share
+			if s == nil {
+				s = c.exports.Get("")
+			}
+			if !c.setShare(s) {
+				c.share = nil
+				c.fs = noShare(s)
+			}
+		}
+	})
+
+	c.doResponse(LINK_AUTH)
+	c.writeError(call.Err)
+}
+
+// ----- 选择共享目录 -----
+
+func DialShare(addr, name string) (*Client, error) {
+	c, err := Dial(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.selectShare(name); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+//通过新连接访问同一服务端的另一个共享目录，沿用当前的认证信息
+func (c *Client) Share(name string) (*Client, error) {
+	nc, err := c.redial()
+	if err != nil {
+		return nil, err
+	}
+
+	s := new(Client)
+	s.conn = *nc
+	s.dial = c.dial
+	s.Metrics = c.Metrics
+	s.principal = c.principal
+	s.secret = c.secret
+
+	if err := s.selectShare(name); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (c *Client) selectShare(name string) (err error) {
+	defer onPanic(&err)
+
+	c.doRequest(LINK_SHARE)
+	c.writeString(name)
+
+	c.waitResponse(LINK_SHARE)
+	if err = c.readError(); err == nil {
+		c.share = name
+	}
+	return
+}
+
+func (c *Server) link_share() {
+	name := c.readString()
+
+	call := c.intercept(LINK_SHARE, name, []interface{}{name}, func(call *Call) {
+		var s *Share
+		if c.exports != nil {
+			s = c.exports.Get(name)
+		}
+
+		if s == nil {
+			call.Err = &os.PathError{Op: "share", Path: name, Err: os.ErrNotExist}
+		} else if !c.setShare(s) {
+			call.Err = &os.PathError{Op: "share", Path: name, Err: os.ErrPermission}
+		}
+	})
+
+	c.doResponse(LINK_SHARE)
+	c.writeError(call.Err)
+}
+
+//切换当前共享目录
+func (c *Server) setShare(s *Share) bool {
+	if s == nil || !s.allowed(c.principal, c.conn.conn.RemoteAddr()) {
+		return false
+	}
+
+	c.share = s
+	c.fs = s.fs
+	if s.Quota != nil {
+		c.fs = s.Quota.view(c.principal, c.fs)
+	}
+	if c.exports.Audit != nil {
+		c.fs = c.audited(c.exports.Audit, c.fs)
+	}
+	c.fs = c.intercepted(c.fs)
+	return true
+}
+
+//未选择共享目录时的文件系统，所有操作返回错误
+//默认目录不存在时为 ENOENT，无权访问时为 EACCES
+type noShareFs struct {
+	err error
+}
+
+func noShare(s *Share) FileSystem {
+	if s == nil {
+		return &noShareFs{syscall.ENOENT}
+	}
+	return &noShareFs{syscall.EACCES}
+}
+
+func (n *noShareFs) fail(op, name string) error {
+	return &os.PathError{Op: op, Path: name, Err: n.err}
+}
+
+func (n *noShareFs) Chmod(name string, mode os.FileMode) error {
+	return n.fail("chmod", name)
+}
+
+func (n *noShareFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return n.fail("chtimes", name)
+}
+
+func (n *noShareFs) Mkdir(name string, perm os.FileMode) error {
+	return n.fail("mkdir", name)
+}
+
+func (n *noShareFs) MkdirAll(path string, perm os.FileMode) error {
+	return n.fail("mkdir", path)
+}
+
+func (n *noShareFs) Remove(name string) error {
+	return n.fail("remove", name)
+}
+
+func (n *noShareFs) RemoveAll(path string) error {
+	return n.fail("removeall", path)
+}
+
+func (n *noShareFs) Rename(oldpath, newpath string) error {
+	return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: n.err}
+}
+
+func (n *noShareFs) Truncate(name string, size int64) error {
+	return n.fail("truncate", name)
+}
+
+func (n *noShareFs) Create(name string) (file File, err error) {
+	return nil, n.fail("open", name)
+}
+
+func (n *noShareFs) Open(name string) (file File, err error) {
+	return nil, n.fail("open", name)
+}
+
+func (n *noShareFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	return nil, n.fail("open", name)
+}
+
+func (n *noShareFs) Stat(name string) (fi os.FileInfo, err error) {
+	return nil, n.fail("stat", name)
+}
+
+func (n *noShareFs) Lstat(name string) (fi os.FileInfo, err error) {
+	return nil, n.fail("lstat", name)
+}
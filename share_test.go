@@ -0,0 +1,267 @@
+package netfs
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func Test_Exports(t *testing.T) {
+	logs := test_mem_fs(t, "app.log")
+	scratch := test_mem_fs(t)
+	private := test_mem_fs(t, "secret.txt")
+
+	exports := new(Exports).Init()
+	exports.Auth = func(principal, secret string) bool {
+		return principal == "bob" && secret == "123"
+	}
+	exports.Add(&Share{Fs: scratch})
+	exports.Add(&Share{Name: "logs", Fs: logs, ReadOnly: true})
+	exports.Add(&Share{Name: "private", Fs: private, Allow: func(principal string, addr net.Addr) bool {
+		return principal == "bob"
+	}})
+
+	go exports.Listen("127.0.0.1:11123")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	f, err := c.Create("tmp.txt")
+	if err != nil {
+		t.Fatalf("Create expect:nil, get:%v", err)
+	}
+	f.Close()
+
+	if _, err := scratch.Stat("tmp.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+
+	l, err := c.Share("logs")
+	if err != nil {
+		t.Fatalf("Share expect:nil, get:%v", err)
+	}
+	defer l.Close()
+
+	if s := test_read_file(l, "app.log"); s != "app.log" {
+		t.Errorf("Read expect:app.log, get:%s", s)
+	}
+
+	if e, ok := l.Remove("app.log").(*os.PathError); !ok || e.Err != syscall.EROFS {
+		t.Errorf("Remove expect:EROFS, get:%v", e)
+	}
+
+	if _, err := c.Share("private"); !os.IsPermission(err) {
+		t.Errorf("Share expect:permission denied, get:%v", err)
+	}
+
+	if _, err := c.Share("nothing"); !os.IsNotExist(err) {
+		t.Errorf("Share expect:not exist, get:%v", err)
+	}
+
+	if err := c.Auth("bob", "456"); !os.IsPermission(err) {
+		t.Errorf("Auth expect:permission denied, get:%v", err)
+	}
+
+	if err := c.Auth("bob", "123"); err != nil {
+		t.Fatalf("Auth expect:nil, get:%v", err)
+	}
+
+	p, err := c.Share("private")
+	if err != nil {
+		t.Fatalf("Share expect:nil, get:%v", err)
+	}
+	defer p.Close()
+
+	if s := test_read_file(p, "secret.txt"); s != "secret.txt" {
+		t.Errorf("Read expect:secret.txt, get:%s", s)
+	}
+
+	d, err := DialShare("127.0.0.1:11123", "logs")
+	if err != nil {
+		t.Fatalf("DialShare expect:nil, get:%v", err)
+	}
+	defer d.Close()
+
+	if _, err := d.Stat("app.log"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+}
+
+func Test_Exports_Shutdown(t *testing.T) {
+	exports := new(Exports).Init()
+	exports.Add(&Share{Fs: new(MemFs).Init()})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:11130")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- exports.ServeListener(ln)
+	}()
+
+	c, err := Dial("127.0.0.1:11130")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := exports.Shutdown(time.Second); err != nil {
+		t.Errorf("Shutdown expect:nil, get:%v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ServeListener expect:nil, get:%v", err)
+	}
+
+	//空闲会话已被关闭
+	if _, err := c.Stat("/"); err == nil {
+		t.Error("Stat expect:error, get:nil")
+	}
+	if _, err := Dial("127.0.0.1:11130"); err == nil {
+		t.Error("Dial expect:error, get:nil")
+	}
+}
+
+func Test_Exports_NoShare(t *testing.T) {
+	exports := new(Exports).Init()
+	exports.Auth = func(principal, secret string) bool {
+		return secret == "pw"
+	}
+	exports.Add(&Share{Fs: test_mem_fs(t, "a.txt"), Allow: func(principal string, addr net.Addr) bool {
+		return principal == "bob"
+	}})
+
+	go exports.Listen("127.0.0.1:11137")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11137")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	//无权访问默认目录时返回错误，连接保持可用
+	if _, err := c.Stat("a.txt"); !os.IsPermission(err) {
+		t.Errorf("Stat expect:permission denied, get:%v", err)
+	}
+	if err := c.Auth("bob", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+
+	//没有默认目录
+	exports.Remove("")
+
+	d, err := Dial("127.0.0.1:11137")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if _, err := d.Open("a.txt"); !os.IsNotExist(err) {
+		t.Errorf("Open expect:not exist, get:%v", err)
+	}
+	if err := d.Ping(); err != nil {
+		t.Errorf("Ping expect:nil, get:%v", err)
+	}
+}
+
+func Test_Exports_Escape(t *testing.T) {
+	local, clean := test_local_fs(t, "pub/a.txt", "home/h.txt", "secret/s.txt")
+	defer clean()
+
+	root := local.RootPath
+	exports := new(Exports).Init()
+	exports.Add(&Share{Fs: new(LocalFs).Init(filepath.Join(root, "pub")), ReadOnly: true})
+	exports.Add(&Share{Name: "home", Fs: new(LocalFs).Init(filepath.Join(root, "home"))})
+	exports.Add(&Share{Name: "secret", Fs: new(LocalFs).Init(filepath.Join(root, "secret")), Allow: func(principal string, addr net.Addr) bool {
+		return false
+	}})
+
+	go exports.Listen("127.0.0.1:11139")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11139")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Share("secret"); !os.IsPermission(err) {
+		t.Errorf("Share expect:permission denied, get:%v", err)
+	}
+
+	for _, name := range []string{"../secret/s.txt", "/../secret/s.txt", "a/../../secret/s.txt"} {
+		if _, err := c.Open(name); !os.IsNotExist(err) {
+			t.Errorf("Open %s expect:not exist, get:%v", name, err)
+		}
+	}
+
+	h, err := c.Share("home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	//写入与改名也不能越过共享目录
+	h.Mkdir("secret", 0755)
+	if f, err := h.Create("../secret/w.txt"); err == nil {
+		f.Close()
+	}
+	h.Rename("h.txt", "../secret/h.txt")
+
+	for _, name := range []string{"w.txt", "h.txt"} {
+		if _, err := os.Stat(filepath.Join(root, "secret", name)); !os.IsNotExist(err) {
+			t.Errorf("Stat secret/%s expect:not exist, get:%v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "home", "secret", "h.txt")); err != nil {
+		t.Errorf("Stat home/secret/h.txt expect:nil, get:%v", err)
+	}
+}
+
+func Test_Exports_AuthDenied(t *testing.T) {
+	exports := new(Exports).Init()
+	exports.Auth = func(principal, secret string) bool {
+		return secret == "pw"
+	}
+	exports.Add(&Share{Fs: test_mem_fs(t, "a.txt"), Allow: func(principal string, addr net.Addr) bool {
+		return principal != "bob"
+	}})
+
+	go exports.Listen("127.0.0.1:11142")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11142")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if _, err := c.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+
+	//认证后的用户无权访问当前目录时不再沿用之前的
+	if err := c.Auth("bob", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat("a.txt"); !os.IsPermission(err) {
+		t.Errorf("Stat expect:permission denied, get:%v", err)
+	}
+	if err := c.Auth("alice", "pw"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Stat("a.txt"); err != nil {
+		t.Errorf("Stat expect:nil, get:%v", err)
+	}
+}
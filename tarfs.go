@@ -0,0 +1,118 @@
+package netfs
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+//tar 归档上的只读文件系统，支持 gzip 压缩
+//
+//Init 时扫描一遍建立索引。未压缩归档中的普通文件按偏移随机读取，
+//压缩归档与稀疏文件需从头解压到该项，向回 Seek 时重新解压。
+type TarFs struct {
+	archiveFs
+}
+
+func (t *TarFs) Init(r io.ReaderAt, size int64) (*TarFs, error) {
+	var magic [2]byte
+	r.ReadAt(magic[:], 0)
+	gz := magic == [2]byte{0x1f, 0x8b}
+
+	//从头读取解压后的归档
+	stream := func() (io.Reader, error) {
+		sr := io.NewSectionReader(r, 0, size)
+		if gz {
+			return gzip.NewReader(sr)
+		}
+		return sr, nil
+	}
+
+	rd, err := stream()
+	if err != nil {
+		return nil, err
+	}
+	//未压缩时 SectionReader 可 Seek，扫描时跳过文件内容
+	sr, _ := rd.(io.Seeker)
+	tr := tar.NewReader(rd)
+
+	t.init()
+	for i := 0; ; i++ {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		e := &archiveEntry{info: &FileInfo{size: hdr.Size, mode: hdr.FileInfo().Mode(), modtime: hdr.ModTime}}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.info.size = 0
+		case tar.TypeSymlink:
+			e.link = hdr.Linkname
+			e.info.size = int64(len(hdr.Linkname))
+		case tar.TypeLink:
+			//硬链接指向之前的项
+			target, ok := t.entries[path.Clean("/"+hdr.Linkname)]
+			if !ok {
+				continue
+			}
+			e.info.size, e.info.mode = target.info.size, target.info.mode
+			e.ra, e.open = target.ra, target.open
+		case tar.TypeReg, '\x00', tar.TypeCont, tar.TypeGNUSparse: //'\x00' 为旧格式的普通文件
+			index := i
+			e.open = func() (io.ReadCloser, error) {
+				return tarSeek(stream, index)
+			}
+			if sr != nil && !tarSparse(hdr) {
+				off, err := sr.Seek(0, io.SeekCurrent)
+				if err != nil {
+					return nil, err
+				}
+				e.ra = io.NewSectionReader(r, off, hdr.Size)
+			}
+		default:
+			//设备、管道与全局扩展头
+			continue
+		}
+
+		t.add(hdr.Name, e)
+	}
+	return t, nil
+}
+
+func tarSparse(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for k := range hdr.PAXRecords {
+		if strings.HasPrefix(k, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+//重新读取归档，定位到第 index 项的内容
+func tarSeek(stream func() (io.Reader, error), index int) (io.ReadCloser, error) {
+	rd, err := stream()
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(rd)
+	for i := 0; i <= index; i++ {
+		if _, err := tr.Next(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return ioutil.NopCloser(tr), nil
+}
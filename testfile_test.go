@@ -64,7 +64,7 @@ func (f *testFile) Readdir(n int) (fi []os.FileInfo, err error) {
 	f.call = "readat"
 
 	if n != f.n {
-		f.t.Errorf("Readdirnames expect:%d give:%s", f.n, n)
+		f.t.Errorf("Readdirnames expect:%d give:%d", f.n, n)
 	}
 
 	return f.fis, f.err
@@ -74,7 +74,7 @@ func (f *testFile) Readdirnames(n int) (names []string, err error) {
 	f.call = "readdirnames"
 
 	if n != f.n {
-		f.t.Errorf("Readdirnames expect:%d give:%s", f.n, n)
+		f.t.Errorf("Readdirnames expect:%d give:%d", f.n, n)
 	}
 
 	return f.dirs, f.err
@@ -84,10 +84,10 @@ func (f *testFile) Seek(offset int64, whence int) (ret int64, err error) {
 	f.call = "seek"
 
 	if offset != f.offset {
-		f.t.Errorf("Seek expect:%d give:%s", f.offset, offset)
+		f.t.Errorf("Seek expect:%d give:%d", f.offset, offset)
 	}
 	if whence != f.whence {
-		f.t.Errorf("Seek expect:%d give:%s", f.whence, whence)
+		f.t.Errorf("Seek expect:%d give:%d", f.whence, whence)
 	}
 
 	return f.ret, f.err
@@ -109,7 +109,7 @@ func (f *testFile) Truncate(size int64) (err error) {
 	f.call = "truncate"
 
 	if size != f.size {
-		f.t.Errorf("Truncate expect:%d give:%s", f.size, size)
+		f.t.Errorf("Truncate expect:%d give:%d", f.size, size)
 	}
 
 	return f.err
@@ -132,7 +132,7 @@ func (f *testFile) WriteAt(b []byte, off int64) (n int, err error) {
 		f.t.Errorf("WriteAt expect:%s give:%s", string(f.b), string(b))
 	}
 	if off != f.off {
-		f.t.Errorf("WriteAt expect:%d give:%s", f.off, off)
+		f.t.Errorf("WriteAt expect:%d give:%d", f.off, off)
 	}
 
 	return f.n, f.err
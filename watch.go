@@ -0,0 +1,450 @@
+package netfs
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+type EventOp uint8
+
+const (
+	EVENT_CREATE EventOp = 1 << iota
+	EVENT_WRITE
+	EVENT_REMOVE
+	EVENT_RENAME
+	EVENT_CHMOD
+)
+
+//事件队列已满，有事件被丢弃
+var ErrEventOverflow = errors.New("netfs: event queue overflow")
+
+var WatchQueueSize = 256
+
+type Event struct {
+	Name string //以 "/" 开头的完整路径
+	Op   EventOp
+}
+
+func (op EventOp) String() string {
+	var s []string
+	names := []string{"CREATE", "WRITE", "REMOVE", "RENAME", "CHMOD"}
+	for i, name := range names {
+		if op&(1<<uint(i)) != 0 {
+			s = append(s, name)
+		}
+	}
+	return strings.Join(s, "|")
+}
+
+func (e Event) String() string {
+	return e.Op.String() + " " + e.Name
+}
+
+//支持变更通知的文件系统
+type WatchFs interface {
+	Watch(name string, recursive bool) (*Watcher, error)
+}
+
+//变更通知，Close 后 Events 与 Errors 会被关闭
+type Watcher struct {
+	Events chan Event
+	Errors chan error
+
+	once  sync.Once
+	done  chan struct{}
+	close func() error
+	err   error
+}
+
+func newWatcher(close func() error) *Watcher {
+	w := new(Watcher)
+	w.Events = make(chan Event, WatchQueueSize)
+	w.Errors = make(chan error, 1)
+	w.done = make(chan struct{})
+	w.close = close
+	return w
+}
+
+func (w *Watcher) Close() error {
+	w.once.Do(func() {
+		close(w.done)
+		w.err = w.close()
+	})
+	return w.err
+}
+
+//不阻塞发送，队列满时丢弃并报告溢出
+func (w *Watcher) send(ev Event) {
+	select {
+	case w.Events <- ev:
+	default:
+		w.sendError(ErrEventOverflow)
+	}
+}
+
+func (w *Watcher) sendError(err error) {
+	select {
+	case w.Errors <- err:
+	default:
+	}
+}
+
+func watchClean(name string) string {
+	return path.Clean("/" + name)
+}
+
+//事件路径是否在监视范围内，非递归时只包括自身及直接下级
+func watchMatch(p, name string, recursive bool) bool {
+	if name == p {
+		return true
+	}
+	if recursive {
+		return p == "/" || strings.HasPrefix(name, p+"/")
+	}
+	return path.Dir(name) == p
+}
+
+// ----- 通过本对象的修改产生事件 -----
+
+//为不支持变更通知的文件系统产生事件，只能感知经过本对象的修改
+type NotifyFs struct {
+	FileSystem
+
+	mu   sync.Mutex
+	subs map[*Watcher]notifySub
+}
+
+type notifySub struct {
+	path      string
+	recursive bool
+}
+
+func (n *NotifyFs) Init(fs FileSystem) *NotifyFs {
+	n.FileSystem = fs
+	n.subs = make(map[*Watcher]notifySub)
+	return n
+}
+
+func (n *NotifyFs) Watch(name string, recursive bool) (*Watcher, error) {
+	var w *Watcher
+	w = newWatcher(func() error {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+
+		delete(n.subs, w)
+		close(w.Events)
+		close(w.Errors)
+		return nil
+	})
+
+	n.mu.Lock()
+	n.subs[w] = notifySub{watchClean(name), recursive}
+	n.mu.Unlock()
+
+	return w, nil
+}
+
+func (n *NotifyFs) notify(err error, op EventOp, names ...string) {
+	if err != nil {
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for _, name := range names {
+		ev := Event{watchClean(name), op}
+		for w, sub := range n.subs {
+			if watchMatch(sub.path, ev.Name, sub.recursive) {
+				w.send(ev)
+			}
+		}
+	}
+}
+
+func (n *NotifyFs) Chmod(name string, mode os.FileMode) (err error) {
+	err = n.FileSystem.Chmod(name, mode)
+	n.notify(err, EVENT_CHMOD, name)
+	return
+}
+
+func (n *NotifyFs) Chtimes(name string, atime time.Time, mtime time.Time) (err error) {
+	err = n.FileSystem.Chtimes(name, atime, mtime)
+	n.notify(err, EVENT_CHMOD, name)
+	return
+}
+
+func (n *NotifyFs) Mkdir(name string, perm os.FileMode) (err error) {
+	err = n.FileSystem.Mkdir(name, perm)
+	n.notify(err, EVENT_CREATE, name)
+	return
+}
+
+func (n *NotifyFs) MkdirAll(p string, perm os.FileMode) (err error) {
+	if _, err := n.FileSystem.Stat(p); err == nil {
+		return n.FileSystem.MkdirAll(p, perm)
+	}
+
+	err = n.FileSystem.MkdirAll(p, perm)
+	n.notify(err, EVENT_CREATE, p)
+	return
+}
+
+func (n *NotifyFs) Remove(name string) (err error) {
+	err = n.FileSystem.Remove(name)
+	n.notify(err, EVENT_REMOVE, name)
+	return
+}
+
+func (n *NotifyFs) RemoveAll(p string) (err error) {
+	if _, err := n.FileSystem.Lstat(p); err != nil {
+		return n.FileSystem.RemoveAll(p)
+	}
+
+	err = n.FileSystem.RemoveAll(p)
+	n.notify(err, EVENT_REMOVE, p)
+	return
+}
+
+func (n *NotifyFs) Rename(oldpath, newpath string) (err error) {
+	err = n.FileSystem.Rename(oldpath, newpath)
+	n.notify(err, EVENT_RENAME, oldpath)
+	n.notify(err, EVENT_CREATE, newpath)
+	return
+}
+
+func (n *NotifyFs) Truncate(name string, size int64) (err error) {
+	err = n.FileSystem.Truncate(name, size)
+	n.notify(err, EVENT_WRITE, name)
+	return
+}
+
+func (n *NotifyFs) Create(name string) (file File, err error) {
+	_, serr := n.FileSystem.Lstat(name)
+
+	file, err = n.FileSystem.Create(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if serr != nil {
+		n.notify(nil, EVENT_CREATE, name)
+	} else {
+		n.notify(nil, EVENT_WRITE, name)
+	}
+
+	return &notifyFile{File: file, fs: n, name: name}, nil
+}
+
+func (n *NotifyFs) Open(name string) (file File, err error) {
+	return n.FileSystem.Open(name)
+}
+
+func (n *NotifyFs) OpenFile(name string, flag int, perm os.FileMode) (file File, err error) {
+	if !isWriteFlag(flag) {
+		return n.FileSystem.OpenFile(name, flag, perm)
+	}
+
+	_, serr := n.FileSystem.Lstat(name)
+
+	file, err = n.FileSystem.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if serr != nil {
+		n.notify(nil, EVENT_CREATE, name)
+	} else if flag&os.O_TRUNC != 0 {
+		n.notify(nil, EVENT_WRITE, name)
+	}
+
+	return &notifyFile{File: file, fs: n, name: name}, nil
+}
+
+type notifyFile struct {
+	File
+	fs   *NotifyFs
+	name string
+}
+
+func (f *notifyFile) Chmod(mode os.FileMode) (err error) {
+	err = f.File.Chmod(mode)
+	f.fs.notify(err, EVENT_CHMOD, f.name)
+	return
+}
+
+func (f *notifyFile) Truncate(size int64) (err error) {
+	err = f.File.Truncate(size)
+	f.fs.notify(err, EVENT_WRITE, f.name)
+	return
+}
+
+func (f *notifyFile) Write(b []byte) (n int, err error) {
+	n, err = f.File.Write(b)
+	f.fs.notify(err, EVENT_WRITE, f.name)
+	return
+}
+
+func (f *notifyFile) WriteAt(b []byte, off int64) (n int, err error) {
+	n, err = f.File.WriteAt(b, off)
+	f.fs.notify(err, EVENT_WRITE, f.name)
+	return
+}
+
+func (f *notifyFile) WriteString(s string) (ret int, err error) {
+	return f.Write([]byte(s))
+}
+
+func (f *notifyFile) Lock(typ LockType, off, length int64) error {
+	return fileLock(f.File, typ, off, length)
+}
+
+func (f *notifyFile) TryLock(typ LockType, off, length int64) error {
+	return fileTryLock(f.File, typ, off, length)
+}
+
+func (f *notifyFile) Unlock(off, length int64) error {
+	return fileUnlock(f.File, off, length)
+}
+
+// ----- 网络传输 -----
+
+//通过新连接监视远程路径，该连接只用于推送事件
+func (c *Client) Watch(name string, recursive bool) (w *Watcher, err error) {
+	wc, err := c.redial()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			wc.conn.Close()
+		}
+	}()
+	defer onPanic(&err)
+
+	wc.doRequest(FS_WATCH)
+	wc.writeString(name)
+	wc.writeBool(recursive)
+
+	wc.waitResponse(FS_WATCH)
+	if err = wc.readError(); err != nil {
+		return nil, err
+	}
+
+	w = newWatcher(func() (err error) {
+		defer onPanic(&err)
+		wc.doRequest(LINK_CLOSE)
+		wc.flush()
+		wc.Close()
+		return
+	})
+
+	wc.conn.SetDeadline(time.Time{})
+	go wc.readEvents(w)
+
+	return w, nil
+}
+
+func (c *conn) readEvents(w *Watcher) {
+	defer close(w.Errors)
+	defer close(w.Events)
+	defer func() {
+		if x := recover(); x != nil {
+			switch x.(type) {
+			case IO_Error, Data_Error :
+			default:
+				panic(x)
+			}
+		}
+	}()
+
+	for {
+		_type := c.readUint8()
+		if _type != TYPE_EVENT {
+			panic(Data_Error("Expect Event"))
+		}
+
+		op := EventOp(c.readUint8())
+		name := c.readString()
+		err := c.readError()
+
+		if err != nil {
+			w.sendError(err)
+			continue
+		}
+
+		select {
+		case w.Events <- Event{name, op}:
+		case <-w.done:
+			return
+		}
+	}
+}
+
+func (c *Server) fs_watch() {
+	name := c.readPath()
+	recursive := c.readBool()
+
+	var w *Watcher
+	var err error
+
+	if fs, ok := c.fs.(WatchFs); ok {
+		w, err = fs.Watch(name, recursive)
+	} else {
+		err = errors.New("Watch Not Supported")
+	}
+
+	c.doResponse(FS_WATCH)
+	c.writeError(err)
+	c.flush()
+
+	if err != nil {
+		return
+	}
+	defer w.Close()
+
+	//客户端关闭或断开
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer func() { recover() }()
+
+		c.conn.conn.SetReadDeadline(time.Time{})
+		c.waitRequest()
+	}()
+
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			c.writeEvent(ev, nil)
+		case err, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+			c.writeEvent(Event{}, err)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (c *conn) writeEvent(ev Event, err error) {
+	err2 := c.conn.SetWriteDeadline(time.Now().Add(ActionTimeout))
+	if err2 != nil {
+		panic(IO_Error(err2.Error()))
+	}
+
+	c.writeUint8(TYPE_EVENT)
+	c.writeUint8(uint8(ev.Op))
+	c.writeString(ev.Name)
+	c.writeError(err)
+	c.flush()
+}
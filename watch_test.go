@@ -0,0 +1,159 @@
+package netfs
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func test_wait_event(t *testing.T, w *Watcher, name string, op EventOp) {
+	timeout := time.After(3 * time.Second)
+
+	for {
+		select {
+		case ev := <-w.Events:
+			if ev.Name == name && ev.Op == op {
+				return
+			}
+		case err := <-w.Errors:
+			t.Errorf("Watch error: %v", err)
+		case <-timeout:
+			t.Errorf("Watch expect:%s %s, get:timeout", op, name)
+			return
+		}
+	}
+}
+
+//一段时间内没有 name 的事件
+func test_no_event(t *testing.T, w *Watcher, name string) {
+	timeout := time.After(300 * time.Millisecond)
+
+	for {
+		select {
+		case ev := <-w.Events:
+			if ev.Name == name {
+				t.Errorf("Watch expect:no event, get:%s %s", ev.Op, ev.Name)
+			}
+		case err := <-w.Errors:
+			t.Errorf("Watch error: %v", err)
+		case <-timeout:
+			return
+		}
+	}
+}
+
+func Test_Watch(t *testing.T) {
+	go Listen("127.0.0.1:11121", new(MemFs).Init())
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11121")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	c.Mkdir("dir", 0755)
+
+	w, err := c.Watch("dir", false)
+	if err != nil {
+		t.Fatalf("Watch expect:nil, get:%v", err)
+	}
+	defer w.Close()
+
+	f, err := c.Create("dir/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	test_wait_event(t, w, "/dir/a.txt", EVENT_CREATE)
+
+	f.WriteString("hello")
+	test_wait_event(t, w, "/dir/a.txt", EVENT_WRITE)
+	f.Close()
+
+	//非递归监视不包括下下级
+	c.Mkdir("dir/sub", 0755)
+	test_wait_event(t, w, "/dir/sub", EVENT_CREATE)
+	c.Create("dir/sub/b.txt")
+	test_no_event(t, w, "/dir/sub/b.txt")
+
+	c.Remove("dir/a.txt")
+	test_wait_event(t, w, "/dir/a.txt", EVENT_REMOVE)
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Close expect:nil, get:%v", err)
+	}
+	for range w.Events {
+	}
+}
+
+func Test_LocalFs_Watch(t *testing.T) {
+	local, clean := test_local_fs(t, "dir/")
+	defer clean()
+
+	fs, ok := interface{}(local).(WatchFs)
+	if !ok {
+		t.Skip("LocalFs.Watch not supported")
+	}
+
+	w, err := fs.Watch("/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	ioutil.WriteFile(filepath.Join(local.RootPath, "dir", "a.txt"), []byte("x"), 0644)
+	test_wait_event(t, w, "/dir/a.txt", EVENT_CREATE)
+
+	local.Rename("dir", "dir2")
+	test_wait_event(t, w, "/dir", EVENT_RENAME)
+	test_wait_event(t, w, "/dir2", EVENT_CREATE)
+
+	//改名后的目录按新路径报告
+	ioutil.WriteFile(filepath.Join(local.RootPath, "dir2", "b.txt"), []byte("x"), 0644)
+	test_wait_event(t, w, "/dir2/b.txt", EVENT_CREATE)
+
+	//移出监视范围的目录不再报告
+	local.Mkdir("dir2/sub", 0755)
+	w2, err := fs.Watch("/dir2", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w2.Close()
+
+	local.Rename("dir2/sub", "out")
+	test_wait_event(t, w2, "/dir2/sub", EVENT_RENAME)
+	ioutil.WriteFile(filepath.Join(local.RootPath, "out", "c.txt"), []byte("x"), 0644)
+	test_no_event(t, w2, "/dir2/sub/c.txt")
+}
+
+func Test_Watch_ReadOnly(t *testing.T) {
+	local, clean := test_local_fs(t, "dir/")
+	defer clean()
+
+	if _, ok := interface{}(local).(WatchFs); !ok {
+		t.Skip("LocalFs.Watch not supported")
+	}
+
+	exports := new(Exports).Init()
+	exports.Add(&Share{Fs: local, ReadOnly: true})
+
+	go exports.Listen("127.0.0.1:11141")
+	time.Sleep(100 * time.Millisecond)
+
+	c, err := Dial("127.0.0.1:11141")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	w, err := c.Watch("dir", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	//只读共享目录也能感知本地的修改
+	ioutil.WriteFile(filepath.Join(local.RootPath, "dir", "a.txt"), []byte("x"), 0644)
+	test_wait_event(t, w, "/dir/a.txt", EVENT_CREATE)
+}
@@ -0,0 +1,55 @@
+package netfs
+
+import (
+	"archive/zip"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+//zip 归档上的只读文件系统
+//
+//未压缩的项按偏移随机读取，压缩的项顺序解压，向回 Seek 时重新解压。
+type ZipFs struct {
+	archiveFs
+}
+
+func (z *ZipFs) Init(r io.ReaderAt, size int64) (*ZipFs, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	z.init()
+	for _, f := range zr.File {
+		fi := f.FileInfo()
+		e := &archiveEntry{info: &FileInfo{size: fi.Size(), mode: fi.Mode(), modtime: fi.ModTime()}}
+
+		switch {
+		case fi.IsDir():
+			e.info.size = 0
+		case fi.Mode()&os.ModeSymlink != 0:
+			//链接目标保存为内容
+			rc, err := f.Open()
+			if err != nil {
+				return nil, err
+			}
+			target, err := ioutil.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+			e.link = string(target)
+		default:
+			e.open = f.Open
+			if f.Method == zip.Store {
+				if off, err := f.DataOffset(); err == nil {
+					e.ra = io.NewSectionReader(r, off, fi.Size())
+				}
+			}
+		}
+
+		z.add(f.Name, e)
+	}
+	return z, nil
+}